@@ -36,8 +36,7 @@ func TypeAs(typ reflect.Type) p.P {
 		if otype == typ {
 			return obj, nil
 		}
-		return nil, fmt.Errorf("Args Type Sign Check: excpet %v but %v is %v",
-			typ, obj, otype)
+		return nil, TypeSignError{Type{typ, false}, obj}
 	}
 }
 
@@ -45,15 +44,16 @@ func TypeAs(typ reflect.Type) p.P {
 // Var。
 func argParser(atom Atom) p.P {
 	one := func(st p.State) (interface{}, error) {
-		var err error
-		if data, err := st.Next(); err == nil {
-			if _, err := typeis(atom)(st.Pos(), data); err == nil {
-				slot := VarSlot(atom.Type)
-				slot.Set(data)
-				return slot, nil
-			}
+		data, err := st.Next()
+		if err != nil {
+			return nil, err
 		}
-		return nil, err
+		if _, err := typeis(atom)(st.Pos(), data); err != nil {
+			return nil, err
+		}
+		slot := VarSlot(atom.Type)
+		slot.Set(data)
+		return slot, nil
 	}
 	if atom.Name == "..." {
 		return p.Many(one)
@@ -83,7 +83,7 @@ func GetArgs(env Env, parser p.P, args []interface{}) ([]interface{}, error) {
 	st := p.NewBasicState(ret)
 	_, err = parser(&st)
 	if err != nil {
-		return nil, fmt.Errorf("Args Type Sign Check got error:%v", err)
+		return nil, fmt.Errorf("Args Type Sign Check got error: %w", signError(ret, err))
 	}
 	return ret, nil
 }
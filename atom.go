@@ -24,22 +24,43 @@ func (atom Atom) String() string {
 // Eval 方法实现 atom 实例的求值行为
 func (atom Atom) Eval(env Env) (interface{}, error) {
 	if s, ok := env.Lookup(atom.Name); ok {
-		switch slot := s.(type) {
-		case Var:
-			value := slot.Get()
-			return value, nil
-		case TaskExpr:
-			return slot(env)
-		default:
-			return slot, nil
-		}
+		return slotValue(env, s)
 	}
-	return nil, fmt.Errorf("value of atom %s not found", atom.Name)
+	return nil, NameError{atom.Name}
 }
 
+// slotValue 给出命名查找结果作为 atom 的值， Var 取其值， TaskExpr 在 env 中执行
+func slotValue(env Env, s interface{}) (interface{}, error) {
+	switch slot := s.(type) {
+	case Var:
+		value := slot.Get()
+		return value, nil
+	case TaskExpr:
+		return slot(env)
+	default:
+		return slot, nil
+	}
+}
+
+// variadicName 是变长参数标记 ... ，它不能用普通的 atom 名字规则解析
+var variadicName = p.Str("...").Bind(stopWord)
+
+// restName 是 (a b . rest) 中单独出现的 . ，它把其后的模式绑定到剩余的元素
+var restName = p.Chr('.').Bind(stopWord)
+
+// nameRune 读取 atom 名字中的一个字符，名字在 #| 和 #; 之前结束，所以注释可以紧跟
+// 在名字后面
+var nameRune = beforeComment(p.RuneNone("'`,[](){} \t\r\n\".:;"))
+
 func atomNameParser() p.P {
 	return p.Do(func(state p.State) interface{} {
-		ret := p.Many1(p.RuneNone("'[]() \t\r\n\".:")).Bind(p.ReturnString).Exec(state)
+		if _, err := p.Try(variadicName)(state); err == nil {
+			return "..."
+		}
+		if _, err := p.Try(restName)(state); err == nil {
+			return "."
+		}
+		ret := p.Many1(nameRune).Bind(p.ReturnString).Exec(state)
 		test := p.BasicStateFromText(ret.(string))
 		_, err := p.Many1(p.Digit).Then(p.EOF).Parse(&test)
 		if err == nil {
@@ -64,37 +64,7 @@ var Axiom = Toolkit{
 				return reflect.DeepEqual(args[0], args[1]), nil
 			}, nil
 		}),
-		"cond": TaskExpr(func(env Env, args ...interface{}) (Tasker, error) {
-			cases := args[0].([]interface{})
-			l := len(args)
-			var els interface{}
-			if l > 1 {
-				els = args[1]
-			} else {
-				els = nil
-			}
-
-			for _, b := range cases { // FIXME: need a else
-				branch := b.([]interface{})
-				cond := branch[0].(List)
-				result, err := Eval(env, cond)
-				if err != nil {
-					return nil, err
-				}
-				if ok := result.(bool); ok {
-					return func(env Env) (interface{}, error) {
-						return Eval(env, branch[1])
-					}, nil
-				}
-			}
-			// else branch
-			if els != nil {
-				return func(env Env) (interface{}, error) {
-					return Eval(env, els)
-				}, nil
-			}
-			return nil, nil
-		}),
+		"cond": condForm{},
 		"car": TaskExpr(func(env Env, args ...interface{}) (Tasker, error) {
 			if lisp, ok := args[0].(List); ok {
 				return Q(lisp[0]).Eval, nil
@@ -129,7 +99,7 @@ func set(env Env, slot, arg interface{}) (interface{}, error) {
 	switch setter := slot.(type) {
 	case Atom:
 		err := env.Setvar(setter.Name, arg)
-		if err == nil {
+		if err != nil {
 			return nil, err
 		}
 		return arg, nil
@@ -152,3 +122,70 @@ func set(env Env, slot, arg interface{}) (interface{}, error) {
 			slot, reflect.TypeOf(slot), arg)
 	}
 }
+
+// condForm 实现 (cond ((test expr)...) else) ，依次对 test 求值，返回第一个为真的分支的
+// expr 的值，都不为真时返回 else 的值，没有 else 时返回 nil 。它是独立的类型，字节码
+// 编译器据此识别 cond 并编译为跳转
+type condForm struct{}
+
+// condBranches 检查 cond 的参数形式，返回分支和 else 表达式
+func condBranches(args []interface{}) ([]List, interface{}, error) {
+	if len(args) < 1 || len(args) > 2 {
+		return nil, nil, fmt.Errorf("cond args error: expect (cond ((test expr)...) else) but %v", args)
+	}
+	cases, ok := args[0].(List)
+	if !ok {
+		return nil, nil, fmt.Errorf("cond args error: expect branches list but %v", args[0])
+	}
+	branches := make([]List, len(cases))
+	for idx, c := range cases {
+		branch, ok := c.(List)
+		if !ok || len(branch) != 2 {
+			return nil, nil, fmt.Errorf("cond args error: expect branch as (test expr) but %v", c)
+		}
+		branches[idx] = branch
+	}
+	var els interface{}
+	if len(args) == 2 {
+		els = args[1]
+	}
+	return branches, els, nil
+}
+
+// Task 实现 Functor
+func (cond condForm) Task(env Env, args ...interface{}) (Lisp, error) {
+	expr, err := cond.choose(env, args...)
+	if err != nil {
+		return nil, err
+	}
+	return TaskBox{func(env Env) (interface{}, error) {
+		return Eval(env, expr)
+	}}, nil
+}
+
+// evalTail 在尾位置上对选中的分支求值
+func (cond condForm) evalTail(env Env, args ...interface{}) (interface{}, *tailCall, error) {
+	expr, err := cond.choose(env, args...)
+	if err != nil {
+		return nil, nil, err
+	}
+	return evalTail(env, expr)
+}
+
+// choose 依次对 test 求值，给出选中分支的表达式
+func (cond condForm) choose(env Env, args ...interface{}) (interface{}, error) {
+	branches, els, err := condBranches(args)
+	if err != nil {
+		return nil, err
+	}
+	for _, branch := range branches {
+		result, err := Eval(env, branch[0])
+		if err != nil {
+			return nil, err
+		}
+		if Truthy(result) {
+			return branch[1], nil
+		}
+	}
+	return els, nil
+}
@@ -1 +1,103 @@
 package gisp
+
+import (
+	"fmt"
+
+	p "github.com/Dwarfartisan/goparsec2"
+)
+
+// BraceParser 解析 {key value ...} 形式的字典字面量，给出 Dict
+func BraceParser() p.P {
+	return braceParser(ValueParser())
+}
+
+// BraceParserExt 在带有 Ext 的环境下解析字典字面量
+func BraceParserExt(env Env) p.P {
+	return braceParser(ValueParserExt(env))
+}
+
+// braceParser 用 value 解析字典的键和值。键必须是字符串或 Keyword ， :name 等同于
+// "name" ，同一个键不能出现两次
+func braceParser(value p.P) p.P {
+	return func(st p.State) (interface{}, error) {
+		if _, err := p.Chr('{')(st); err != nil {
+			return nil, err
+		}
+		// 读到 { 之后只能是字典字面量，后面的错误都由 faultAt 报告，不再交给其它分支
+		dict := Dict{}
+		for {
+			if _, err := Skip(st); err != nil {
+				return nil, err
+			}
+			if _, err := p.Try(p.Chr('}'))(st); err == nil {
+				return dict, nil
+			}
+			pos := st.Pos()
+			if _, err := p.EOF(st); err == nil {
+				return nil, faultAt(st, pos, fmt.Errorf("dict literal error: expect } but eof"))
+			}
+			k, err := value(st)
+			if err != nil {
+				return nil, faultAt(st, pos, fmt.Errorf("dict literal error: expect a key but %v", err))
+			}
+			var key string
+			switch x := k.(type) {
+			case string:
+				key = x
+			case Keyword:
+				key = string(x)
+			default:
+				return nil, faultAt(st, pos, fmt.Errorf("dict literal error: expect a string or keyword key but %v", k))
+			}
+			if _, ok := dict[key]; ok {
+				return nil, faultAt(st, pos, fmt.Errorf("dict literal error: duplicate key %q", key))
+			}
+			if _, err := Skip(st); err != nil {
+				return nil, err
+			}
+			if _, err := p.Try(p.Chr('}'))(st); err == nil {
+				return nil, faultAt(st, pos, fmt.Errorf("dict literal error: missing value for key %q", key))
+			}
+			if dict[key], err = value(st); err != nil {
+				return nil, faultAt(st, pos, fmt.Errorf("dict literal error: expect a value for %q but %v", key, err))
+			}
+		}
+	}
+}
+
+// structSuffix 解析紧跟在类型名之后的 {Field pattern ...} ，给出与之等价的
+// (struct T Field pattern ...) 模式，没有紧跟 { 时原样给出 x
+func structSuffix(value p.P) func(interface{}) p.P {
+	return func(x interface{}) p.P {
+		return func(st p.State) (interface{}, error) {
+			name, ok := x.(Atom)
+			if !ok {
+				return x, nil
+			}
+			if _, err := p.Try(p.Chr('{'))(st); err != nil {
+				return x, nil
+			}
+			pattern := List{AA("struct"), name}
+			for {
+				if _, err := Skip(st); err != nil {
+					return nil, err
+				}
+				if _, err := p.Try(p.Chr('}'))(st); err == nil {
+					return pattern, nil
+				}
+				field, err := atomNameParser().Parse(st)
+				if err != nil {
+					return nil, fmt.Errorf("struct pattern error: expect a field name in %s{...} but %v", name.Name, err)
+				}
+				if _, err := Skip(st); err != nil {
+					return nil, err
+				}
+				item, err := value(st)
+				if err != nil {
+					return nil, fmt.Errorf("struct pattern error: expect a pattern for %s but %v", field, err)
+				}
+				pattern = append(pattern, AA(field.(string)), item)
+			}
+		}
+	}
+}
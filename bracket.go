@@ -12,10 +12,16 @@ import (
 type Bracket struct {
 	obj  interface{}
 	expr []interface{}
+	span Span
 }
 
 // Eval 方法实现 Bracket 表达式的求值
 func (bracket Bracket) Eval(env Env) (interface{}, error) {
+	value, err := bracket.eval(env)
+	return value, withSpan(bracket.span, err)
+}
+
+func (bracket Bracket) eval(env Env) (interface{}, error) {
 	obj, err := Eval(env, bracket.obj)
 	if err != nil {
 		return nil, err
@@ -35,7 +41,10 @@ func (bracket Bracket) Eval(env Env) (interface{}, error) {
 
 	case reflect.Map:
 		if len(bracket.expr) == 1 {
-			key := reflect.ValueOf(bracket.expr[0])
+			key, err := bracket.mapKey(env, val)
+			if err != nil {
+				return nil, err
+			}
 			v := val.MapIndex(key)
 			return bracket.inter(v), nil
 		}
@@ -142,16 +151,34 @@ func (bracket Bracket) SetMapIndex(val reflect.Value, env Env, item interface{})
 		return nil, fmt.Errorf("Excpet %v[%v]=%v but %v has error items(only accept one key)",
 			val.Interface(), bracket.expr, item, bracket.expr)
 	}
-	k, err := Eval(env, bracket.expr[0])
+	key, err := bracket.mapKey(env, val)
 	if err != nil {
 		return nil, err
 	}
-	key := reflect.ValueOf(k)
 	value := reflect.ValueOf(item)
 	val.SetMapIndex(key, value)
 	return val.Interface(), nil
 }
 
+// mapKey 对键求值并转为 map 的键类型， Keyword 可以作为 string 键使用
+func (bracket Bracket) mapKey(env Env, val reflect.Value) (reflect.Value, error) {
+	k, err := Eval(env, bracket.expr[0])
+	if err != nil {
+		return reflect.Value{}, err
+	}
+	if kw, ok := k.(Keyword); ok {
+		k = string(kw)
+	}
+	key := reflect.ValueOf(k)
+	typ := val.Type().Key()
+	if !key.IsValid() || !key.Type().ConvertibleTo(typ) ||
+		(typ.Kind() == reflect.String) != (key.Kind() == reflect.String) {
+		return reflect.Value{}, fmt.Errorf("Key %v is invalid for map %v[%v]",
+			k, bracket.obj, bracket.expr)
+	}
+	return key.Convert(typ), nil
+}
+
 // SetSliceIndex 是为线性序列切片进行写操作的实现
 func (bracket Bracket) SetSliceIndex(val reflect.Value, env Env, item interface{}) (interface{}, error) {
 	if len(bracket.expr) < 1 {
@@ -185,15 +212,15 @@ func IntVal(st px.ParsexState) (interface{}, error) {
 
 // BracketParser 尝试将 state 中下一个值解析为中括号表达式
 func BracketParser() p.P {
-	return p.Between(p.Chr('['), p.Chr(']'),
-		p.SepBy1(ValueParser(), p.Chr(':')),
+	return p.Between(p.Chr('[').Then(Skip), Skip.Then(p.Chr(']')),
+		p.SepBy1(ValueParser(), Skip.Then(p.Chr(':')).Then(Skip)),
 	)
 }
 
 // BracketParserExt 在带有 Ext 的环境下解析中括号表达式
 func BracketParserExt(env Env) p.P {
-	return p.Between(p.Chr('['), p.Chr(']'),
-		p.SepBy1(ValueParserExt(env), p.Chr(':')),
+	return p.Between(p.Chr('[').Then(Skip), Skip.Then(p.Chr(']')),
+		p.SepBy1(ValueParserExt(env), Skip.Then(p.Chr(':')).Then(Skip)),
 	)
 }
 
@@ -207,7 +234,7 @@ func (be BracketExpr) Task(env Env, args ...interface{}) (Lisp, error) {
 	if len(args) != 1 {
 		return nil, fmt.Errorf("Bracket Expression Args Error: expect a arg but %v", args)
 	}
-	return Bracket{args[0], be.Expr}, nil
+	return Bracket{obj: args[0], expr: be.Expr}, nil
 }
 
 // BracketExprParserExt 返回带 Ext 环境的 BracketExpr 。
@@ -0,0 +1,455 @@
+package gisp
+
+// Op 是字节码指令的操作码
+type Op byte
+
+const (
+	// OpConst 把常量 A 压栈
+	OpConst Op = iota
+	// OpLookup 对常量 A 中的 Atom 求值并压栈
+	OpLookup
+	// OpParam 把 lambda 的第 B 个参数压栈，常量 A 中的参数名被 var 遮蔽时与 OpLookup 相同
+	OpParam
+	// OpEval 对常量 A 中的 Lisp 对象（ Dot 、 Bracket 、 QuasiQuote 等）求值并压栈
+	OpEval
+	// OpStep 消耗一步求值预算，对应一次 List.Eval
+	OpStep
+	// OpCallee 查找常量 A 命名的可调用对象并压栈
+	OpCallee
+	// OpSpecial 栈顶的可调用对象不是函数时将其弹出，以常量 A 中的原始 List 调用它，
+	// 结果压栈后跳转到 B ；是函数时继续执行后面的实参代码
+	OpSpecial
+	// OpCall 以栈顶的 A 个实参调用其下的函数
+	OpCall
+	// OpForm 栈顶是 builtins 中名为常量 A 的特殊形式时将其弹出，继续执行编译好的代码，
+	// 否则跳转到 B ，以原始的 List 调用它
+	OpForm
+	// OpApply 弹出栈顶的可调用对象，以常量 A 中的原始 List 调用它
+	OpApply
+	// OpJump 跳转到 B
+	OpJump
+	// OpJumpIfFalse 弹出栈顶的测试结果，按 Truthy 为假时跳转到 B
+	OpJumpIfFalse
+	// OpPop 弹出栈顶
+	OpPop
+	// OpCheck 检查栈顶的结果是否超出长度预算
+	OpCheck
+	// OpLet 弹出栈顶的 B 个值，依次绑定到常量 A 中的变量或模式，进入新的 let 作用域
+	OpLet
+	// OpLeave 退出最内层的 let 作用域
+	OpLeave
+	// OpTry 进入 try 区域，能被捕获的错误跳转到 catch 的代码 A ，其它错误跳转到 finally 的
+	// 代码 B ，没有 catch 或 finally 时为 -1 。进入 catch 时栈顶是错误，进入 finally 时栈顶
+	// 依次是结果和待处理的错误
+	OpTry
+	// OpPopHandler 退出最内层的循环或 try 区域
+	OpPopHandler
+	// OpEndFinally 弹出 finally 待处理的错误，不是 nil 时继续报告它
+	OpEndFinally
+	// OpLambda 以常量 A 中的 lambda 形式和常量 B 中编译好的函数体构造 Lambda 并压栈
+	OpLambda
+	// OpTailCall 与 OpCall 相同，但是调用 Function 或 Lambda 时结束执行，把调用作为尾调用返回
+	OpTailCall
+	// OpTailSpecial 与 OpSpecial 相同，但是 cond 和 let 在尾位置上求值，遇到尾调用时结束执行
+	OpTailSpecial
+	// OpTailApply 与 OpApply 相同，但是 cond 和 let 在尾位置上求值，遇到尾调用时结束执行
+	OpTailApply
+	// OpLoop 进入循环区域，区域中的 break 跳转到 A ， continue 跳转到 B 。栈顶是循环的值，
+	// break 时替换为 break 给出的值
+	OpLoop
+	// OpIter 把栈顶替换为遍历它的迭代器， B 为 0 时是 dotimes 的次数，为 1 时是 for 的集合，
+	// 常量 A 是循环头
+	OpIter
+	// OpNext 从栈顶的迭代器取出下一次循环的 A 个变量值压栈，没有更多的值时跳转到 B
+	OpNext
+)
+
+var opNames = []string{"const", "lookup", "param", "eval", "step", "callee",
+	"special", "call", "form", "apply", "jump", "jump-if-false", "pop", "check",
+	"let", "leave", "try", "pop-handler", "end-finally", "lambda",
+	"tail-call", "tail-special", "tail-apply", "loop", "iter", "next"}
+
+func (op Op) String() string {
+	if int(op) < len(opNames) {
+		return opNames[op]
+	}
+	return "unknown"
+}
+
+// Instr 是一条字节码指令， A 、 B 的含义由 Op 决定
+type Instr struct {
+	Op Op
+	A  int
+	B  int
+}
+
+// Chunk 是一段编译好的字节码， Spans 记录每条指令所属表达式的源码位置。 Chunk 编译后
+// 不再修改，可以被多个 goroutine 共享
+type Chunk struct {
+	Code   []Instr
+	Consts []interface{}
+	Spans  []Span
+}
+
+// CompileChunk 把 Read 得到的一组表达式编译为字节码，执行结果是最后一个表达式的值。
+// 函数调用编译为对实参求值再调用的指令； cond 、 if 、 when 、 unless 、 do 编译为条件跳转，
+// let 、循环和 try 编译为作用域和区域指令， lambda 的函数体预先编译；其它特殊形式在运行时
+// 以原始的 List 调用。命名仍然在运行时按环境查找，所以结果与解释执行一致。最后一个
+// 表达式处于尾位置，作为 lambda 的函数体执行时，其中的函数调用是尾调用
+func CompileChunk(forms []interface{}) (*Chunk, error) {
+	c := chunkCompiler{chunk: &Chunk{}}
+	c.forms(forms, true)
+	return c.chunk, nil
+}
+
+// compileBody 把 lambda 的函数体编译为字节码，形参编译为按位置读取参数的指令
+func compileBody(formals List, body []interface{}) *Chunk {
+	params := map[string]int{}
+	for idx, formal := range formals {
+		params[formal.(Atom).Name] = idx
+	}
+	c := chunkCompiler{chunk: &Chunk{}, params: params}
+	c.forms(body, true)
+	return c.chunk
+}
+
+type chunkCompiler struct {
+	chunk  *Chunk
+	params map[string]int
+	span   Span
+}
+
+func (c *chunkCompiler) emit(op Op, a, b int) int {
+	c.chunk.Code = append(c.chunk.Code, Instr{op, a, b})
+	c.chunk.Spans = append(c.chunk.Spans, c.span)
+	return len(c.chunk.Code) - 1
+}
+
+func (c *chunkCompiler) constant(x interface{}) int {
+	c.chunk.Consts = append(c.chunk.Consts, x)
+	return len(c.chunk.Consts) - 1
+}
+
+// patch 把 at 处跳转指令的目标设为下一条要生成的指令
+func (c *chunkCompiler) patch(at int) {
+	c.chunk.Code[at].B = len(c.chunk.Code)
+}
+
+// forms 依次编译一组表达式，结果是最后一个表达式的值， tail 指示它是否处于尾位置
+func (c *chunkCompiler) forms(forms []interface{}, tail bool) {
+	if len(forms) == 0 {
+		c.emit(OpConst, c.constant(nil), 0)
+		return
+	}
+	for idx, form := range forms {
+		if idx > 0 {
+			c.emit(OpPop, 0, 0)
+		}
+		c.form(form, tail && idx == len(forms)-1)
+	}
+}
+
+// form 编译一个表达式， tail 指示它是否处于尾位置
+func (c *chunkCompiler) form(form interface{}, tail bool) {
+	switch lisp := form.(type) {
+	case List:
+		c.list(lisp, tail)
+	case Atom:
+		if idx, ok := c.params[lisp.Name]; ok {
+			c.emit(OpParam, c.constant(lisp), idx)
+		} else {
+			c.emit(OpLookup, c.constant(lisp), 0)
+		}
+	case Quote:
+		c.emit(OpConst, c.constant(lisp.Lisp), 0)
+	case Lisp:
+		c.emit(OpEval, c.constant(lisp), 0)
+	default:
+		c.emit(OpConst, c.constant(Value(lisp)), 0)
+	}
+}
+
+func (c *chunkCompiler) list(list List, tail bool) {
+	outer := c.span
+	if span, ok := SpanOf(list); ok {
+		c.span = span
+	}
+	defer func() {
+		c.span = outer
+	}()
+	c.emit(OpStep, 0, 0)
+	if len(list) == 0 {
+		c.emit(OpConst, c.constant(nil), 0)
+		return
+	}
+	switch head := list[0].(type) {
+	case Atom:
+		c.emit(OpCallee, c.constant(head.Name), 0)
+		if compile := c.special(list, head.Name, tail); compile != nil {
+			c.guarded(list, head.Name, tail, compile)
+			return
+		}
+	case List:
+		c.list(head, false)
+	default:
+		callee, _ := List{head}.callee(nil)
+		c.emit(OpConst, c.constant(callee), 0)
+	}
+	special, call := OpSpecial, OpCall
+	if tail {
+		special, call = OpTailSpecial, OpTailCall
+	}
+	at := c.emit(special, c.constant(list), 0)
+	for idx, arg := range list[1:] {
+		c.arg(list.itemSpan(idx+1), arg)
+	}
+	c.emit(call, len(list)-1, 0)
+	c.patch(at)
+	c.emit(OpCheck, 0, 0)
+}
+
+// arg 编译调用的实参， span 是解析时记录的实参 Atom 的位置，命名找不到时报告它
+func (c *chunkCompiler) arg(span Span, arg interface{}) {
+	if !span.IsValid() {
+		c.form(arg, false)
+		return
+	}
+	outer := c.span
+	c.span = span
+	c.form(arg, false)
+	c.span = outer
+}
+
+// special 给出编译特殊形式 list 的方法，它返回需要跳到形式结尾的跳转指令。 name 不是可以
+// 编译的形式，或者形式的结构不正确时返回 nil ，由运行时以原始的 List 调用并报告错误
+func (c *chunkCompiler) special(list List, name string, tail bool) func() []int {
+	args := list[1:]
+	switch name {
+	case "cond":
+		if branches, els, err := condBranches(args); err == nil {
+			return func() []int {
+				return c.cond(branches, els, tail)
+			}
+		}
+	case "if":
+		if len(args) == 2 || len(args) == 3 {
+			return func() []int {
+				return c.branch(args[0], args[1:2], args[2:], tail)
+			}
+		}
+	case "when", "unless":
+		if len(args) > 0 {
+			body, other := args[1:], []interface{}{}
+			if name == "unless" {
+				body, other = other, body
+			}
+			return func() []int {
+				return c.branch(args[0], body, other, tail)
+			}
+		}
+	case "do", "begin":
+		return func() []int {
+			c.forms(args, tail)
+			return nil
+		}
+	case "let":
+		if targets, values, ok := letBindings(args); ok {
+			return func() []int {
+				for _, value := range values {
+					c.form(value, false)
+				}
+				c.scope(targets, func() {
+					c.forms(args[1:], tail)
+				})
+				return nil
+			}
+		}
+	case "while":
+		if len(args) > 0 {
+			return func() []int {
+				c.while(args[0], args[1:])
+				return nil
+			}
+		}
+	case "dotimes", "for":
+		min, max, kind := 1, 1, 0
+		if name == "for" {
+			max, kind = 2, 1
+		}
+		if head, ok := loopVars(args, min, max); ok {
+			return func() []int {
+				c.iterate(head, kind, args[1:])
+				return nil
+			}
+		}
+	case "try":
+		if body, catch, finally, err := tryClauses(args); err == nil {
+			return func() []int {
+				c.try(body, catch, finally)
+				return nil
+			}
+		}
+	case "lambda":
+		if len(args) > 0 {
+			formals, ok := args[0].(List)
+			probe := Lambda{map[string]interface{}{}, List{}}
+			if ok && probe.prepareArgs(formals) == nil {
+				body := compileBody(probe.Meta["formal parameters"].(List), args[1:])
+				return func() []int {
+					c.emit(OpLambda, c.constant(list), c.constant(body))
+					return nil
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// guarded 以 compile 编译 builtins 中的特殊形式 name ，运行时 name 被重新定义为其它对象时
+// 按普通的 List 调用
+func (c *chunkCompiler) guarded(list List, name string, tail bool, compile func() []int) {
+	generic := c.emit(OpForm, c.constant(name), 0)
+	ends := compile()
+	ends = append(ends, c.emit(OpJump, 0, 0))
+	c.patch(generic)
+	if tail {
+		c.emit(OpTailApply, c.constant(list), 0)
+	} else {
+		c.emit(OpApply, c.constant(list), 0)
+	}
+	for _, end := range ends {
+		c.patch(end)
+	}
+	c.emit(OpCheck, 0, 0)
+}
+
+// cond 把 cond 的分支编译为条件跳转
+func (c *chunkCompiler) cond(branches []List, els interface{}, tail bool) []int {
+	ends := []int{}
+	for _, branch := range branches {
+		c.form(branch[0], false)
+		next := c.emit(OpJumpIfFalse, 0, 0)
+		c.form(branch[1], tail)
+		ends = append(ends, c.emit(OpJump, 0, 0))
+		c.patch(next)
+	}
+	c.form(els, tail)
+	return ends
+}
+
+// branch 编译 if 、 when 和 unless ， test 为真时对 then 求值，否则对 other 求值
+func (c *chunkCompiler) branch(test interface{}, then, other []interface{}, tail bool) []int {
+	c.form(test, false)
+	next := c.emit(OpJumpIfFalse, 0, 0)
+	c.forms(then, tail)
+	end := c.emit(OpJump, 0, 0)
+	c.patch(next)
+	c.forms(other, tail)
+	return []int{end}
+}
+
+// scope 在绑定了 targets 的 let 作用域中编译 body ，栈顶的值依次绑定到 targets 。作用域中的
+// 变量遮蔽同名的参数，对它们的引用不再按位置读取
+func (c *chunkCompiler) scope(targets List, body func()) {
+	c.emit(OpLet, c.constant(targets), len(targets))
+	names := map[string]bool{}
+	for _, target := range targets {
+		patternNames(target, names)
+	}
+	outer := c.params
+	c.params = map[string]int{}
+	for name, idx := range outer {
+		if !names[name] {
+			c.params[name] = idx
+		}
+	}
+	body()
+	c.params = outer
+	c.emit(OpLeave, 0, 0)
+}
+
+// loop 编译循环区域， next 生成每次循环开始的代码并返回结束循环的跳转指令。循环体不在尾
+// 位置上，区域结束后栈顶是循环的值
+func (c *chunkCompiler) loop(next func() int, body func()) {
+	at := c.emit(OpLoop, 0, 0)
+	c.chunk.Code[at].B = len(c.chunk.Code)
+	done := next()
+	c.emit(OpStep, 0, 0)
+	body()
+	c.emit(OpJump, 0, c.chunk.Code[at].B)
+	c.patch(done)
+	c.emit(OpPopHandler, 0, 0)
+	c.emit(OpPop, 0, 0)
+	c.emit(OpConst, c.constant(nil), 0)
+	c.chunk.Code[at].A = len(c.chunk.Code)
+}
+
+// while 编译 (while test body...) ，每次循环体都在新的 let 作用域中求值
+func (c *chunkCompiler) while(test interface{}, body []interface{}) {
+	c.emit(OpConst, c.constant(nil), 0)
+	c.loop(func() int {
+		c.form(test, false)
+		return c.emit(OpJumpIfFalse, 0, 0)
+	}, func() {
+		c.scope(List{}, func() {
+			c.forms(body, false)
+			c.emit(OpPop, 0, 0)
+		})
+	})
+}
+
+// iterate 编译 dotimes 和 for ，每次循环的变量绑定在新的 let 作用域中
+func (c *chunkCompiler) iterate(head List, kind int, body []interface{}) {
+	vars := head[:len(head)-1]
+	c.form(head[len(head)-1], false)
+	c.emit(OpIter, c.constant(head), kind)
+	c.loop(func() int {
+		return c.emit(OpNext, len(vars), 0)
+	}, func() {
+		c.scope(vars, func() {
+			c.forms(body, false)
+			c.emit(OpPop, 0, 0)
+		})
+	})
+}
+
+// try 编译 (try body... (catch e handler...) (finally cleanup...)) ，正常结束和 catch 结束时
+// 都带着 nil 的待处理错误进入 finally
+func (c *chunkCompiler) try(body []interface{}, catch, finally List) {
+	at := c.emit(OpTry, -1, -1)
+	c.forms(body, false)
+	c.emit(OpPopHandler, 0, 0)
+	ends := []int{}
+	exit := func() {
+		if finally != nil {
+			c.emit(OpConst, c.constant(nil), 0)
+		}
+		ends = append(ends, c.emit(OpJump, 0, 0))
+	}
+	exit()
+	if catch != nil {
+		c.chunk.Code[at].A = len(c.chunk.Code)
+		c.scope(catch[1:2], func() {
+			c.forms(catch[2:], false)
+		})
+		if finally != nil {
+			c.emit(OpPopHandler, 0, 0)
+		}
+		exit()
+	}
+	if finally != nil {
+		c.chunk.Code[at].B = len(c.chunk.Code)
+		for _, end := range ends {
+			c.patch(end)
+		}
+		ends = nil
+		for _, form := range finally[1:] {
+			c.form(form, false)
+			c.emit(OpPop, 0, 0)
+		}
+		c.emit(OpEndFinally, 0, 0)
+	}
+	for _, end := range ends {
+		c.patch(end)
+	}
+}
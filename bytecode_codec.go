@@ -0,0 +1,763 @@
+package gisp
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"math"
+	"reflect"
+	"sort"
+)
+
+// 字节码文件以 bytecodeMagic 和版本号开头，格式变化时增加 bytecodeVersion
+const (
+	bytecodeMagic   = "GISPBC"
+	bytecodeVersion = 3
+)
+
+// 常量的类型标记
+const (
+	tagNil byte = iota
+	tagBool
+	tagGoBool
+	tagInt
+	tagFloat
+	tagString
+	tagRune
+	tagAtom
+	tagList
+	tagSlice
+	tagQuote
+	tagQuasiQuote
+	tagUnquote
+	tagUnquoteSplicing
+	tagDotExpr
+	tagBracketExpr
+	tagDot
+	tagBracket
+	tagChunk
+	tagKeyword
+	tagDict
+)
+
+// 类型的标记，内置类型按 codecTypes 中的位置编码
+const (
+	typeBuiltin byte = iota
+	typeSlice
+	typeMap
+)
+
+var codecTypes = []reflect.Type{BOOL, FLOAT, INT, STRING, TIME, DURATION, ANY, ATOM, LIST, QUOTE, DICT}
+
+// MarshalBinary 实现 encoding.BinaryMarshaler ，把字节码连同常量和源码位置写为二进制。
+// 常量只能是 gisp 语法树中的值，使用 Go 对象或者环境中自定义类型的常量会返回错误
+func (chunk *Chunk) MarshalBinary() ([]byte, error) {
+	enc := chunkEncoder{}
+	enc.buf.WriteString(bytecodeMagic)
+	enc.buf.WriteByte(bytecodeVersion)
+	if err := enc.chunk(chunk); err != nil {
+		return nil, err
+	}
+	return enc.buf.Bytes(), nil
+}
+
+// UnmarshalBinary 实现 encoding.BinaryUnmarshaler ，读取 MarshalBinary 写出的字节码
+func (chunk *Chunk) UnmarshalBinary(data []byte) error {
+	if !bytes.HasPrefix(data, []byte(bytecodeMagic)) {
+		return fmt.Errorf("bytecode error: expect magic %s", bytecodeMagic)
+	}
+	dec := chunkDecoder{data: data, pos: len(bytecodeMagic)}
+	version, err := dec.byte()
+	if err != nil {
+		return err
+	}
+	if version != bytecodeVersion {
+		return fmt.Errorf("bytecode error: expect version %d but %d", bytecodeVersion, version)
+	}
+	ret, err := dec.chunk()
+	if err != nil {
+		return err
+	}
+	*chunk = *ret
+	return nil
+}
+
+// verify 检查读入的字节码：操作码已知，常量下标和跳转目标不越界，常量的类型与指令一致，
+// 并且沿所有的执行路径模拟栈的深度，指令不会从空栈中弹出，路径汇合处的栈深度相同。
+// 通过检查的字节码执行时不会因为格式错误而 panic
+func (chunk *Chunk) verify() error {
+	for idx, instr := range chunk.Code {
+		if err := chunk.verifyInstr(idx, instr); err != nil {
+			return err
+		}
+	}
+	return chunk.verifyStack()
+}
+
+// verifyInstr 检查第 idx 条指令的操作数
+func (chunk *Chunk) verifyInstr(idx int, instr Instr) error {
+	if int(instr.Op) >= len(opNames) {
+		return fmt.Errorf("bytecode error: unknown op %d at %d", instr.Op, idx)
+	}
+	constant := func(at int) (interface{}, error) {
+		if at < 0 || at >= len(chunk.Consts) {
+			return nil, fmt.Errorf("bytecode error: const %d out of range at %d", at, idx)
+		}
+		return chunk.Consts[at], nil
+	}
+	target := func(at int, optional bool) error {
+		if (at < 0 || at > len(chunk.Code)) && !(optional && at == -1) {
+			return fmt.Errorf("bytecode error: jump %d out of range at %d", at, idx)
+		}
+		return nil
+	}
+	bad := func(c interface{}) error {
+		return fmt.Errorf("bytecode error: unexpected const %v for %v at %d", c, instr.Op, idx)
+	}
+	switch instr.Op {
+	case OpConst:
+		_, err := constant(instr.A)
+		return err
+	case OpLookup, OpParam:
+		c, err := constant(instr.A)
+		if err != nil {
+			return err
+		}
+		if _, ok := c.(Atom); !ok || instr.B < 0 {
+			return bad(c)
+		}
+	case OpEval:
+		c, err := constant(instr.A)
+		if err != nil {
+			return err
+		}
+		if _, ok := c.(Lisp); !ok {
+			return bad(c)
+		}
+	case OpCallee, OpForm:
+		c, err := constant(instr.A)
+		if err != nil {
+			return err
+		}
+		if _, ok := c.(string); !ok {
+			return bad(c)
+		}
+	case OpSpecial, OpTailSpecial, OpApply, OpTailApply, OpLet, OpIter, OpLambda:
+		c, err := constant(instr.A)
+		if err != nil {
+			return err
+		}
+		list, ok := c.(List)
+		switch instr.Op {
+		case OpLet:
+			ok = ok && len(list) == instr.B
+		case OpIter:
+			ok = ok && len(list) > 1 && (instr.B == 0 || instr.B == 1)
+		case OpLambda:
+			if ok = ok && len(list) > 1; ok {
+				_, ok = list[1].(List)
+			}
+		}
+		if !ok {
+			return bad(c)
+		}
+		if instr.Op == OpLambda {
+			if c, err = constant(instr.B); err != nil {
+				return err
+			}
+			if _, ok := c.(*Chunk); !ok {
+				return bad(c)
+			}
+		}
+	case OpCall, OpTailCall, OpNext:
+		if instr.A < 0 {
+			return fmt.Errorf("bytecode error: negative count %d at %d", instr.A, idx)
+		}
+	}
+	switch instr.Op {
+	case OpSpecial, OpTailSpecial, OpForm, OpJump, OpJumpIfFalse, OpNext:
+		return target(instr.B, false)
+	case OpLoop:
+		if err := target(instr.A, false); err != nil {
+			return err
+		}
+		return target(instr.B, false)
+	case OpTry:
+		if err := target(instr.A, true); err != nil {
+			return err
+		}
+		return target(instr.B, true)
+	}
+	return nil
+}
+
+// stackEffect 给出指令顺序执行时弹出和压入的栈元素个数
+func stackEffect(instr Instr) (int, int) {
+	switch instr.Op {
+	case OpConst, OpLookup, OpParam, OpEval, OpCallee, OpLambda:
+		return 0, 1
+	case OpSpecial, OpTailSpecial, OpApply, OpTailApply, OpCheck, OpIter, OpLoop:
+		return 1, 1
+	case OpForm, OpJumpIfFalse, OpPop:
+		return 1, 0
+	case OpCall, OpTailCall:
+		return instr.A + 1, 1
+	case OpLet:
+		return instr.B, 0
+	case OpNext:
+		return 1, instr.A + 1
+	case OpEndFinally:
+		return 2, 1
+	}
+	return 0, 0
+}
+
+// verifyStack 从入口沿所有的执行路径模拟栈的深度
+func (chunk *Chunk) verifyStack() error {
+	depths := make([]int, len(chunk.Code)+1)
+	for idx := range depths {
+		depths[idx] = -1
+	}
+	work := []int{}
+	flow := func(to, depth int) error {
+		switch depths[to] {
+		case -1:
+			depths[to] = depth
+			work = append(work, to)
+		case depth:
+		default:
+			return fmt.Errorf("bytecode error: stack depth %d and %d meet at %d", depths[to], depth, to)
+		}
+		return nil
+	}
+	flow(0, 0)
+	for len(work) > 0 {
+		pc := work[len(work)-1]
+		work = work[:len(work)-1]
+		if pc == len(chunk.Code) {
+			continue
+		}
+		instr := chunk.Code[pc]
+		depth := depths[pc]
+		pop, push := stackEffect(instr)
+		if depth < pop {
+			return fmt.Errorf("bytecode error: stack underflow at %d", pc)
+		}
+		// branches 依次是跳转目标和到达时的栈深度
+		branches := []int{}
+		switch instr.Op {
+		case OpSpecial, OpTailSpecial, OpForm, OpNext, OpJump:
+			branches = append(branches, instr.B, depth)
+		case OpJumpIfFalse:
+			branches = append(branches, instr.B, depth-1)
+		case OpLoop:
+			branches = append(branches, instr.A, depth, instr.B, depth)
+		case OpTry:
+			if instr.A >= 0 {
+				branches = append(branches, instr.A, depth+1)
+			}
+			if instr.B >= 0 {
+				branches = append(branches, instr.B, depth+2)
+			}
+		}
+		if instr.Op != OpJump {
+			branches = append(branches, pc+1, depth-pop+push)
+		}
+		for idx := 0; idx < len(branches); idx += 2 {
+			if err := flow(branches[idx], branches[idx+1]); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+type chunkEncoder struct {
+	buf bytes.Buffer
+}
+
+func (enc *chunkEncoder) uvarint(x uint64) {
+	var data [binary.MaxVarintLen64]byte
+	enc.buf.Write(data[:binary.PutUvarint(data[:], x)])
+}
+
+func (enc *chunkEncoder) varint(x int64) {
+	var data [binary.MaxVarintLen64]byte
+	enc.buf.Write(data[:binary.PutVarint(data[:], x)])
+}
+
+func (enc *chunkEncoder) string(s string) {
+	enc.uvarint(uint64(len(s)))
+	enc.buf.WriteString(s)
+}
+
+func (enc *chunkEncoder) span(span Span) {
+	enc.string(span.File)
+	enc.varint(int64(span.Line))
+	enc.varint(int64(span.Column))
+}
+
+// chunk 写出字节码的指令、源码位置和常量
+func (enc *chunkEncoder) chunk(chunk *Chunk) error {
+	enc.uvarint(uint64(len(chunk.Code)))
+	for idx, instr := range chunk.Code {
+		enc.buf.WriteByte(byte(instr.Op))
+		enc.varint(int64(instr.A))
+		enc.varint(int64(instr.B))
+		enc.span(chunk.Spans[idx])
+	}
+	return enc.values(chunk.Consts)
+}
+
+func (enc *chunkEncoder) values(items []interface{}) error {
+	enc.uvarint(uint64(len(items)))
+	for _, item := range items {
+		if err := enc.value(item); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (enc *chunkEncoder) value(x interface{}) error {
+	switch v := x.(type) {
+	case nil:
+		enc.buf.WriteByte(tagNil)
+	case Bool:
+		enc.buf.WriteByte(tagBool)
+		enc.bool(bool(v))
+	case bool:
+		enc.buf.WriteByte(tagGoBool)
+		enc.bool(v)
+	case Int:
+		enc.buf.WriteByte(tagInt)
+		enc.varint(int64(v))
+	case Float:
+		enc.buf.WriteByte(tagFloat)
+		enc.uvarint(math.Float64bits(float64(v)))
+	case string:
+		enc.buf.WriteByte(tagString)
+		enc.string(v)
+	case Rune:
+		enc.buf.WriteByte(tagRune)
+		enc.varint(int64(v))
+	case Keyword:
+		enc.buf.WriteByte(tagKeyword)
+		enc.string(string(v))
+	case Atom:
+		enc.buf.WriteByte(tagAtom)
+		return enc.atom(v)
+	case Dict:
+		enc.buf.WriteByte(tagDict)
+		keys := make([]string, 0, len(v))
+		for key := range v {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		pairs := make([]interface{}, 0, 2*len(v))
+		for _, key := range keys {
+			pairs = append(pairs, key, v[key])
+		}
+		return enc.values(pairs)
+	case List:
+		enc.buf.WriteByte(tagList)
+		var span Span
+		var items []Span
+		if info := v.info(); info != nil {
+			span, items = info.span, info.items
+		}
+		enc.span(span)
+		enc.uvarint(uint64(len(items)))
+		for _, item := range items {
+			enc.span(item)
+		}
+		return enc.values(v)
+	case []interface{}:
+		enc.buf.WriteByte(tagSlice)
+		return enc.values(v)
+	case Quote:
+		enc.buf.WriteByte(tagQuote)
+		return enc.value(v.Lisp)
+	case QuasiQuote:
+		enc.buf.WriteByte(tagQuasiQuote)
+		return enc.value(v.Lisp)
+	case Unquote:
+		enc.buf.WriteByte(tagUnquote)
+		return enc.value(v.Lisp)
+	case UnquoteSplicing:
+		enc.buf.WriteByte(tagUnquoteSplicing)
+		return enc.value(v.Lisp)
+	case DotExpr:
+		enc.buf.WriteByte(tagDotExpr)
+		enc.string(v.Name)
+	case BracketExpr:
+		enc.buf.WriteByte(tagBracketExpr)
+		return enc.values(v.Expr)
+	case Dot:
+		enc.buf.WriteByte(tagDot)
+		enc.span(v.span)
+		if err := enc.atom(v.expr); err != nil {
+			return err
+		}
+		return enc.value(v.obj)
+	case *Chunk:
+		enc.buf.WriteByte(tagChunk)
+		return enc.chunk(v)
+	case Bracket:
+		enc.buf.WriteByte(tagBracket)
+		enc.span(v.span)
+		if err := enc.values(v.expr); err != nil {
+			return err
+		}
+		return enc.value(v.obj)
+	default:
+		return fmt.Errorf("bytecode error: can't marshal %v(%v)", x, reflect.TypeOf(x))
+	}
+	return nil
+}
+
+func (enc *chunkEncoder) bool(b bool) {
+	if b {
+		enc.buf.WriteByte(1)
+	} else {
+		enc.buf.WriteByte(0)
+	}
+}
+
+func (enc *chunkEncoder) atom(atom Atom) error {
+	enc.string(atom.Name)
+	enc.bool(atom.Type.Option())
+	return enc.typ(atom.Type.Type)
+}
+
+func (enc *chunkEncoder) typ(t reflect.Type) error {
+	if t == nil {
+		return fmt.Errorf("bytecode error: can't marshal nil type")
+	}
+	for idx, builtin := range codecTypes {
+		if t == builtin {
+			enc.buf.WriteByte(typeBuiltin)
+			enc.uvarint(uint64(idx))
+			return nil
+		}
+	}
+	switch t.Kind() {
+	case reflect.Slice:
+		enc.buf.WriteByte(typeSlice)
+		return enc.typ(t.Elem())
+	case reflect.Map:
+		enc.buf.WriteByte(typeMap)
+		if err := enc.typ(t.Key()); err != nil {
+			return err
+		}
+		return enc.typ(t.Elem())
+	}
+	return fmt.Errorf("bytecode error: can't marshal type %v", t)
+}
+
+type chunkDecoder struct {
+	data []byte
+	pos  int
+}
+
+func (dec *chunkDecoder) truncated() error {
+	return fmt.Errorf("bytecode error: unexpected end at %d", dec.pos)
+}
+
+func (dec *chunkDecoder) byte() (byte, error) {
+	if dec.pos >= len(dec.data) {
+		return 0, dec.truncated()
+	}
+	b := dec.data[dec.pos]
+	dec.pos++
+	return b, nil
+}
+
+func (dec *chunkDecoder) uvarint() (uint64, error) {
+	x, n := binary.Uvarint(dec.data[dec.pos:])
+	if n <= 0 {
+		return 0, dec.truncated()
+	}
+	dec.pos += n
+	return x, nil
+}
+
+func (dec *chunkDecoder) varint() (int64, error) {
+	x, n := binary.Varint(dec.data[dec.pos:])
+	if n <= 0 {
+		return 0, dec.truncated()
+	}
+	dec.pos += n
+	return x, nil
+}
+
+// length 读取一个长度，长度不会超过剩余的字节数
+func (dec *chunkDecoder) length() (int, error) {
+	l, err := dec.uvarint()
+	if err != nil {
+		return 0, err
+	}
+	if l > uint64(len(dec.data)-dec.pos) {
+		return 0, dec.truncated()
+	}
+	return int(l), nil
+}
+
+func (dec *chunkDecoder) string() (string, error) {
+	l, err := dec.length()
+	if err != nil {
+		return "", err
+	}
+	s := string(dec.data[dec.pos : dec.pos+l])
+	dec.pos += l
+	return s, nil
+}
+
+func (dec *chunkDecoder) bool() (bool, error) {
+	b, err := dec.byte()
+	return b != 0, err
+}
+
+func (dec *chunkDecoder) span() (Span, error) {
+	file, err := dec.string()
+	if err != nil {
+		return Span{}, err
+	}
+	line, err := dec.varint()
+	if err != nil {
+		return Span{}, err
+	}
+	column, err := dec.varint()
+	if err != nil {
+		return Span{}, err
+	}
+	return Span{file, int(line), int(column)}, nil
+}
+
+// chunk 读出 chunkEncoder.chunk 写出的字节码并检查它
+func (dec *chunkDecoder) chunk() (*Chunk, error) {
+	l, err := dec.length()
+	if err != nil {
+		return nil, err
+	}
+	ret := Chunk{Code: make([]Instr, l), Spans: make([]Span, l)}
+	for idx := range ret.Code {
+		op, err := dec.byte()
+		if err != nil {
+			return nil, err
+		}
+		a, err := dec.varint()
+		if err != nil {
+			return nil, err
+		}
+		b, err := dec.varint()
+		if err != nil {
+			return nil, err
+		}
+		ret.Code[idx] = Instr{Op(op), int(a), int(b)}
+		if ret.Spans[idx], err = dec.span(); err != nil {
+			return nil, err
+		}
+	}
+	if ret.Consts, err = dec.values(); err != nil {
+		return nil, err
+	}
+	if err := ret.verify(); err != nil {
+		return nil, err
+	}
+	return &ret, nil
+}
+
+func (dec *chunkDecoder) values() ([]interface{}, error) {
+	l, err := dec.length()
+	if err != nil {
+		return nil, err
+	}
+	items := make([]interface{}, l)
+	for idx := range items {
+		if items[idx], err = dec.value(); err != nil {
+			return nil, err
+		}
+	}
+	return items, nil
+}
+
+func (dec *chunkDecoder) value() (interface{}, error) {
+	tag, err := dec.byte()
+	if err != nil {
+		return nil, err
+	}
+	switch tag {
+	case tagNil:
+		return nil, nil
+	case tagBool:
+		b, err := dec.bool()
+		return Bool(b), err
+	case tagGoBool:
+		return dec.bool()
+	case tagInt:
+		i, err := dec.varint()
+		return Int(i), err
+	case tagFloat:
+		bits, err := dec.uvarint()
+		return Float(math.Float64frombits(bits)), err
+	case tagString:
+		return dec.string()
+	case tagRune:
+		r, err := dec.varint()
+		return Rune(r), err
+	case tagKeyword:
+		name, err := dec.string()
+		return Keyword(name), err
+	case tagAtom:
+		return dec.atom()
+	case tagDict:
+		pairs, err := dec.values()
+		if err != nil {
+			return nil, err
+		}
+		dict := make(Dict, len(pairs)/2)
+		for idx := 0; idx+1 < len(pairs); idx += 2 {
+			key, ok := pairs[idx].(string)
+			if !ok {
+				return nil, fmt.Errorf("bytecode error: expect a dict key but %v", pairs[idx])
+			}
+			dict[key] = pairs[idx+1]
+		}
+		return dict, nil
+	case tagList:
+		span, err := dec.span()
+		if err != nil {
+			return nil, err
+		}
+		l, err := dec.length()
+		if err != nil {
+			return nil, err
+		}
+		var spans []Span
+		if l > 0 {
+			spans = make([]Span, l)
+		}
+		for idx := range spans {
+			if spans[idx], err = dec.span(); err != nil {
+				return nil, err
+			}
+		}
+		items, err := dec.values()
+		if err != nil {
+			return nil, err
+		}
+		if !span.IsValid() {
+			return List(items), nil
+		}
+		return withInfo(List(items), &listInfo{span: span, items: spans}), nil
+	case tagSlice:
+		return dec.values()
+	case tagQuote, tagQuasiQuote, tagUnquote, tagUnquoteSplicing:
+		lisp, err := dec.value()
+		if err != nil {
+			return nil, err
+		}
+		switch tag {
+		case tagQuote:
+			return Quote{lisp}, nil
+		case tagQuasiQuote:
+			return QuasiQuote{lisp}, nil
+		case tagUnquote:
+			return Unquote{lisp}, nil
+		default:
+			return UnquoteSplicing{lisp}, nil
+		}
+	case tagDotExpr:
+		name, err := dec.string()
+		return DotExpr{name}, err
+	case tagBracketExpr:
+		expr, err := dec.values()
+		return BracketExpr{expr}, err
+	case tagDot:
+		span, err := dec.span()
+		if err != nil {
+			return nil, err
+		}
+		expr, err := dec.atom()
+		if err != nil {
+			return nil, err
+		}
+		obj, err := dec.value()
+		if err != nil {
+			return nil, err
+		}
+		return Dot{obj: obj, expr: expr, span: span}, nil
+	case tagChunk:
+		return dec.chunk()
+	case tagBracket:
+		span, err := dec.span()
+		if err != nil {
+			return nil, err
+		}
+		expr, err := dec.values()
+		if err != nil {
+			return nil, err
+		}
+		obj, err := dec.value()
+		if err != nil {
+			return nil, err
+		}
+		return Bracket{obj: obj, expr: expr, span: span}, nil
+	}
+	return nil, fmt.Errorf("bytecode error: unknown const tag %d at %d", tag, dec.pos-1)
+}
+
+func (dec *chunkDecoder) atom() (Atom, error) {
+	name, err := dec.string()
+	if err != nil {
+		return Atom{}, err
+	}
+	option, err := dec.bool()
+	if err != nil {
+		return Atom{}, err
+	}
+	t, err := dec.typ()
+	if err != nil {
+		return Atom{}, err
+	}
+	return Atom{name, Type{t, option}}, nil
+}
+
+func (dec *chunkDecoder) typ() (reflect.Type, error) {
+	kind, err := dec.byte()
+	if err != nil {
+		return nil, err
+	}
+	switch kind {
+	case typeBuiltin:
+		idx, err := dec.uvarint()
+		if err != nil {
+			return nil, err
+		}
+		if idx >= uint64(len(codecTypes)) {
+			return nil, fmt.Errorf("bytecode error: unknown type %d", idx)
+		}
+		return codecTypes[idx], nil
+	case typeSlice:
+		elem, err := dec.typ()
+		if err != nil {
+			return nil, err
+		}
+		return reflect.SliceOf(elem), nil
+	case typeMap:
+		key, err := dec.typ()
+		if err != nil {
+			return nil, err
+		}
+		elem, err := dec.typ()
+		if err != nil {
+			return nil, err
+		}
+		if !key.Comparable() {
+			return nil, fmt.Errorf("bytecode error: invalid map key type %v", key)
+		}
+		return reflect.MapOf(key, elem), nil
+	}
+	return nil, fmt.Errorf("bytecode error: unknown type kind %d", kind)
+}
@@ -0,0 +1,275 @@
+package gisp
+
+import (
+	"errors"
+	"flag"
+	"os"
+	"reflect"
+	"testing"
+)
+
+// go test 依次以解释器和字节码虚拟机运行全部测试， go test -args -gisp.engine=vm 只以
+// 其中一种运行
+var engineFlag = flag.String("gisp.engine", "all", "engine for NewGisp: interpreter, vm or all")
+
+func TestMain(m *testing.M) {
+	flag.Parse()
+	for _, engine := range []Engine{Interpreter, VM} {
+		if *engineFlag != "all" && *engineFlag != engine.String() {
+			continue
+		}
+		DefaultEngine = engine
+		if code := m.Run(); code != 0 {
+			os.Exit(code)
+		}
+	}
+	os.Exit(0)
+}
+
+func TestVMMatchInterpreter(t *testing.T) {
+	codes := []string{
+		"(+ 1 2 3)",
+		"(- (* 2 3.5) 1)",
+		"'(a (b c))",
+		"()",
+		"(let ((a 1) (b 2)) (+ a b))",
+		"((lambda (x y) (* x y)) 3 4)",
+		"((lambda (x ...) x) 1 2 3)",
+		"(defun fact (n) (* n 2)) (fact (fact 3))",
+		"(defmacro swap (f a b) `(,f ,b ,a)) (swap - 1 10)",
+		`(try (missing 1) (catch e (error-kind e)))`,
+		"(cond (((== 1 2) 1) ((== 1 1) 2)) 3)",
+		"(cond (((== 1 2) 1)) 3)",
+		"(cond (((== 1 2) 1)))",
+	}
+	for _, code := range codes {
+		interp := testGisp()
+		interp.SetEngine(Interpreter)
+		expect, err := interp.Parse(code)
+		if err != nil {
+			t.Fatalf("expect %s eval but error: %v", code, err)
+		}
+		g := testGisp()
+		g.SetEngine(VM)
+		ret, err := g.Parse(code)
+		if err != nil {
+			t.Fatalf("expect %s run on vm but error: %v", code, err)
+		}
+		if !reflect.DeepEqual(ret, expect) {
+			t.Fatalf("expect %s run on vm got %v but %v", code, expect, ret)
+		}
+	}
+}
+
+func TestVMCondJump(t *testing.T) {
+	g := testGisp()
+	g.SetEngine(VM)
+	forms, err := g.Read("(cond (((== x 1) \"one\") ((== x 2) \"two\")) \"many\")")
+	if err != nil {
+		t.Fatalf("expect read cond but error: %v", err)
+	}
+	chunk, err := CompileChunk(forms)
+	if err != nil {
+		t.Fatalf("expect compile cond but error: %v", err)
+	}
+	jumps := 0
+	for _, instr := range chunk.Code {
+		if instr.Op == OpJumpIfFalse {
+			jumps++
+		}
+	}
+	if jumps != 2 {
+		t.Fatalf("expect cond compiled to 2 conditional jumps but %v", chunk.Code)
+	}
+	for x, expect := range map[Int]string{1: "one", 2: "two", 3: "many"} {
+		env := g.Fork()
+		env.DefAs("x", x)
+		ret, err := chunk.Run(env)
+		if err != nil {
+			t.Fatalf("expect cond run with x=%d but error: %v", x, err)
+		}
+		if ret != expect {
+			t.Fatalf("expect cond with x=%d got %s but %v", x, expect, ret)
+		}
+	}
+	ret, err := g.Parse("(cond ((1 2)))")
+	if err != nil || ret != Int(2) {
+		t.Fatalf("expect cond with a truthy int test got 2 but %v, %v", ret, err)
+	}
+}
+
+func TestVMErrorSpan(t *testing.T) {
+	g := testGisp()
+	g.SetEngine(VM)
+	_, err := g.ParseSource("vm.gisp", "(defun f (x) (+ x (error \"boom\")))\n(f 1)")
+	var serr SourceError
+	if !errors.As(err, &serr) {
+		t.Fatalf("expect a SourceError but %v", err)
+	}
+	if serr.Span.String() != "vm.gisp:1:19" {
+		t.Fatalf("expect error at vm.gisp:1:19 but %v", serr.Span)
+	}
+	if !errors.Is(err, ErrUser) {
+		t.Fatalf("expect a user error but %v", err)
+	}
+}
+
+func TestChunkMarshal(t *testing.T) {
+	g := testGisp()
+	g.SetEngine(VM)
+	code := "(defun sq (x::int) (* x x)) (let ((a 3)) (sq a)) (cond (((== (sq 2) 4) '(ok (1 2)))) 'no)"
+	forms, err := g.ReadSource("m.gisp", code)
+	if err != nil {
+		t.Fatalf("expect read but error: %v", err)
+	}
+	chunk, err := CompileChunk(forms)
+	if err != nil {
+		t.Fatalf("expect compile but error: %v", err)
+	}
+	data, err := chunk.MarshalBinary()
+	if err != nil {
+		t.Fatalf("expect marshal chunk but error: %v", err)
+	}
+	loaded := &Chunk{}
+	if err := loaded.UnmarshalBinary(data); err != nil {
+		t.Fatalf("expect unmarshal chunk but error: %v", err)
+	}
+	if !reflect.DeepEqual(loaded.Spans, chunk.Spans) {
+		t.Fatalf("expect spans %v but %v", chunk.Spans, loaded.Spans)
+	}
+	expect, err := chunk.Run(testGisp())
+	if err != nil {
+		t.Fatalf("expect run chunk but error: %v", err)
+	}
+	ret, err := loaded.Run(testGisp())
+	if err != nil {
+		t.Fatalf("expect run loaded chunk but error: %v", err)
+	}
+	if !reflect.DeepEqual(ret, expect) {
+		t.Fatalf("expect loaded chunk got %v but %v", expect, ret)
+	}
+	if err := loaded.UnmarshalBinary(data[:len(data)/2]); err == nil {
+		t.Fatalf("expect truncated bytecode got error but nil")
+	}
+}
+
+func TestVMControlForms(t *testing.T) {
+	codes := []string{
+		"(let ((a 1) (b 2)) (let ((a 10)) (+ a b)))",
+		"(let (((a b) '(1 2))) (+ a b))",
+		"(defun f (x) (let ((x 10)) x)) (f 1)",
+		`(try (error "boom") (catch e (error-kind e)) (finally 1))`,
+		`(var log 0) (try (try (error "boom") (finally (set 'log 1))) (catch e log))`,
+		"(let ((f (lambda (x) (* x x)))) (f 3))",
+		"((lambda ((a b)) (* a b)) '(3 4))",
+		"((lambda (x &optional (y 2)) (+ x y)) 1)",
+		"((lambda (x) ((lambda (y) (+ x y)) 2)) 1)",
+		"(if (== 1 1) 'yes 'no)",
+		"(if nil 'yes)",
+		"(when 0 1 2)",
+		"(unless true 1)",
+		"(do (var a 1) (+ a 2))",
+		"(var n 0) (while (< n 5) (set 'n (+ n 1))) n",
+		"(var n 0) (while true (set 'n (+ n 1)) (if (== n 3) (break n)))",
+		"(var s 0) (dotimes (i 5) (if (== i 2) (continue)) (set 's (+ s i))) s",
+		"(var s 0) (for (k x '(3 4)) (set 's (+ s k x))) s",
+		"(dotimes (i 10) (try (when (== i 3) (break i)) (finally 0)))",
+		"(var f (lambda () 0)) (dotimes (i 3) (if (== i 1) (set 'f (lambda () i)))) (f)",
+	}
+	for _, code := range codes {
+		interp := testGisp()
+		interp.SetEngine(Interpreter)
+		expect, err := interp.Parse(code)
+		if err != nil {
+			t.Fatalf("expect %s eval but error: %v", code, err)
+		}
+		g := testGisp()
+		g.SetEngine(VM)
+		ret, err := g.Parse(code)
+		if err != nil {
+			t.Fatalf("expect %s run on vm but error: %v", code, err)
+		}
+		if !reflect.DeepEqual(ret, expect) {
+			t.Fatalf("expect %s run on vm got %v but %v", code, expect, ret)
+		}
+	}
+	forms, err := testGisp().Read("(dotimes (i 3) (let ((f i)) (try (f) (catch e (lambda () e)))))")
+	if err != nil {
+		t.Fatalf("expect read dotimes but error: %v", err)
+	}
+	chunk, err := CompileChunk(forms)
+	if err != nil {
+		t.Fatalf("expect compile dotimes but error: %v", err)
+	}
+	ops := map[Op]bool{}
+	for _, instr := range chunk.Code {
+		ops[instr.Op] = true
+	}
+	for _, op := range []Op{OpLoop, OpTry, OpLet, OpLambda} {
+		if !ops[op] {
+			t.Fatalf("expect dotimes compiled with %v but %v", op, chunk.Code)
+		}
+	}
+}
+
+func TestVMRedefinedForm(t *testing.T) {
+	g := testGisp()
+	g.SetEngine(VM)
+	g.DefAs("when", reflect.ValueOf(func(x, y Int) Int { return x + y }))
+	ret, err := g.Parse("(when 1 2)")
+	if err != nil || ret != Int(3) {
+		t.Fatalf("expect redefined when called as a function got 3 but %v, %v", ret, err)
+	}
+}
+
+func TestChunkVerify(t *testing.T) {
+	chunks := map[string]*Chunk{
+		"const type": {
+			Code:   []Instr{{OpLookup, 0, 0}},
+			Consts: []interface{}{Int(1)},
+		},
+		"underflow": {
+			Code: []Instr{{OpPop, 0, 0}},
+		},
+		"depth": {
+			Code:   []Instr{{OpConst, 0, 0}, {OpJumpIfFalse, 0, 3}, {OpConst, 0, 0}},
+			Consts: []interface{}{Int(1)},
+		},
+		"jump": {
+			Code: []Instr{{OpJump, 0, 5}},
+		},
+		"let": {
+			Code:   []Instr{{OpConst, 0, 0}, {OpLet, 1, 2}},
+			Consts: []interface{}{Int(1), List{AA("a"), AA("b")}},
+		},
+	}
+	for name, chunk := range chunks {
+		chunk.Spans = make([]Span, len(chunk.Code))
+		data, err := chunk.MarshalBinary()
+		if err != nil {
+			t.Fatalf("expect marshal %s chunk but error: %v", name, err)
+		}
+		if err := (&Chunk{}).UnmarshalBinary(data); err == nil {
+			t.Fatalf("expect unmarshal %s chunk got error but nil", name)
+		}
+	}
+	forms, err := testGisp().Read("(let ((f (lambda (x) (* x x)))) (f 3))")
+	if err != nil {
+		t.Fatalf("expect read lambda but error: %v", err)
+	}
+	chunk, err := CompileChunk(forms)
+	if err != nil {
+		t.Fatalf("expect compile lambda but error: %v", err)
+	}
+	data, err := chunk.MarshalBinary()
+	if err != nil {
+		t.Fatalf("expect marshal lambda chunk but error: %v", err)
+	}
+	loaded := &Chunk{}
+	if err := loaded.UnmarshalBinary(data); err != nil {
+		t.Fatalf("expect unmarshal lambda chunk but error: %v", err)
+	}
+	if ret, err := loaded.Run(testGisp()); err != nil || ret != Int(9) {
+		t.Fatalf("expect loaded lambda chunk got 9 but %v, %v", ret, err)
+	}
+}
@@ -1,6 +1,7 @@
 package gisp
 
 import (
+	"context"
 	"reflect"
 
 	p "github.com/Dwarfartisan/goparsec2"
@@ -47,6 +48,34 @@ func (ch *Chan) Recv() (x interface{}, ok bool) {
 	return nil, ok
 }
 
+// SendContext 方法实现 chan x <- v ，在 ctx 结束前无法写入时返回 ContextError
+func (ch *Chan) SendContext(ctx context.Context, x interface{}) error {
+	cases := []reflect.SelectCase{
+		{Dir: reflect.SelectSend, Chan: ch.value, Send: reflect.ValueOf(x)},
+		{Dir: reflect.SelectRecv, Chan: reflect.ValueOf(ctx.Done())},
+	}
+	if chosen, _, _ := reflect.Select(cases); chosen == 1 {
+		return ContextError{ctx.Err()}
+	}
+	return nil
+}
+
+// RecvContext 方法实现 v <- chan x ，在 ctx 结束前没有收到数据时返回 ContextError
+func (ch *Chan) RecvContext(ctx context.Context) (x interface{}, ok bool, err error) {
+	cases := []reflect.SelectCase{
+		{Dir: reflect.SelectRecv, Chan: ch.value},
+		{Dir: reflect.SelectRecv, Chan: reflect.ValueOf(ctx.Done())},
+	}
+	chosen, val, ok := reflect.Select(cases)
+	if chosen == 1 {
+		return nil, false, ContextError{ctx.Err()}
+	}
+	if val.IsValid() {
+		return val.Interface(), ok, nil
+	}
+	return nil, ok, nil
+}
+
 // TrySend 实现试写入（带状态返回）
 func (ch *Chan) TrySend(x interface{}) {
 	ch.value.TrySend(reflect.ValueOf(x))
@@ -98,8 +127,7 @@ var channel = Toolkit{
 			func(args ...interface{}) Tasker {
 				return func(env Env) (interface{}, error) {
 					ch := args[0].(*Chan)
-					ch.Send(args[1])
-					return nil, nil
+					return nil, ch.SendContext(ContextOf(env), args[1])
 				}
 			}},
 		"send?": SimpleBox{
@@ -113,19 +141,23 @@ var channel = Toolkit{
 					return nil, nil
 				}
 			}},
+		// recv 和 recv? 接受可选的第二个参数，它不参与读取，只为兼容已有的脚本而保留
 		"recv": SimpleBox{
 			SignChecker(TypeAs(reflect.TypeOf((*Chan)(nil))).
-				Then(p.Choice(p.Try(TypeAs(ANYOPTION)), TypeAs(ANYMUST)).Then(p.EOF))),
+				Then(p.Choice(p.Try(p.EOF), p.P(p.One).Then(p.EOF)))),
 			func(args ...interface{}) Tasker {
 				return func(env Env) (interface{}, error) {
 					ch := args[0].(*Chan)
-					data, ok := ch.Recv()
+					data, ok, err := ch.RecvContext(ContextOf(env))
+					if err != nil {
+						return nil, err
+					}
 					return List{data, ok}, nil
 				}
 			}},
 		"recv?": SimpleBox{
 			SignChecker(TypeAs(reflect.TypeOf((*Chan)(nil))).
-				Then(p.Choice(p.Try(TypeAs(ANYOPTION)), TypeAs(ANYMUST))).Then(p.EOF)),
+				Then(p.Choice(p.Try(p.EOF), p.P(p.One).Then(p.EOF)))),
 			func(args ...interface{}) Tasker {
 				return func(env Env) (interface{}, error) {
 					ch := args[0].(*Chan)
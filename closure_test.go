@@ -0,0 +1,115 @@
+package gisp
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestClosureCounter(t *testing.T) {
+	g := testGisp()
+	_, err := g.Parse(`
+	(defun make-counter (n)
+		(lambda () (set 'n (+ n 1)) n))
+	(var c (make-counter 0))
+	(var d (make-counter 10))`)
+	if err != nil {
+		t.Fatalf("expect make counters but error: %v", err)
+	}
+	for _, expect := range []Int{1, 2, 3} {
+		ret, err := g.Parse("(c)")
+		if err != nil || ret != expect {
+			t.Fatalf("expect (c) got %v but %v, %v", expect, ret, err)
+		}
+	}
+	ret, err := g.Parse("(d)")
+	if err != nil || ret != Int(11) {
+		t.Fatalf("expect (d) got 11 but %v, %v", ret, err)
+	}
+}
+
+func TestClosureSharedState(t *testing.T) {
+	g := testGisp()
+	_, err := g.Parse(`
+	(var add)
+	(var get)
+	(let ((total 0))
+		(set 'add (lambda (x) (set 'total (+ total x)) total))
+		(set 'get (lambda () total)))`)
+	if err != nil {
+		t.Fatalf("expect make accumulator but error: %v", err)
+	}
+	_, err = g.Parse("(add 3) (add 4)")
+	if err != nil {
+		t.Fatalf("expect add to accumulator but error: %v", err)
+	}
+	ret, err := g.Parse("(get)")
+	if err != nil || ret != Int(7) {
+		t.Fatalf("expect (get) got 7 but %v, %v", ret, err)
+	}
+}
+
+func TestClosureSeesLaterSet(t *testing.T) {
+	g := testGisp()
+	_, err := g.Parse(`
+	(var x 1)
+	(defun show () x)
+	(set 'x 2)`)
+	if err != nil {
+		t.Fatalf("expect define show but error: %v", err)
+	}
+	ret, err := g.Parse("(show)")
+	if err != nil || ret != Int(2) {
+		t.Fatalf("expect (show) got 2 but %v, %v", ret, err)
+	}
+}
+
+func TestClosureLexicalScope(t *testing.T) {
+	g := testGisp()
+	_, err := g.Parse(`
+	(var x "global")
+	(defun show () x)
+	(defun call-show (x) (show))
+	(defun make-adder (x) (let ((y 1)) (lambda (z) (+ x y z))))`)
+	if err != nil {
+		t.Fatalf("expect define functions but error: %v", err)
+	}
+	ret, err := g.Parse(`(call-show "local")`)
+	if err != nil || ret != "global" {
+		t.Fatalf("expect show see the x where it defined got global but %v, %v", ret, err)
+	}
+	ret, err = g.Parse(`(let ((x 100)) ((make-adder 10) 5))`)
+	if err != nil || ret != Int(16) {
+		t.Fatalf("expect adder got 16 but %v, %v", ret, err)
+	}
+}
+
+func TestClosureInGinq(t *testing.T) {
+	g := NewGispWith(
+		map[string]Toolbox{"axiom": Axiom, "props": Propositions, "utils": Utils, "control": Control},
+		map[string]Toolbox{"time": Time})
+	g.DefAs("data", L(L(0, 10), L(1, 11), L(2, 12), L(3, 13)))
+	_, err := g.Parse(`
+	(var above)
+	(var picked)
+	(let ((limit 1))
+		(set 'above (ginq (where (lambda (r) (< limit r[0]))) (select [1]))))
+	(dotimes (i 3)
+		(when (== i 2)
+			(set 'picked (ginq (where (lambda (r) (== r[0] i))) (select [1])))))`)
+	if err != nil {
+		t.Fatalf("expect build queries in let and dotimes but error: %v", err)
+	}
+	cases := map[string]interface{}{
+		"(above data)":  L(Int(12), Int(13)),
+		"(picked data)": L(Int(12)),
+	}
+	for code, expect := range cases {
+		ret, err := g.Parse(code)
+		if err != nil {
+			t.Fatalf("expect %s after its scope exited but error: %v", code, err)
+		}
+		if !reflect.DeepEqual(ret, expect) {
+			t.Fatalf("expect %s got %v but %v", code, expect, ret)
+		}
+	}
+}
@@ -0,0 +1,115 @@
+package gisp
+
+import (
+	"fmt"
+
+	p "github.com/Dwarfartisan/goparsec2"
+)
+
+// CommentParser 解析一段注释。 gisp 支持三种注释：
+//
+//	; line          行注释，到行尾为止
+//	#| block |#     块注释，可以嵌套
+//	#; datum        表达式注释，忽略紧跟其后的一个完整表达式
+//
+// 注释和空白一样由 Skip 跳过
+func CommentParser(st p.State) (interface{}, error) {
+	return p.Choice(
+		p.Try(lineComment),
+		p.Try(blockComment),
+		datumComment,
+	)(st)
+}
+
+// skipBlank 跳过空白和注释。没有结束的块注释直接报错，不能留给后面的解析器当作
+// atom 读入
+func skipBlank(st p.State) (interface{}, error) {
+	for {
+		if _, err := p.Choice(p.Try(p.Space), p.Try(CommentParser))(st); err == nil {
+			continue
+		}
+		pos := st.Pos()
+		if _, err := p.Str("#|")(st); err == nil {
+			st.SeekTo(pos)
+			return blockComment(st)
+		}
+		return nil, nil
+	}
+}
+
+func lineComment(st p.State) (interface{}, error) {
+	return p.Chr(';').Then(p.Skip(p.NChr('\n')))(st)
+}
+
+// beforeComment 在 #| 和 #; 之前失败，否则执行 parser 。记号遇到注释就结束
+func beforeComment(parser p.P) p.P {
+	return func(st p.State) (interface{}, error) {
+		pos := st.Pos()
+		if _, err := p.Choice(p.Str("#|"), p.Str("#;"))(st); err == nil {
+			st.SeekTo(pos)
+			return nil, st.Trap("expect token but comment")
+		}
+		return parser(st)
+	}
+}
+
+func blockComment(st p.State) (interface{}, error) {
+	pos := st.Pos()
+	if _, err := p.Str("#|")(st); err != nil {
+		return nil, err
+	}
+	for {
+		if _, err := p.Try(p.Str("|#"))(st); err == nil {
+			return nil, nil
+		}
+		if _, err := p.Try(blockComment)(st); err == nil {
+			continue
+		}
+		if _, err := st.Next(); err != nil {
+			return nil, faultAt(st, pos, fmt.Errorf("block comment error: expect |# but %v", err))
+		}
+	}
+}
+
+func datumComment(st p.State) (interface{}, error) {
+	if _, err := p.Str("#;")(st); err != nil {
+		return nil, err
+	}
+	if _, err := skipBlank(st); err != nil {
+		return nil, err
+	}
+	return skipDatum(st)
+}
+
+// skipDatum 按词法跳过一个完整的表达式。它不构造语法节点，也不需要扩展环境，所以
+// ValueParser 和 ValueParserExt 能读的表达式都可以被注释掉
+func skipDatum(st p.State) (interface{}, error) {
+	return p.Choice(
+		p.Try(StringParser),
+		p.Try(RuneParser),
+		skipGroup('(', ')'),
+		skipGroup('[', ']'),
+		skipGroup('{', '}'),
+		p.RuneOf("'`,").Then(skipDatum),
+		p.Many1(beforeComment(p.RuneNone("'`,[](){} \t\r\n\";"))),
+	)(st)
+}
+
+func skipGroup(open, close rune) p.P {
+	return func(st p.State) (interface{}, error) {
+		if _, err := p.Chr(open)(st); err != nil {
+			return nil, err
+		}
+		for {
+			if _, err := skipBlank(st); err != nil {
+				return nil, err
+			}
+			if _, err := p.Try(p.Chr(close))(st); err == nil {
+				return nil, nil
+			}
+			if _, err := skipDatum(st); err != nil {
+				return nil, err
+			}
+		}
+	}
+}
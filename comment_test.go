@@ -0,0 +1,73 @@
+package gisp
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	p "github.com/Dwarfartisan/goparsec2"
+)
+
+func TestCommentSkip(t *testing.T) {
+	g := testGisp()
+	g.DefAs("entry", map[string]interface{}{"meta": "meta data"})
+	cases := map[string]interface{}{
+		"; leading\n(+ 1 2) ; trailing":                   Int(3),
+		"(+ 1 ; one\n 2 ; two\n)":                         Int(3),
+		"(+ 1 #| block\n comment |# 2)":                   Int(3),
+		"(+ 1 #| outer #| nested |# still outer |# 2)":    Int(3),
+		"(+ 1 #;(error \"skipped\") 2)":                   Int(3),
+		"(+ 1 #; 100 2)":                                  Int(3),
+		"(+ 1 #;'(a [b] {c} \"d)\") 2)":                   Int(3),
+		"(let ((x::int 1);typed\n) x)":                    Int(1),
+		"(let ((x 1)) x;atom\n)":                          Int(1),
+		"entry[ ; key\n \"meta\" #| end |# ]":             "meta data",
+		"#| only a comment |#\n ; and a line\n #;(error)": nil,
+		"((lambda (x::int#|c|#) x) 3)":                    Int(3),
+		"(let ((x 1)) (+ x#|c|# 1))":                      Int(2),
+		"(let ((x 1)) (+ x#;y 1))":                        Int(2),
+	}
+	for code, expect := range cases {
+		ret, err := g.Parse(code)
+		if err != nil {
+			t.Fatalf("expect %q got %v but error: %v", code, expect, err)
+		}
+		if !reflect.DeepEqual(ret, expect) {
+			t.Fatalf("expect %q got %v but %v", code, expect, ret)
+		}
+	}
+	for _, code := range []string{"(+ 1 #| open 2)", "(+ 1 #;)"} {
+		if _, err := g.Parse(code); err == nil {
+			t.Fatalf("expect %q got parse error but nil", code)
+		}
+	}
+	for code, pos := range map[string]string{"(+ 1 #| open 2)": "1:6", "#| open": "1:1", "(x#| open)": "1:3"} {
+		_, err := g.Parse(code)
+		if err == nil || !strings.Contains(err.Error(), pos+": block comment error") {
+			t.Fatalf("expect %q got block comment error at %s but %v", code, pos, err)
+		}
+	}
+}
+
+func TestCommentRead(t *testing.T) {
+	g := testGisp()
+	forms, err := g.Read(`
+	;; rules
+	(var a 1) #;(var b 2)
+	#| (var c 3) |#
+	(var d 4) ; done`)
+	if err != nil {
+		t.Fatalf("expect read forms with comments but error: %v", err)
+	}
+	if len(forms) != 2 {
+		t.Fatalf("expect read 2 forms but %v", forms)
+	}
+	st := p.BasicStateFromText("(a#|x|# ; b\n #;[c] #| d |# e#;f)")
+	list, err := ValueParser()(&st)
+	if err != nil {
+		t.Fatalf("expect parse list with comments but error: %v", err)
+	}
+	if !reflect.DeepEqual(list, List{Atom{"a", ANYMUST}, Atom{"e", ANYMUST}}) {
+		t.Fatalf("expect (a e) but %v", list)
+	}
+}
@@ -0,0 +1,521 @@
+package gisp
+
+import (
+	"fmt"
+	"reflect"
+)
+
+// Program 是 Compile 得到的一组顶层表达式，可以在不同的环境中多次 Run 。 Program 编译后
+// 不再修改，多个 goroutine 可以共享同一个 Program ，各自在 Fork 出的环境中运行
+type Program struct {
+	forms []interface{}
+	codes []Tasker
+	bound map[string]interface{}
+}
+
+// Compile 以 env 为编译环境，把 Read 得到的顶层表达式编译为 Program ， Program 在 env 或者
+// 它 Fork 出的环境中运行。编译时检查每个命名都已经定义，特殊形式的结构不正确或者命名找不到
+// 时返回带有源码位置的错误，与 lambda 声明时的检查相同。
+//
+// 调用的头部在编译时分类： builtins 中的定义直接绑定到编译结果中，运行时不再查找，正在
+// 求值的 Gisp 重新定义了这个命名时改为按命名查找；局部变量和 env 中用户定义的函数可能被
+// Fork 出的环境重载，它们仍然在运行时查找。绑定到 builtins 的 cond 和 let 编译为直接执行
+// 分支、变量值和函数体的代码。 lambda 和 defun 函数体中对形参的引用在编译时解析为参数的
+// 位置，运行时直接读取 Task 中对应的实参。编译后的 List 是原 List 的副本，闭包
+// 保存在 List 的附加信息中，它们作为 lambda 、 let 等特殊形式的参数被求值，或者处于尾位置
+// 时同样执行编译后的代码。 quote 和 quasiquote 中的数据不编译
+func Compile(env Env, forms []interface{}) (*Program, error) {
+	c := compiler{
+		env:     env,
+		defined: map[string]bool{},
+		bound:   map[string]interface{}{},
+	}
+	for _, form := range forms {
+		if name, ok := topName(form); ok {
+			c.defined[name] = true
+		}
+	}
+	prog := Program{
+		forms: make([]interface{}, len(forms)),
+		codes: make([]Tasker, len(forms)),
+		bound: c.bound,
+	}
+	declared := map[string]bool{}
+	for idx, form := range forms {
+		if err := checkNames(env, declared, form); err != nil {
+			return nil, err
+		}
+		// 顶层定义的命名对其后的表达式可见
+		if name, ok := topName(form); ok {
+			declared[name] = true
+		}
+		prog.forms[idx], prog.codes[idx] = c.compile(form, declared, nil)
+	}
+	return &prog, nil
+}
+
+// topName 给出顶层的 var 、 defun 、 defmacro 定义的命名
+func topName(form interface{}) (string, bool) {
+	if clauseIs(form, "var") || clauseIs(form, "defun") || clauseIs(form, "defmacro") {
+		if list := form.(List); len(list) > 1 {
+			if name, ok := list[1].(Atom); ok {
+				return name.Name, true
+			}
+		}
+	}
+	return "", false
+}
+
+// Forms 返回编译后的顶层表达式，它们也可以直接交给 Gisp.Eval ，这时 builtins 的绑定同样
+// 让位于正在求值的 Gisp 中的定义
+func (prog *Program) Forms() []interface{} {
+	return prog.forms
+}
+
+// Run 在 env 中依次执行 Program 的顶层表达式，返回最后一个表达式的值。 env 是 Gisp 时，
+// 与 Gisp.Eval 一样使用它的 Limits ；编译时绑定的 builtins 在 env 中被重新定义时返回错误
+func (prog *Program) Run(env Env) (interface{}, error) {
+	if gisp, ok := env.(*Gisp); ok {
+		for name := range prog.bound {
+			if _, ok := gisp.slot(name); ok {
+				return nil, fmt.Errorf("program error: %s is bound to builtin when compile but redefined in env", name)
+			}
+		}
+		return gisp.withEval(func() (interface{}, error) {
+			return prog.run(gisp)
+		})
+	}
+	return prog.run(env)
+}
+
+func (prog *Program) run(env Env) (interface{}, error) {
+	var ret interface{}
+	for _, code := range prog.codes {
+		var err error
+		ret, err = code(env)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return ret, nil
+}
+
+// compiler 保存编译 Program 时的环境， defined 是 Program 顶层定义的命名， bound 记录编译时
+// 绑定的 builtins
+type compiler struct {
+	env     Env
+	defined map[string]bool
+	bound   map[string]interface{}
+}
+
+// compile 返回编译后的表达式和它的求值代码， declared 是 form 中可见的局部命名， params 是
+// 最内层的 lambda 的形参位置
+func (c *compiler) compile(form interface{}, declared map[string]bool, params map[string]int) (interface{}, Tasker) {
+	switch lisp := form.(type) {
+	case List:
+		if len(lisp) == 0 || clauseIs(lisp, "quote") {
+			return lisp, lisp.Eval
+		}
+		next, err := scopeOf(declared, lisp)
+		if err != nil {
+			return lisp, lisp.Eval
+		}
+		if formals, ok := lambdaFormals(lisp); ok {
+			params = formalSlots(formals)
+		}
+		fun := c.callee(lisp[0], next)
+		var list List
+		var code Tasker
+		var tail tailTasker
+		targets, values, isBinding := letBindings(lisp[1:])
+		if branches, els, err := condBranches(lisp[1:]); err == nil && isCond(fun) {
+			list, code, tail = c.compileCond(lisp, branches, els, next, params)
+		} else if isBinding && isLet(fun) && atomsOnly(targets) {
+			list, code, tail = c.compileLet(lisp, targets, values, next, params)
+		} else {
+			list = make(List, len(lisp))
+			codes := make([]Tasker, len(lisp))
+			for idx, item := range lisp {
+				list[idx], codes[idx] = c.compile(item, next, params)
+				if idx > 0 && isEager(fun) && compiled(item, params) {
+					list[idx] = compiledArg{list[idx], codes[idx]}
+				}
+			}
+			code, tail = compileCall(lisp, list, codes, fun)
+		}
+		info := &listInfo{code: code, tail: tail}
+		if source := lisp.info(); source != nil {
+			info.span, info.items = source.span, source.items
+		}
+		list = withInfo(list, info)
+		step := func(env Env) (interface{}, error) {
+			if err := evalStep(env); err != nil {
+				return nil, err
+			}
+			return code(env)
+		}
+		return list, func(env Env) (interface{}, error) {
+			return list.evalWith(env, step)
+		}
+	case Atom:
+		if idx, ok := params[lisp.Name]; ok {
+			return lisp, func(env Env) (interface{}, error) {
+				return paramValue(env, lisp, idx)
+			}
+		}
+		return lisp, lisp.Eval
+	case Quote:
+		value := lisp.Lisp
+		return lisp, func(env Env) (interface{}, error) {
+			return value, nil
+		}
+	case Lisp:
+		return lisp, lisp.Eval
+	default:
+		value := Value(lisp)
+		return lisp, func(env Env) (interface{}, error) {
+			return value, nil
+		}
+	}
+}
+
+// callee 在编译时解析调用的头部。头部是 builtins 中的命名，并且没有被局部命名、 Program 的
+// 顶层定义或者编译环境中的定义遮蔽时，返回它绑定的对象，否则返回 nil ，由运行时查找
+func (c *compiler) callee(head interface{}, declared map[string]bool) interface{} {
+	atom, ok := head.(Atom)
+	if !ok || declared[atom.Name] || c.defined[atom.Name] {
+		return nil
+	}
+	gisp, ok := c.env.(*Gisp)
+	if !ok {
+		return nil
+	}
+	if _, ok := gisp.slot(atom.Name); ok {
+		return nil
+	}
+	fun, ok := gisp.Global(atom.Name)
+	if !ok {
+		return nil
+	}
+	c.bound[atom.Name] = fun
+	return fun
+}
+
+// lambdaFormals 给出 lambda 和 defun 形式的形参表
+func lambdaFormals(list List) (List, bool) {
+	switch {
+	case clauseIs(list, "lambda") && len(list) > 1:
+		formals, ok := list[1].(List)
+		return formals, ok
+	case clauseIs(list, "defun") && len(list) > 2:
+		formals, ok := list[2].(List)
+		return formals, ok
+	}
+	return nil, false
+}
+
+// formalSlots 给出形参表中每个形参在 Task 实参中的位置，形参表不正确时返回 nil
+func formalSlots(formals List) map[string]int {
+	probe := Lambda{map[string]interface{}{}, List{}}
+	if probe.prepareArgs(formals) != nil {
+		return nil
+	}
+	slots := map[string]int{}
+	for idx, formal := range probe.Meta["formal parameters"].(List) {
+		slots[formal.(Atom).Name] = idx
+	}
+	return slots
+}
+
+// compileCall 生成调用 list 的代码以及在尾位置上调用它的代码， source 是编译前的形式，
+// fun 是编译时绑定的头部，为 nil 时在运行时求出头部。 Function 、 Lambda 和 Go 函数先对
+// 实参求值，这时直接执行编译好的参数代码； ParsecExpr 、 ExtExpr 构造的运算自己对实参求值，
+// 它们的实参在 list 中已经换成 compiledArg ；其它可调用对象（特殊形式）仍然接收未求值的
+// 参数，它们能在尾位置上求值时按尾调用执行。 fun 在运行时被重新定义时按 source 解释执行
+func compileCall(source, list List, codes []Tasker, fun interface{}) (Tasker, tailTasker) {
+	argCodes := codes[1:]
+	invoke := func(env Env, fun interface{}, tail bool) (interface{}, *tailCall, error) {
+		if isStrict(fun) {
+			args := make([]interface{}, len(argCodes))
+			for idx, code := range argCodes {
+				value, err := code(env)
+				if err != nil {
+					return nil, nil, err
+				}
+				args[idx] = value
+			}
+			if tail {
+				return tailStrict(env, fun, args)
+			}
+			value, err := callStrict(env, fun, args)
+			return value, nil, err
+		}
+		if form, ok := fun.(tailForm); ok && tail {
+			return form.evalTail(env, list[1:]...)
+		}
+		value, err := list.call(env, fun)
+		return value, nil, err
+	}
+	var call func(env Env, tail bool) (interface{}, *tailCall, error)
+	switch head := list[0].(type) {
+	case Atom:
+		name := head.Name
+		call = func(env Env, tail bool) (interface{}, *tailCall, error) {
+			if fun != nil {
+				if !rebound(env, name) {
+					return invoke(env, fun, tail)
+				}
+				return dynamic(env, source, tail)
+			}
+			fun, ok := env.Lookup(name)
+			if !ok {
+				return nil, nil, NameError{name}
+			}
+			return invoke(env, fun, tail)
+		}
+	case List:
+		call = func(env Env, tail bool) (interface{}, *tailCall, error) {
+			fun, err := codes[0](env)
+			if err != nil {
+				return nil, nil, err
+			}
+			return invoke(env, fun, tail)
+		}
+	default:
+		call = func(env Env, tail bool) (interface{}, *tailCall, error) {
+			fun, err := list.callee(env)
+			if err != nil {
+				return nil, nil, err
+			}
+			return invoke(env, fun, tail)
+		}
+	}
+	code := func(env Env) (interface{}, error) {
+		value, _, err := call(env, false)
+		return value, err
+	}
+	tail := func(env Env) (interface{}, *tailCall, error) {
+		return call(env, true)
+	}
+	return code, tail
+}
+
+// compileCond 把编译时绑定到 builtins 的 cond 编译为依次执行 test 的代码，选中的分支在尾
+// 位置上按尾调用执行。 cond 在运行时被重新定义时按 lisp 解释执行
+func (c *compiler) compileCond(lisp List, branches []List, els interface{},
+	declared map[string]bool, params map[string]int) (List, Tasker, tailTasker) {
+	cases := make(List, len(branches))
+	tests := make([]Tasker, len(branches))
+	exprs := make([]interface{}, len(branches), len(branches)+1)
+	codes := make([]Tasker, len(branches), len(branches)+1)
+	for idx, branch := range branches {
+		test, testCode := c.compile(branch[0], declared, params)
+		expr, exprCode := c.compile(branch[1], declared, params)
+		cases[idx] = relocated(List{test, expr}, branch)
+		tests[idx], exprs[idx], codes[idx] = testCode, expr, exprCode
+	}
+	list := List{lisp[0], relocated(cases, lisp[1].(List))}
+	if len(lisp) == 3 {
+		expr, exprCode := c.compile(els, declared, params)
+		list = append(list, expr)
+		exprs, codes = append(exprs, expr), append(codes, exprCode)
+	}
+	name := lisp[0].(Atom).Name
+	choose := func(env Env) (int, error) {
+		for idx, test := range tests {
+			result, err := test(env)
+			if err != nil {
+				return 0, err
+			}
+			if Truthy(result) {
+				return idx, nil
+			}
+		}
+		return len(tests), nil
+	}
+	code := func(env Env) (interface{}, error) {
+		if rebound(env, name) {
+			value, _, err := dynamic(env, lisp, false)
+			return value, err
+		}
+		idx, err := choose(env)
+		if err != nil || idx == len(codes) {
+			return nil, err
+		}
+		return codes[idx](env)
+	}
+	tail := func(env Env) (interface{}, *tailCall, error) {
+		if rebound(env, name) {
+			return dynamic(env, lisp, true)
+		}
+		idx, err := choose(env)
+		if err != nil || idx == len(codes) {
+			return nil, nil, err
+		}
+		if expr, ok := exprs[idx].(List); ok {
+			return expr.evalTail(env)
+		}
+		value, err := codes[idx](env)
+		return value, nil, err
+	}
+	return list, code, tail
+}
+
+// compileLet 把编译时绑定到 builtins 、变量都是 Atom 的 let 编译为先执行值的代码，再在
+// let 作用域中执行函数体的代码，最后一个表达式在尾位置上按尾调用执行。 let 在运行时被重新
+// 定义时按 lisp 解释执行
+func (c *compiler) compileLet(lisp List, targets List, values []interface{},
+	declared map[string]bool, params map[string]int) (List, Tasker, tailTasker) {
+	source := lisp[1].(List)
+	defs := make(List, len(targets))
+	valueCodes := make([]Tasker, len(values))
+	for idx, value := range values {
+		var expr interface{}
+		expr, valueCodes[idx] = c.compile(value, declared, params)
+		defs[idx] = relocated(List{targets[idx], expr}, source[idx].(List))
+	}
+	list := List{lisp[0], relocated(defs, source)}
+	body := make([]interface{}, len(lisp)-2)
+	codes := make([]Tasker, len(body))
+	for idx, expr := range lisp[2:] {
+		body[idx], codes[idx] = c.compile(expr, declared, params)
+	}
+	list = append(list, body...)
+	name := lisp[0].(Atom).Name
+	tail := func(env Env) (interface{}, *tailCall, error) {
+		if rebound(env, name) {
+			return dynamic(env, lisp, true)
+		}
+		data := make([]interface{}, len(valueCodes))
+		for idx, code := range valueCodes {
+			value, err := code(env)
+			if err != nil {
+				return nil, nil, err
+			}
+			data[idx] = value
+		}
+		let, err := letScope(env, targets, data)
+		if err != nil {
+			return nil, nil, err
+		}
+		if len(codes) == 0 {
+			return nil, nil, nil
+		}
+		for _, code := range codes[:len(codes)-1] {
+			if _, err := code(let); err != nil {
+				return nil, nil, err
+			}
+		}
+		if expr, ok := body[len(body)-1].(List); ok {
+			return expr.evalTail(let)
+		}
+		value, err := codes[len(codes)-1](let)
+		return value, nil, err
+	}
+	code := func(env Env) (interface{}, error) {
+		value, call, err := tail(env)
+		if err != nil {
+			return nil, err
+		}
+		if call != nil {
+			return call.eval()
+		}
+		return value, nil
+	}
+	return list, code, tail
+}
+
+// relocated 返回带有 source 位置信息的 list 副本，编译时重建的 List 据此报告源码中的位置
+func relocated(list, source List) List {
+	if info := source.info(); info != nil {
+		return withInfo(list, &listInfo{span: info.span, items: info.items})
+	}
+	return list
+}
+
+// isLet 判断编译时绑定的 callee 是否是 let
+func isLet(callee interface{}) bool {
+	_, ok := callee.(letForm)
+	return ok
+}
+
+// atomsOnly 判断 let 的变量是否都是 Atom ，模式变量仍然由解释器绑定
+func atomsOnly(targets List) bool {
+	for _, target := range targets {
+		if _, ok := target.(Atom); !ok {
+			return false
+		}
+	}
+	return true
+}
+
+// isCond 判断编译时绑定的 callee 是否是 cond
+func isCond(callee interface{}) bool {
+	_, ok := callee.(condForm)
+	return ok
+}
+
+// dynamic 按解释器的方式在运行时求出 source 的头部并调用它
+func dynamic(env Env, source List, tail bool) (interface{}, *tailCall, error) {
+	callee, err := source.callee(env)
+	if err != nil {
+		return nil, nil, err
+	}
+	if tail {
+		return source.callTail(env, callee)
+	}
+	value, err := source.call(env, callee)
+	return value, nil, err
+}
+
+// compiled 判断 form 编译后是否有比 Eval 更直接的代码，即 List 和解析到位置的形参
+func compiled(form interface{}, params map[string]int) bool {
+	switch lisp := form.(type) {
+	case List:
+		return len(lisp) > 0
+	case Atom:
+		_, ok := params[lisp.Name]
+		return ok
+	default:
+		return false
+	}
+}
+
+// compiledArg 是自己对实参求值的运算中编译好的实参，求值时直接执行 code ，打印为 form
+type compiledArg struct {
+	form interface{}
+	code Tasker
+}
+
+// Eval 实现 Lisp
+func (arg compiledArg) Eval(env Env) (interface{}, error) {
+	return arg.code(env)
+}
+
+// String 实现 fmt.Stringer
+func (arg compiledArg) String() string {
+	return fmt.Sprint(arg.form)
+}
+
+// rebound 判断编译时绑定到 builtins 的 name 是否在正在求值的 Gisp 中被重新定义
+func rebound(env Env, name string) bool {
+	gisp, ok := ContextOf(env).Value(gispKey{}).(*Gisp)
+	if !ok {
+		return false
+	}
+	_, ok = gisp.slot(name)
+	return ok
+}
+
+// eagerExprs 是先对全部实参求值再计算的 LispExpr 构造函数，以闭包的代码位置识别它们构造的
+// 运算，例如 + 、 - 、 <
+var eagerExprs = map[uintptr]bool{
+	reflect.ValueOf(ParsecExpr(nil)).Pointer(): true,
+	reflect.ValueOf(ExtExpr(nil)).Pointer():    true,
+}
+
+// isEager 判断 callee 是否是 eagerExprs 构造的运算
+func isEager(callee interface{}) bool {
+	box, ok := callee.(EvalBox)
+	return ok && eagerExprs[reflect.ValueOf(box.functor).Pointer()]
+}
@@ -0,0 +1,251 @@
+package gisp
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestCompileMatchEval(t *testing.T) {
+	codes := []string{
+		"(+ 1 2 3)",
+		"(- (* 2 3.5) 1)",
+		"'(a (b c))",
+		"(let ((a 1) (b 2)) (+ a b))",
+		"((lambda (x y) (* x y)) 3 4)",
+		"(defun fact (n) (* n 2)) (fact (fact 3))",
+		"(defmacro swap (f a b) `(,f ,b ,a)) (swap - 1 10)",
+		`(try (error "boom") (catch e (error-kind e)))`,
+		"(half (half 12))",
+		"(defun f (x y) (let ((x 10)) (+ x y))) (f 1 2)",
+		"(defun g (x) (cond (((< x 0) 0) ((< x 10) (+ x 1))) (- x 1))) (+ (g -1) (g 5) (g 20))",
+		"((lambda (n) ((lambda (m) (+ n m)) 2)) 1)",
+		"(defun down (x) (cond (((< x 1) x)) (down (- x 1)))) (down 1000)",
+		"(let ((a 1)) (let ((a 2) (b a)) (+ a b)))",
+	}
+	for _, code := range codes {
+		interp := testGisp()
+		interp.DefAs("half", reflect.ValueOf(func(x Int) Int { return x / 2 }))
+		expect, err := interp.Parse(code)
+		if err != nil {
+			t.Fatalf("expect %s eval but error: %v", code, err)
+		}
+		g := testGisp()
+		g.DefAs("half", reflect.ValueOf(func(x Int) Int { return x / 2 }))
+		forms, err := g.Read(code)
+		if err != nil {
+			t.Fatalf("expect read %s but error: %v", code, err)
+		}
+		prog, err := Compile(g, forms)
+		if err != nil {
+			t.Fatalf("expect compile %s but error: %v", code, err)
+		}
+		ret, err := prog.Run(g)
+		if err != nil {
+			t.Fatalf("expect run %s but error: %v", code, err)
+		}
+		if !reflect.DeepEqual(ret, expect) {
+			t.Fatalf("expect program %s got %v as eval but %v", code, expect, ret)
+		}
+	}
+}
+
+func TestCompileRunMany(t *testing.T) {
+	base := testGisp()
+	base.SetLimits(Limits{MaxSteps: 50})
+	forms, err := base.ReadSource("price.lisp", `
+	(defun price (qty unit)
+	    (* qty unit))
+	(price qty 2.5)`)
+	if err != nil {
+		t.Fatalf("expect read price.lisp but error: %v", err)
+	}
+	_, err = Compile(base, forms)
+	expectSpan(t, err, Span{"price.lisp", 4, 9})
+	if !errors.Is(err, ErrName) {
+		t.Fatalf("expect compile error qty not found but %v", err)
+	}
+	base.DefAs("qty", Float(0))
+	prog, err := Compile(base, forms)
+	if err != nil {
+		t.Fatalf("expect compile price.lisp but error: %v", err)
+	}
+	for idx := 1; idx <= 3; idx++ {
+		g := base.Fork()
+		g.Setvar("qty", Float(idx))
+		ret, err := prog.Run(g)
+		if err != nil || ret != Float(2.5*float64(idx)) {
+			t.Fatalf("expect price %v but %v, %v", 2.5*float64(idx), ret, err)
+		}
+	}
+	g := base.Fork()
+	_, err = g.Parse("(defun forever (n) (forever n))")
+	if err != nil {
+		t.Fatalf("expect defun forever but error: %v", err)
+	}
+	loop, err := Compile(g, []interface{}{L(AA("forever"), Int(1))})
+	if err != nil {
+		t.Fatalf("expect compile (forever 1) but error: %v", err)
+	}
+	_, err = loop.Run(g)
+	expectLimit(t, err, "max steps")
+}
+
+func TestCompileErrors(t *testing.T) {
+	g := testGisp()
+	codes := map[string]Span{
+		"(+ 1\n  (lambda (x) (* x y)))": {"bad.lisp", 2, 20},
+		"(let x 1)":                     {"bad.lisp", 1, 1},
+		"(+ 1\n  (defun))":              {"bad.lisp", 2, 3},
+	}
+	for code, span := range codes {
+		forms, err := g.ReadSource("bad.lisp", code)
+		if err != nil {
+			t.Fatalf("expect read %s but error: %v", code, err)
+		}
+		_, err = Compile(g, forms)
+		expectSpan(t, err, span)
+	}
+	forms, err := g.Read("(var total 1) (defun add (x) (+ x total)) (add 2)")
+	if err != nil {
+		t.Fatalf("expect read program but error: %v", err)
+	}
+	if _, err := Compile(g, forms); err != nil {
+		t.Fatalf("expect names defined by the program are known but error: %v", err)
+	}
+}
+
+func TestCompileBoundBuiltin(t *testing.T) {
+	base := testGisp()
+	forms, err := base.Read("(+ 1 2)")
+	if err != nil {
+		t.Fatalf("expect read (+ 1 2) but error: %v", err)
+	}
+	prog, err := Compile(base, forms)
+	if err != nil {
+		t.Fatalf("expect compile (+ 1 2) but error: %v", err)
+	}
+	fork := base.Fork()
+	if ret, err := prog.Run(fork); err != nil || ret != Int(3) {
+		t.Fatalf("expect run (+ 1 2) got 3 but %v, %v", ret, err)
+	}
+	if _, err := fork.Parse("(defun + (x y) 0)"); err != nil {
+		t.Fatalf("expect defun + in fork but error: %v", err)
+	}
+	if _, err := prog.Run(fork); err == nil {
+		t.Fatalf("expect run failed as + is redefined after compile")
+	}
+	if ret, err := fork.Eval(prog.Forms()...); err != nil || ret != Int(0) {
+		t.Fatalf("expect eval forms of (+ 1 2) got 0 from the fork but %v, %v", ret, err)
+	}
+	if ret, err := base.Eval(prog.Forms()...); err != nil || ret != Int(3) {
+		t.Fatalf("expect eval forms of (+ 1 2) got 3 from base but %v, %v", ret, err)
+	}
+}
+
+func TestCompileBoundSpecialForm(t *testing.T) {
+	base := testGisp()
+	forms, err := base.Read("(cond ((true 1)) 2) (let ((a 1)) a)")
+	if err != nil {
+		t.Fatalf("expect read cond and let but error: %v", err)
+	}
+	prog, err := Compile(base, forms)
+	if err != nil {
+		t.Fatalf("expect compile cond and let but error: %v", err)
+	}
+	fork := base.Fork()
+	if _, err := fork.Parse("(defmacro cond (a b) b) (defmacro let (a b) 3)"); err != nil {
+		t.Fatalf("expect defmacro cond and let in fork but error: %v", err)
+	}
+	for idx, expect := range []interface{}{Int(2), Int(3)} {
+		if ret, err := fork.Eval(prog.Forms()[idx]); err != nil || ret != expect {
+			t.Fatalf("expect eval %v got %v from the fork but %v, %v", forms[idx], expect, ret, err)
+		}
+	}
+	for idx, expect := range []interface{}{Int(1), Int(1)} {
+		if ret, err := base.Eval(prog.Forms()[idx]); err != nil || ret != expect {
+			t.Fatalf("expect eval %v got %v from base but %v, %v", forms[idx], expect, ret, err)
+		}
+	}
+}
+
+func benchmarkFib(b *testing.B, compiled bool) {
+	g := testGisp()
+	def := "(defun fib (n) (cond (((< n 2) n)) (+ (fib (- n 1)) (fib (- n 2)))))"
+	forms, err := g.Read(def + " (fib 15)")
+	if err != nil {
+		b.Fatalf("expect read fib but error: %v", err)
+	}
+	run := func() (interface{}, error) {
+		return g.Eval(forms[1])
+	}
+	if compiled {
+		prog, err := Compile(g, forms)
+		if err != nil {
+			b.Fatalf("expect compile fib but error: %v", err)
+		}
+		if _, err := g.Eval(prog.Forms()[0]); err != nil {
+			b.Fatalf("expect defun fib but error: %v", err)
+		}
+		call, err := Compile(g, forms[1:])
+		if err != nil {
+			b.Fatalf("expect compile (fib 15) but error: %v", err)
+		}
+		run = func() (interface{}, error) {
+			return call.Run(g)
+		}
+	} else if _, err := g.Eval(forms[0]); err != nil {
+		b.Fatalf("expect defun fib but error: %v", err)
+	}
+	b.ResetTimer()
+	for idx := 0; idx < b.N; idx++ {
+		if ret, err := run(); err != nil || ret != Int(610) {
+			b.Fatalf("expect (fib 15) got 610 but %v, %v", ret, err)
+		}
+	}
+}
+
+func BenchmarkEvalFib(b *testing.B) {
+	benchmarkFib(b, false)
+}
+
+func BenchmarkProgramFib(b *testing.B) {
+	benchmarkFib(b, true)
+}
+
+func benchmarkFormula(b *testing.B, compiled bool) {
+	g := testGisp()
+	g.DefAs("qty", Float(3))
+	g.DefAs("unit", Float(2.5))
+	forms, err := g.Read("(let ((price (* qty unit))) (+ price (* price 0.1)))")
+	if err != nil {
+		b.Fatalf("expect read formula but error: %v", err)
+	}
+	run := func() (interface{}, error) {
+		return g.Eval(forms...)
+	}
+	if compiled {
+		prog, err := Compile(g, forms)
+		if err != nil {
+			b.Fatalf("expect compile formula but error: %v", err)
+		}
+		run = func() (interface{}, error) {
+			return prog.Run(g)
+		}
+	}
+	b.ReportAllocs()
+	b.ResetTimer()
+	for idx := 0; idx < b.N; idx++ {
+		if ret, err := run(); err != nil || ret != Float(8.25) {
+			b.Fatalf("expect formula got 8.25 but %v, %v", ret, err)
+		}
+	}
+}
+
+func BenchmarkEvalFormula(b *testing.B) {
+	benchmarkFormula(b, false)
+}
+
+func BenchmarkProgramFormula(b *testing.B) {
+	benchmarkFormula(b, true)
+}
@@ -0,0 +1,49 @@
+package gisp
+
+import (
+	"context"
+	"fmt"
+)
+
+// ContextError 表示求值因为 context 被取消或者超时而中止，Err 是 context 给出的原因
+type ContextError struct {
+	Err error
+}
+
+func (err ContextError) Error() string {
+	return fmt.Sprintf("eval aborted: %v", err.Err)
+}
+
+// Unwrap 允许用 errors.Is 判断 context.Canceled 或 context.DeadlineExceeded
+func (err ContextError) Unwrap() error {
+	return err.Err
+}
+
+// Contexter 是能够给出求值 context 的环境。Gisp 保存调用者传入的 context ，Task 、 Let 、
+// GinQ 在求值时从外层环境继承它
+type Contexter interface {
+	Context() context.Context
+}
+
+// ContextOf 给出环境的求值 context ，没有绑定 context 的环境返回 context.Background()
+func ContextOf(env Env) context.Context {
+	if c, ok := env.(Contexter); ok {
+		return c.Context()
+	}
+	return context.Background()
+}
+
+// CheckContext 在环境的 context 已经结束时返回 ContextError
+func CheckContext(env Env) error {
+	if err := ContextOf(env).Err(); err != nil {
+		return ContextError{err}
+	}
+	return nil
+}
+
+func metaContext(meta map[string]interface{}) context.Context {
+	if ctx, ok := meta["context"].(context.Context); ok {
+		return ctx
+	}
+	return context.Background()
+}
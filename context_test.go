@@ -0,0 +1,86 @@
+package gisp
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestParseContextCanceled(t *testing.T) {
+	g := NewGisp(map[string]Toolbox{
+		"axioms": Axiom,
+		"props":  Propositions,
+	})
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err := g.ParseContext(ctx, "(+ 1 2)")
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("expect eval aborted by canceled context but %v", err)
+	}
+	var cerr ContextError
+	if !errors.As(err, &cerr) {
+		t.Fatalf("expect a ContextError but %v", err)
+	}
+	ret, err := g.Parse("(+ 1 2)")
+	if err != nil || ret != Int(3) {
+		t.Fatalf("expect context unbound after ParseContext but got %v, %v", ret, err)
+	}
+}
+
+func TestParseContextDeadline(t *testing.T) {
+	g := NewGisp(map[string]Toolbox{
+		"axioms": Axiom,
+		"props":  Propositions,
+	})
+	_, err := g.Parse("(defun forever (n) (forever n))")
+	if err != nil {
+		t.Fatalf("expect defun forever but error: %v", err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	_, err = g.ParseContext(ctx, "(forever 1)")
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expect eval aborted by deadline but %v", err)
+	}
+}
+
+func TestRecvContext(t *testing.T) {
+	g := NewGisp(map[string]Toolbox{
+		"axioms":  Axiom,
+		"props":   Propositions,
+		"channel": channel,
+	})
+	g.DefAs("ch", MakeBothChan(reflect.TypeOf((chan interface{})(nil)), 0))
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	_, err := g.ParseContext(ctx, "(recv ch)")
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expect blocking recv aborted by deadline but %v", err)
+	}
+}
+
+func TestRecvOptionalArg(t *testing.T) {
+	g := NewGisp(map[string]Toolbox{
+		"axioms":  Axiom,
+		"props":   Propositions,
+		"channel": channel,
+	})
+	ch := MakeBothChan(reflect.TypeOf((chan interface{})(nil)), 2)
+	ch.Send(Int(1))
+	ch.Send(Int(2))
+	g.DefAs("ch", ch)
+	for _, code := range []string{"(recv ch)", "(recv? ch nil)"} {
+		ret, err := g.Parse(code)
+		if err != nil {
+			t.Fatalf("expect %s got a value but error: %v", code, err)
+		}
+		if l, ok := ret.(List); !ok || len(l) != 2 || l[1] != true {
+			t.Fatalf("expect %s got (value true) but %v", code, ret)
+		}
+	}
+	if _, err := g.Parse("(recv ch 1 2)"); err == nil {
+		t.Fatalf("expect recv with 3 args got sign error but nil")
+	}
+}
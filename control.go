@@ -0,0 +1,159 @@
+package gisp
+
+import (
+	"fmt"
+)
+
+// Control 给出一组惰性求值的控制形式和循环。它们的参数不预先求值，只对选中的分支求值，
+// 最后一个被求值的表达式处于尾位置（ and 、 or 、 not 的结果是 Bool ，没有尾位置）。
+// 真假按 Truthy 判断， cond 也使用同样的规则
+var Control = Toolkit{
+	Meta: map[string]interface{}{
+		"name":     "control",
+		"category": "package",
+	},
+	Content: map[string]interface{}{
+		"if":     controlForm{"if", ifBody},
+		"when":   controlForm{"when", whenBody("when", true)},
+		"unless": controlForm{"unless", whenBody("unless", false)},
+		"and":    controlForm{"and", andBody},
+		"or":     controlForm{"or", orBody},
+		"not":    controlForm{"not", notBody},
+		"do":     controlForm{"do", doBody},
+		"begin":  controlForm{"begin", doBody},
+
+		"while":    controlForm{"while", whileBody},
+		"dotimes":  controlForm{"dotimes", dotimesBody},
+		"for":      controlForm{"for", forBody},
+		"break":    controlForm{"break", breakBody},
+		"continue": controlForm{"continue", continueBody},
+		"match":    matchForm{},
+	},
+}
+
+// Truthy 给出 value 作为条件时的真假： nil 、 false （ bool 或 Bool ）为假，其它值都为真
+func Truthy(value interface{}) bool {
+	switch v := value.(type) {
+	case nil:
+		return false
+	case bool:
+		return v
+	case Bool:
+		return bool(v)
+	}
+	return true
+}
+
+// controlForm 实现控制形式。 body 按形式的规则对部分参数求值，给出还需要依次求值的表达式，
+// 没有需要求值的表达式时直接给出结果。 name 是形式在 Control 中的命名，字节码据此识别它
+type controlForm struct {
+	name string
+	body func(env Env, args []interface{}) ([]interface{}, interface{}, error)
+}
+
+// Task 实现 Functor ，参数推迟到 TaskBox 执行时才求值
+func (form controlForm) Task(env Env, args ...interface{}) (Lisp, error) {
+	return TaskBox{func(env Env) (interface{}, error) {
+		forms, value, err := form.body(env, args)
+		if err != nil {
+			return nil, err
+		}
+		for _, expr := range forms {
+			if value, err = Eval(env, expr); err != nil {
+				return nil, err
+			}
+		}
+		return value, nil
+	}}, nil
+}
+
+// evalTail 在尾位置上对控制形式求值，最后一个表达式中的 Lambda 调用作为尾调用返回
+func (form controlForm) evalTail(env Env, args ...interface{}) (interface{}, *tailCall, error) {
+	forms, value, err := form.body(env, args)
+	if err != nil || len(forms) == 0 {
+		return value, nil, err
+	}
+	last := len(forms) - 1
+	for _, expr := range forms[:last] {
+		if _, err := Eval(env, expr); err != nil {
+			return nil, nil, err
+		}
+	}
+	return evalTail(env, forms[last])
+}
+
+// ifBody 实现 (if test then else) ，没有 else 时条件为假返回 nil
+func ifBody(env Env, args []interface{}) ([]interface{}, interface{}, error) {
+	if len(args) < 2 || len(args) > 3 {
+		return nil, nil, fmt.Errorf("if args error: expect (if test then else) but %v", args)
+	}
+	test, err := Eval(env, args[0])
+	if err != nil {
+		return nil, nil, err
+	}
+	if Truthy(test) {
+		return args[1:2], nil, nil
+	}
+	return args[2:], nil, nil
+}
+
+// whenBody 实现 (when test body...) 和 (unless test body...) ，条件为 expect 时依次对
+// body 求值，返回最后一个表达式的值，否则返回 nil
+func whenBody(name string, expect bool) func(env Env, args []interface{}) ([]interface{}, interface{}, error) {
+	return func(env Env, args []interface{}) ([]interface{}, interface{}, error) {
+		if len(args) < 1 {
+			return nil, nil, fmt.Errorf("%s args error: expect (%s test body...) but %v", name, name, args)
+		}
+		test, err := Eval(env, args[0])
+		if err != nil {
+			return nil, nil, err
+		}
+		if Truthy(test) == expect {
+			return args[1:], nil, nil
+		}
+		return nil, nil, nil
+	}
+}
+
+// andBody 实现 (and expr...) ，依次求值直到遇到假值。 and 、 or 和 not 一样总是返回 Bool ，
+// 所有表达式都为真（包括没有参数）时返回 true
+func andBody(env Env, args []interface{}) ([]interface{}, interface{}, error) {
+	return logic(env, args, false)
+}
+
+// orBody 实现 (or expr...) ，依次求值直到遇到真值，返回 Bool ，所有表达式都为假（包括没有
+// 参数）时返回 false
+func orBody(env Env, args []interface{}) ([]interface{}, interface{}, error) {
+	return logic(env, args, true)
+}
+
+// logic 依次对 args 求值，遇到真假为 stop 的值时停止并返回 stop ，否则返回 !stop
+func logic(env Env, args []interface{}, stop bool) ([]interface{}, interface{}, error) {
+	for _, arg := range args {
+		value, err := Eval(env, arg)
+		if err != nil {
+			return nil, nil, err
+		}
+		if Truthy(value) == stop {
+			return nil, Bool(stop), nil
+		}
+	}
+	return nil, Bool(!stop), nil
+}
+
+// notBody 实现 (not expr) ，返回 Bool
+func notBody(env Env, args []interface{}) ([]interface{}, interface{}, error) {
+	if len(args) != 1 {
+		return nil, nil, fmt.Errorf("not args error: expect (not expr) but %v", args)
+	}
+	value, err := Eval(env, args[0])
+	if err != nil {
+		return nil, nil, err
+	}
+	return nil, Bool(!Truthy(value)), nil
+}
+
+// doBody 实现 (do body...) ，在当前环境中依次求值，返回最后一个表达式的值
+func doBody(env Env, args []interface{}) ([]interface{}, interface{}, error) {
+	return args, nil, nil
+}
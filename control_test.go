@@ -0,0 +1,84 @@
+package gisp
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestControlForms(t *testing.T) {
+	g := testGisp()
+	g.DefAs("yes", reflect.ValueOf(func() bool { return true }))
+	cases := map[string]interface{}{
+		"(if true 1 2)":               Int(1),
+		"(if false 1 2)":              Int(2),
+		"(if nil 1 2)":                Int(2),
+		"(if 0 1 2)":                  Int(1),
+		"(if (yes) 1 2)":              Int(1),
+		"(if false 1)":                nil,
+		"(when (== 1 1) 1 2)":         Int(2),
+		"(when false 1)":              nil,
+		"(unless false 1 2)":          Int(2),
+		"(unless 1 2)":                nil,
+		"(and)":                       Bool(true),
+		"(and 1 2 3)":                 Bool(true),
+		"(and 1 nil 3)":               Bool(false),
+		"(or)":                        Bool(false),
+		"(or nil false 3)":            Bool(true),
+		"(or nil false)":              Bool(false),
+		"(cond ((nil 1) (2 3)))":      Int(3),
+		"(not nil)":                   Bool(true),
+		"(not 0)":                     Bool(false),
+		"(do 1 2 3)":                  Int(3),
+		"(begin (var x 1) (+ x 1))":   Int(2),
+		"(do)":                        nil,
+		`(if "" "string is true" "")`: "string is true",
+	}
+	for code, expect := range cases {
+		ret, err := g.Parse(code)
+		if err != nil {
+			t.Fatalf("expect %s got %v but error: %v", code, expect, err)
+		}
+		if !reflect.DeepEqual(ret, expect) {
+			t.Fatalf("expect %s got %v but %v", code, expect, ret)
+		}
+	}
+}
+
+func TestControlLazy(t *testing.T) {
+	g := testGisp()
+	codes := []string{
+		`(if true 1 (error "else"))`,
+		`(if false (error "then") 2)`,
+		`(when false (error "body"))`,
+		`(unless true (error "body"))`,
+		`(and false (error "and"))`,
+		`(or 1 (error "or"))`,
+	}
+	for _, code := range codes {
+		if _, err := g.Parse(code); err != nil {
+			t.Fatalf("expect %s skip the unselected expression but error: %v", code, err)
+		}
+	}
+	for _, code := range []string{"(if true)", "(if 1 2 3 4)", "(when)", "(not 1 2)"} {
+		if _, err := g.Parse(code); err == nil {
+			t.Fatalf("expect %s got args error but nil", code)
+		}
+	}
+}
+
+func TestControlTailCall(t *testing.T) {
+	g := testGisp()
+	g.SetLimits(Limits{MaxDepth: 10})
+	_, err := g.Parse(`
+	(defun loop (n acc)
+		(if (and (< 0 n) (not false))
+			(do (- n 1) (loop (- n 1) (+ acc 1)))
+			acc))`)
+	if err != nil {
+		t.Fatalf("expect defun loop but error: %v", err)
+	}
+	ret, err := g.Parse("(loop 10000 0)")
+	if err != nil || ret != Int(10000) {
+		t.Fatalf("expect (loop 10000 0) within depth 10 got 10000 but %v, %v", ret, err)
+	}
+}
@@ -0,0 +1,110 @@
+package gisp
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestLetDestructure(t *testing.T) {
+	cases := map[string]interface{}{
+		"(let (((x y) '(1 2))) (+ x y))":                   Int(3),
+		"(let (((x (y z)) '(1 (2 3))) (w 4)) (+ x y z w))": Int(10),
+		"(let (((head tail ...) '(1 2 3))) tail)":          List{Int(2), Int(3)},
+		`(let (((dict "name" n "age" a) rec)) n)`:          "gisp",
+		"(let (((_ b) '(1 2))) b)":                         Int(2),
+		`(let (((x::int y::string) '(1 "a"))) y)`:          "a",
+		"(let (((struct money Amount a) cash)) a)":         Float(9),
+	}
+	for code, expect := range cases {
+		g := testGisp()
+		g.DefAs("money", reflect.TypeOf(money{}))
+		g.DefAs("rec", Dict{"name": "gisp", "age": 2})
+		g.DefAs("cash", money{Float(9), "CNY"})
+		ret, err := g.Parse(code)
+		if err != nil {
+			t.Fatalf("expect %s got %v but error: %v", code, expect, err)
+		}
+		if !reflect.DeepEqual(ret, expect) {
+			t.Fatalf("expect %s got %v but %v", code, expect, ret)
+		}
+	}
+	g := testGisp()
+	for _, code := range []string{"(let (((x y) '(1 2 3))) x)", `(let (((x::int y) '("a" 2))) x)`} {
+		if _, err := g.Parse(code); err == nil {
+			t.Fatalf("expect %s got pattern error but nil", code)
+		}
+	}
+	for _, code := range []string{"(let (x) x)", "(let ((x)) x)", "(let ((x 1 2)) x)"} {
+		if _, err := g.Parse(code); err == nil {
+			t.Fatalf("expect %s got let args error but nil", code)
+		}
+	}
+}
+
+func TestLetFuncDestructure(t *testing.T) {
+	g := testGisp()
+	let, err := LetFunc(g, L(L(L(AA("x"), AA("y")), QL(Int(1), Int(2)))), L(AA("+"), AA("x"), AA("y")))
+	if err != nil {
+		t.Fatalf("expect LetFunc with a pattern but error: %v", err)
+	}
+	ret, err := let.Eval(g)
+	if err != nil || ret != Int(3) {
+		t.Fatalf("expect let got 3 but %v, %v", ret, err)
+	}
+	if _, err := LetFunc(g, L(AA("x")), AA("x")); err == nil {
+		t.Fatalf("expect LetFunc with a bad binding got error but nil")
+	}
+}
+
+func TestLambdaDestructure(t *testing.T) {
+	g := testGisp()
+	_, err := g.Parse(`
+	(defun dist ((x1 y1) (x2 y2)) (+ (* (- x2 x1) (- x2 x1)) (* (- y2 y1) (- y2 y1))))
+	(defun total ((dict "price" p "count" c) tax) (+ (* p c) tax))`)
+	if err != nil {
+		t.Fatalf("expect defun with patterns but error: %v", err)
+	}
+	ret, err := g.Parse("(dist '(0 0) '(3 4))")
+	if err != nil || ret != Int(25) {
+		t.Fatalf("expect dist got 25 but %v, %v", ret, err)
+	}
+	g.DefAs("order", Dict{"price": Int(3), "count": Int(4)})
+	ret, err = g.Parse("(total order 1)")
+	if err != nil || ret != Int(13) {
+		t.Fatalf("expect total got 13 but %v, %v", ret, err)
+	}
+	ret, err = g.Parse("((lambda ((k v::int)) (+ v 1)) '(a 1))")
+	if err != nil || ret != Int(2) {
+		t.Fatalf("expect lambda row got 2 but %v, %v", ret, err)
+	}
+	_, err = g.Parse("(dist '(0 0 0) '(3 4))")
+	if err == nil {
+		t.Fatalf("expect dist a 3d point got sign error but nil")
+	}
+	_, err = g.Parse("((lambda ((k v::int)) v) '(a \"1\"))")
+	if err == nil {
+		t.Fatalf("expect a string leaf got sign error but nil")
+	}
+	_, err = g.Parse("(lambda ((a b) ...) a)")
+	if err == nil {
+		t.Fatalf("expect variadic pattern parameter got error but nil")
+	}
+}
+
+func TestGinqDestructure(t *testing.T) {
+	g := NewGispWith(
+		map[string]Toolbox{"axiom": Axiom, "props": Propositions, "utils": Utils},
+		map[string]Toolbox{"time": Time})
+	data := QL(L(0, 1, 2), L(1, 2, 3), L(2, 3, 4))
+	ginq, err := g.Parse(`(ginq (where (lambda ((k v rest ...)) (< 0 k))))`)
+	if err != nil {
+		t.Fatalf("expect got a ginq query but error %v ", err)
+	}
+	re, err := g.Eval(L(ginq, data))
+	if err != nil {
+		t.Fatalf("expect where with a pattern lambda but error: %v", err)
+	}
+	if !reflect.DeepEqual(re, L(L(1, 2, 3), L(2, 3, 4))) {
+		t.Fatalf("expect rows with key above 0 but %v", re)
+	}
+}
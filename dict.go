@@ -1,4 +1,28 @@
 package gisp
 
-// Dict 封装一个 map[string]interface{} 定义作为 Gisp 默认的字典类型
+import (
+	"fmt"
+	"sort"
+)
+
+// Dict 封装一个 map[string]interface{} 定义作为 Gisp 默认的字典类型。源码中的
+// {"key" value ...} 被解析为 Dict ，它的值是未求值的表达式
 type Dict map[string]interface{}
+
+// Eval 按键的顺序对每个值求值，给出一个新的 map[string]interface{} ，可以用 ::dict 标注
+func (dict Dict) Eval(env Env) (interface{}, error) {
+	keys := make([]string, 0, len(dict))
+	for key := range dict {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	ret := make(map[string]interface{}, len(dict))
+	for _, key := range keys {
+		value, err := Eval(env, dict[key])
+		if err != nil {
+			return nil, fmt.Errorf("dict error: eval value of %q failed: %w", key, err)
+		}
+		ret[key] = value
+	}
+	return ret, nil
+}
@@ -0,0 +1,129 @@
+package gisp
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+
+	p "github.com/Dwarfartisan/goparsec2"
+)
+
+func TestDictParse(t *testing.T) {
+	st := p.BasicStateFromText(`{"a" 1 :b (+ x 1) "c" {"d" nil}}`)
+	dict, err := ValueParser()(&st)
+	if err != nil {
+		t.Fatalf("expect parse dict literal but error: %v", err)
+	}
+	d, ok := dict.(Dict)
+	if !ok || len(d) != 3 || d["a"] != Int(1) {
+		t.Fatalf("expect a Dict has a b c but %v", dict)
+	}
+	if _, ok := d["b"].(List); !ok {
+		t.Fatalf("expect value of b is a unevaluated list but %v", d["b"])
+	}
+	for _, code := range []string{`{"a"}`, `{"a" 1 "a" 2}`, `{a 1}`, `{1 2}`, `{"a" 1`} {
+		st := p.BasicStateFromText(code)
+		if d, err := BraceParser()(&st); err == nil {
+			t.Fatalf("expect %s got dict literal error but %v", code, d)
+		}
+	}
+}
+
+func TestDictEval(t *testing.T) {
+	g := testGisp()
+	g.DefAs("x", Int(2))
+	cases := map[string]interface{}{
+		"{}":                                  map[string]interface{}{},
+		`{"a" 1 :b (+ x 1)}`:                  map[string]interface{}{"a": Int(1), "b": Int(3)},
+		`{"n" {"m" x}}`:                       map[string]interface{}{"n": map[string]interface{}{"m": Int(2)}},
+		`{"a" 1 "b" 2}["b"]`:                  Int(2),
+		`(var k "a") {"a" x}[k]`:              Int(2),
+		`{:name "gisp"}[:name]`:               "gisp",
+		`(var d::dict {"a" 1}) d`:             map[string]interface{}{"a": Int(1)},
+		`(var e {}) (set 'e["a"] 1) e["a"]`:   Int(1),
+		`(let ((d {"a" '(1 2)})) d["a"])`:     List{Int(1), Int(2)},
+		`((lambda (d::dict) d["a"]) {"a" 1})`: Int(1),
+		`((lambda (v) {"v" v}) 5)`:            map[string]interface{}{"v": Int(5)},
+		`'{"a" 2}`:                            Dict{"a": Int(2)},
+	}
+	for code, expect := range cases {
+		ret, err := g.Parse(code)
+		if err != nil {
+			t.Fatalf("expect %s got %v but error: %v", code, expect, err)
+		}
+		if !reflect.DeepEqual(ret, expect) {
+			t.Fatalf("expect %s got %v but %v", code, expect, ret)
+		}
+	}
+	if _, err := g.Parse(`((lambda (n::int) n) {"a" 1})`); err == nil {
+		t.Fatalf("expect dict literal can't be a int but nil")
+	}
+	if _, err := g.Parse(`{"a" 1}[1]`); err == nil {
+		t.Fatalf("expect a int key for dict got error but nil")
+	}
+	if _, err := g.Parse(`{"a" missing}`); !errors.Is(err, ErrName) {
+		t.Fatalf("expect dict value error wraps a name error but %v", err)
+	}
+	if _, err := g.Parse(`(lambda (v) {"v" missing})`); !errors.Is(err, ErrName) {
+		t.Fatalf("expect lambda declare check names in dict literal but %v", err)
+	}
+	if _, err := g.Parse(`(lambda (v) (match v ({"v" w} {"w" w})))`); err != nil {
+		t.Fatalf("expect names bound by dict pattern in a dict literal but error: %v", err)
+	}
+	errs := map[string]string{
+		`{"a"}`:                     `1:2: dict literal error: missing value for key "a"`,
+		`'{"a"}`:                    `1:3: dict literal error: missing value for key "a"`,
+		"(list\n  {\"a\" 1 \"b\"})": `2:10: dict literal error: missing value for key "b"`,
+		`{"a" 1`:                    `1:7: dict literal error: expect } but eof`,
+	}
+	for code, expect := range errs {
+		if _, err := g.Parse(code); err == nil || err.Error() != expect {
+			t.Fatalf("expect %q got %s but %v", code, expect, err)
+		}
+	}
+}
+
+func TestDictPattern(t *testing.T) {
+	g := testGisp()
+	cases := map[string]interface{}{
+		`(match {"a" 1 "b" 2} ({"a" x "b" y} (+ x y)))`:        Int(3),
+		`(match {"a" 1} ({"b" _} 'b) ({:a 1} 'a))`:             Atom{"a", ANYMUST},
+		`(let (({"n" n} {"n" 5})) n)`:                          Int(5),
+		`((lambda ({"x" x} &optional (y 1)) (+ x y)) {"x" 2})`: Int(3),
+	}
+	for code, expect := range cases {
+		ret, err := g.Parse(code)
+		if err != nil {
+			t.Fatalf("expect %s got %v but error: %v", code, expect, err)
+		}
+		if !reflect.DeepEqual(ret, expect) {
+			t.Fatalf("expect %s got %v but %v", code, expect, ret)
+		}
+	}
+}
+
+func TestDictMarshal(t *testing.T) {
+	g := testGisp()
+	g.SetEngine(VM)
+	forms, err := g.Read(`{"a" 1 :b '(x y) "c" {"d" :e}}`)
+	if err != nil {
+		t.Fatalf("expect read dict but error: %v", err)
+	}
+	chunk, err := CompileChunk(forms)
+	if err != nil {
+		t.Fatalf("expect compile dict but error: %v", err)
+	}
+	data, err := chunk.MarshalBinary()
+	if err != nil {
+		t.Fatalf("expect marshal dict but error: %v", err)
+	}
+	loaded := &Chunk{}
+	if err := loaded.UnmarshalBinary(data); err != nil {
+		t.Fatalf("expect unmarshal dict but error: %v", err)
+	}
+	expect, _ := chunk.Run(testGisp())
+	ret, err := loaded.Run(testGisp())
+	if err != nil || !reflect.DeepEqual(ret, expect) {
+		t.Fatalf("expect loaded dict got %v but %v, %v", expect, ret, err)
+	}
+}
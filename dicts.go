@@ -0,0 +1,277 @@
+package gisp
+
+import (
+	"fmt"
+	"reflect"
+
+	p "github.com/Dwarfartisan/goparsec2"
+)
+
+// Dicts 提供字典操作。它们都不修改参数，而是给出新的 map[string]interface{} 。字典参数可以是
+// nil 或任意以 string 为键的 map ，键可以写作字符串或 Keyword 。 keys 、 values 和 entries
+// 按键的顺序给出结果。 get-in 和 assoc-in 的路径是键和序号组成的 List ，可以穿过嵌套的字典和
+// List
+var Dicts = Toolkit{
+	Meta: map[string]interface{}{
+		"category": "toolkit",
+		"name":     "dict",
+	},
+	Content: map[string]interface{}{
+		"get-in": SimpleBox{
+			SignChecker(p.P(p.One).Then(p.One).Then(p.Choice(p.Try(p.EOF), p.P(p.One).Then(p.EOF)))),
+			func(args ...interface{}) Tasker {
+				return func(env Env) (interface{}, error) {
+					path, err := pathOf("get-in", args[1])
+					if err != nil {
+						return nil, err
+					}
+					coll := args[0]
+					for _, key := range path {
+						var ok bool
+						if coll, ok = pathStep(coll, key); !ok {
+							if len(args) > 2 {
+								return args[2], nil
+							}
+							return nil, nil
+						}
+					}
+					return coll, nil
+				}
+			}},
+		"assoc-in": SimpleBox{
+			SignChecker(p.P(p.One).Then(p.One).Then(p.One).Then(p.EOF)),
+			func(args ...interface{}) Tasker {
+				return func(env Env) (interface{}, error) {
+					path, err := pathOf("assoc-in", args[1])
+					if err != nil {
+						return nil, err
+					}
+					return assocIn(args[0], path, args[2])
+				}
+			}},
+		"assoc": SimpleBox{
+			SignChecker(p.P(p.One).Then(p.Many(p.P(p.One).Then(p.One))).Then(p.EOF)),
+			func(args ...interface{}) Tasker {
+				return func(env Env) (interface{}, error) {
+					dict, err := dictCopy("assoc", args[0])
+					if err != nil {
+						return nil, err
+					}
+					for idx := 1; idx < len(args); idx += 2 {
+						key, err := dictKey("assoc", args[idx])
+						if err != nil {
+							return nil, err
+						}
+						dict[key] = args[idx+1]
+					}
+					return dict, nil
+				}
+			}},
+		"dissoc": SimpleBox{
+			SignChecker(p.P(p.One).Then(p.Many(p.One)).Then(p.EOF)),
+			func(args ...interface{}) Tasker {
+				return func(env Env) (interface{}, error) {
+					dict, err := dictCopy("dissoc", args[0])
+					if err != nil {
+						return nil, err
+					}
+					for _, k := range args[1:] {
+						key, err := dictKey("dissoc", k)
+						if err != nil {
+							return nil, err
+						}
+						delete(dict, key)
+					}
+					return dict, nil
+				}
+			}},
+		// merge 合并多个字典，相同的键以后面的字典为准
+		"merge": SimpleBox{
+			SignChecker(p.P(p.Many(p.One)).Then(p.EOF)),
+			func(args ...interface{}) Tasker {
+				return func(env Env) (interface{}, error) {
+					ret := map[string]interface{}{}
+					for _, arg := range args {
+						dict, err := dictCopy("merge", arg)
+						if err != nil {
+							return nil, err
+						}
+						for key, value := range dict {
+							ret[key] = value
+						}
+					}
+					return ret, nil
+				}
+			}},
+		// update 实现 (update dict key f args...) ，键的新值为 (f old args...)
+		"update": SimpleBox{
+			SignChecker(p.P(p.One).Then(p.One).Then(p.One).Then(p.Many(p.One)).Then(p.EOF)),
+			func(args ...interface{}) Tasker {
+				return func(env Env) (interface{}, error) {
+					dict, err := dictCopy("update", args[0])
+					if err != nil {
+						return nil, err
+					}
+					key, err := dictKey("update", args[1])
+					if err != nil {
+						return nil, err
+					}
+					params := append([]interface{}{dict[key]}, args[3:]...)
+					if dict[key], err = applyValue(env, args[2], params); err != nil {
+						return nil, err
+					}
+					return dict, nil
+				}
+			}},
+		"keys": dictView("keys", func(key string, value interface{}) interface{} {
+			return key
+		}),
+		"values": dictView("values", func(key string, value interface{}) interface{} {
+			return value
+		}),
+		"entries": dictView("entries", func(key string, value interface{}) interface{} {
+			return List{key, value}
+		}),
+		// has? 判断字典中是否有指定的键，对 List 判断序号是否在范围内
+		"has?": SimpleBox{
+			SignChecker(p.P(p.One).Then(p.One).Then(p.EOF)),
+			func(args ...interface{}) Tasker {
+				return func(env Env) (interface{}, error) {
+					_, ok := pathStep(args[0], args[1])
+					return Bool(ok), nil
+				}
+			}},
+	},
+}
+
+// dictView 构造按键的顺序把字典的每一项映射为 List 元素的函数
+func dictView(name string, item func(key string, value interface{}) interface{}) SimpleBox {
+	return SimpleBox{
+		SignChecker(p.P(p.One).Then(p.EOF)),
+		func(args ...interface{}) Tasker {
+			return func(env Env) (interface{}, error) {
+				dict, err := dictCopy(name, args[0])
+				if err != nil {
+					return nil, err
+				}
+				ret := make(List, 0, len(dict))
+				for _, key := range sortedKeys(reflect.ValueOf(dict)) {
+					ret = append(ret, item(key.String(), dict[key.String()]))
+				}
+				return ret, nil
+			}
+		}}
+}
+
+// dictCopy 把 dict 复制为新的 map[string]interface{}
+func dictCopy(name string, dict interface{}) (map[string]interface{}, error) {
+	ret := map[string]interface{}{}
+	if dict == nil {
+		return ret, nil
+	}
+	val := reflect.ValueOf(dict)
+	if val.Kind() != reflect.Map || val.Type().Key().Kind() != reflect.String {
+		return nil, fmt.Errorf("%s args error: expect a dict but %v", name, dict)
+	}
+	iter := val.MapRange()
+	for iter.Next() {
+		ret[iter.Key().String()] = Value(iter.Value().Interface())
+	}
+	return ret, nil
+}
+
+// dictKey 给出字符串或 Keyword 表示的键
+func dictKey(name string, key interface{}) (string, error) {
+	switch k := key.(type) {
+	case string:
+		return k, nil
+	case Keyword:
+		return string(k), nil
+	}
+	return "", fmt.Errorf("%s args error: expect a string or keyword key but %v", name, key)
+}
+
+// pathOf 给出 List 或 slice 形式的路径
+func pathOf(name string, path interface{}) ([]interface{}, error) {
+	val := reflect.ValueOf(path)
+	if val.Kind() != reflect.Slice && val.Kind() != reflect.Array {
+		return nil, fmt.Errorf("%s args error: expect a path list but %v", name, path)
+	}
+	ret := make([]interface{}, val.Len())
+	for idx := range ret {
+		ret[idx] = Value(val.Index(idx).Interface())
+	}
+	return ret, nil
+}
+
+// pathStep 按键或序号取出 coll 中的一项，没有这一项时 ok 为 false
+func pathStep(coll, key interface{}) (interface{}, bool) {
+	val := reflect.ValueOf(coll)
+	switch val.Kind() {
+	case reflect.Map:
+		k, err := dictKey("", key)
+		if err != nil || val.Type().Key().Kind() != reflect.String {
+			return nil, false
+		}
+		item := val.MapIndex(reflect.ValueOf(k).Convert(val.Type().Key()))
+		if !item.IsValid() {
+			return nil, false
+		}
+		return Value(item.Interface()), true
+	case reflect.Slice, reflect.Array:
+		if at := listIndex(key, val.Len()); at >= 0 {
+			return Value(val.Index(at).Interface()), true
+		}
+	}
+	return nil, false
+}
+
+// listIndex 把 key 解释为长度为 ll 的序列的序号，负数从末尾倒数，不是合法序号时给出 -1
+func listIndex(key interface{}, ll int) int {
+	idx, ok := key.(Int)
+	if !ok {
+		return -1
+	}
+	return indexIs(idx, ll)
+}
+
+// assocIn 给出把 path 处的值替换为 value 后的 coll 。路径上缺少的字典会被创建， List 的序号
+// 必须在范围内，负数从末尾倒数
+func assocIn(coll interface{}, path []interface{}, value interface{}) (interface{}, error) {
+	if len(path) == 0 {
+		return value, nil
+	}
+	child, _ := pathStep(coll, path[0])
+	item, err := assocIn(child, path[1:], value)
+	if err != nil {
+		return nil, err
+	}
+	switch c := coll.(type) {
+	case List:
+		at := listIndex(path[0], len(c))
+		if at < 0 {
+			return nil, fmt.Errorf("assoc-in args error: index %v out of list %v", path[0], c)
+		}
+		ret := append(List{}, c...)
+		ret[at] = item
+		return ret, nil
+	case []interface{}:
+		at := listIndex(path[0], len(c))
+		if at < 0 {
+			return nil, fmt.Errorf("assoc-in args error: index %v out of list %v", path[0], c)
+		}
+		ret := append([]interface{}{}, c...)
+		ret[at] = item
+		return ret, nil
+	}
+	dict, err := dictCopy("assoc-in", coll)
+	if err != nil {
+		return nil, err
+	}
+	key, err := dictKey("assoc-in", path[0])
+	if err != nil {
+		return nil, err
+	}
+	dict[key] = item
+	return dict, nil
+}
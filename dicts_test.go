@@ -0,0 +1,90 @@
+package gisp
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestDictsOps(t *testing.T) {
+	type dict = map[string]interface{}
+	cases := map[string]interface{}{
+		`(assoc {"a" 1} "b" 2 :c 3)`:                   dict{"a": Int(1), "b": Int(2), "c": Int(3)},
+		`(assoc nil "a" 1)`:                            dict{"a": Int(1)},
+		`(dissoc {"a" 1 "b" 2} "a" :c)`:                dict{"b": Int(2)},
+		`(merge {"a" 1 "b" 2} nil {"b" 3})`:            dict{"a": Int(1), "b": Int(3)},
+		`(merge)`:                                      dict{},
+		`(update {"n" 1} "n" + 10)`:                    dict{"n": Int(11)},
+		`(update {} :n (lambda (x::any?) (if x x 0)))`: dict{"n": Int(0)},
+		`(keys {"b" 1 "a" 2 "c" 3})`:                   List{"a", "b", "c"},
+		`(values {"b" 1 "a" 2 "c" 3})`:                 List{Int(2), Int(1), Int(3)},
+		`(entries {"b" 1 "a" 2})`:                      List{List{"a", Int(2)}, List{"b", Int(1)}},
+		`(has? {"a" nil} "a")`:                         Bool(true),
+		`(has? {"a" 1} :b)`:                            Bool(false),
+		`(has? '(1 2) 1)`:                              Bool(true),
+		`(keys goMap)`:                                 List{"x", "y"},
+		`(assoc goMap "z" 3)`:                          dict{"x": Int(1), "y": Int(2), "z": Int(3)},
+		`(var src {"a" 1}) (assoc src "a" 2) src`:      dict{"a": Int(1)},
+	}
+	for code, expect := range cases {
+		g := testGisp()
+		g.DefAs("goMap", map[string]int{"y": 2, "x": 1})
+		ret, err := g.Parse(code)
+		if err != nil {
+			t.Fatalf("expect %s got %v but error: %v", code, expect, err)
+		}
+		if !reflect.DeepEqual(ret, expect) {
+			t.Fatalf("expect %s got %v but %v", code, expect, ret)
+		}
+	}
+	g := testGisp()
+	for _, code := range []string{`(assoc {} "a")`, `(assoc '(1) "a" 1)`, `(dissoc {} 1)`,
+		`(keys 1)`, `(update {} "n" 1)`} {
+		if _, err := g.Parse(code); err == nil {
+			t.Fatalf("expect %s got error but nil", code)
+		}
+	}
+}
+
+func TestDictsPath(t *testing.T) {
+	type dict = map[string]interface{}
+	g := testGisp()
+	_, err := g.Parse(`(var doc {"user" {"name" "ann" "tags" '("a" "b")} "items" '(1 2)})`)
+	if err != nil {
+		t.Fatalf("expect define doc but error: %v", err)
+	}
+	cases := map[string]interface{}{
+		`(get-in doc '("user" "name"))`:                                    "ann",
+		`(get-in doc '(:user :tags 1))`:                                    "b",
+		`(get-in doc '(:user :tags -1))`:                                   "b",
+		`(get-in doc '(:user :tags -3) 0)`:                                 Int(0),
+		`(get-in (assoc-in doc '("user" "tags" -1) "z") '("user" "tags"))`: List{"a", "z"},
+		`(get-in doc '("user" "age"))`:                                     nil,
+		`(get-in doc '("user" "age") 18)`:                                  Int(18),
+		`(get-in doc '("items" 5) 0)`:                                      Int(0),
+		`(get-in doc '())`:                                                 doc(g),
+		`(get-in (assoc-in doc '("user" "name") "bob") '("user" "name"))`:  "bob",
+		`(get-in (assoc-in doc '("user" "tags" 0) "z") '("user" "tags"))`:  List{"z", "b"},
+		`(assoc-in nil '("a" "b") 1)`:                                      dict{"a": dict{"b": Int(1)}},
+		`(get-in doc '("user" "tags"))`:                                    List{"a", "b"},
+	}
+	for code, expect := range cases {
+		ret, err := g.Parse(code)
+		if err != nil {
+			t.Fatalf("expect %s got %v but error: %v", code, expect, err)
+		}
+		if !reflect.DeepEqual(ret, expect) {
+			t.Fatalf("expect %s got %v but %v", code, expect, ret)
+		}
+	}
+	for _, code := range []string{`(assoc-in doc '("items" 9) 1)`, `(assoc-in doc '("items" "x") 1)`,
+		`(get-in doc "user")`} {
+		if _, err := g.Parse(code); err == nil {
+			t.Fatalf("expect %s got error but nil", code)
+		}
+	}
+}
+
+func doc(g *Gisp) interface{} {
+	value, _ := g.Lookup("doc")
+	return value
+}
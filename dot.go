@@ -29,10 +29,16 @@ func (err NameInvalid) Error() string {
 type Dot struct {
 	obj  interface{}
 	expr Atom
+	span Span
 }
 
 // Eval 方法实现 dot 的解释求值行为
 func (dot Dot) Eval(env Env) (interface{}, error) {
+	value, err := dot.eval(env)
+	return value, withSpan(dot.span, err)
+}
+
+func (dot Dot) eval(env Env) (interface{}, error) {
 	o, err := Eval(env, dot.obj)
 	if err != nil {
 		return nil, err
@@ -95,7 +101,7 @@ func (de DotExpr) Task(env Env, args ...interface{}) (Lisp, error) {
 	if len(args) != 1 {
 		return nil, fmt.Errorf("Dot expression Args Error: expect 1 arg but %v", args)
 	}
-	return Dot{args[0], AA(de.Name)}, nil
+	return Dot{obj: args[0], expr: AA(de.Name)}, nil
 }
 
 // DotExprParser 实现 Dot 表达式的解析构造
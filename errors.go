@@ -0,0 +1,166 @@
+package gisp
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// 以下哨兵错误用于对求值错误分类，例如 errors.Is(err, ErrName) 。具体的错误类型都实现了
+// Is 方法，与所属的分类匹配
+var (
+	ErrName     = errors.New("name error")
+	ErrTypeSign = errors.New("type sign error")
+	ErrArity    = errors.New("arity error")
+	ErrUser     = errors.New("user error")
+	ErrPanic    = errors.New("go panic")
+)
+
+// NameError 表示找不到命名
+type NameError struct {
+	Name string
+}
+
+func (err NameError) Error() string {
+	return fmt.Sprintf("name %s not found", err.Name)
+}
+
+// Is 实现 errors.Is 的分类判断
+func (err NameError) Is(target error) bool {
+	return target == ErrName
+}
+
+// Is 实现 errors.Is 的分类判断
+func (err TypeSignError) Is(target error) bool {
+	return target == ErrTypeSign
+}
+
+// SignError 表示函数的所有重载都不能匹配实参的类型
+type SignError struct {
+	Name   string
+	Params []interface{}
+}
+
+func (err SignError) Error() string {
+	if err.Name == "" {
+		return fmt.Sprintf("not found args type sign for %v", err.Params)
+	}
+	return fmt.Sprintf("not found args type sign for %s %v", err.Name, err.Params)
+}
+
+// Is 实现 errors.Is 的分类判断
+func (err SignError) Is(target error) bool {
+	return target == ErrTypeSign
+}
+
+// ArityError 表示函数没有接受 Got 个参数的重载
+type ArityError struct {
+	Name string
+	Got  int
+}
+
+func (err ArityError) Error() string {
+	return fmt.Sprintf("wrong number of args (%d) passed to %s", err.Got, err.Name)
+}
+
+// Is 实现 errors.Is 的分类判断
+func (err ArityError) Is(target error) bool {
+	return target == ErrArity
+}
+
+// UserError 是脚本通过 error 、 errorf 抛出的错误， Value 是传给 error 的原始值
+type UserError struct {
+	Message string
+	Value   interface{}
+}
+
+func (err UserError) Error() string {
+	return err.Message
+}
+
+// Is 实现 errors.Is 的分类判断
+func (err UserError) Is(target error) bool {
+	return target == ErrUser
+}
+
+// Unwrap 在 Value 是 Go 的 error 时返回它
+func (err UserError) Unwrap() error {
+	if e, ok := err.Value.(error); ok {
+		return e
+	}
+	return nil
+}
+
+// PanicError 表示通过反射调用的 Go 函数发生了 panic ， Func 是函数的类型签名， Args 是
+// 传入的参数， Value 是 recover 得到的值
+type PanicError struct {
+	Func  string
+	Args  []interface{}
+	Value interface{}
+}
+
+func (err PanicError) Error() string {
+	return fmt.Sprintf("panic in go call %s with args %v: %v", err.Func, err.Args, err.Value)
+}
+
+// Is 实现 errors.Is 的分类判断
+func (err PanicError) Is(target error) bool {
+	return target == ErrPanic
+}
+
+// Unwrap 在 panic 的值是 error 时返回它，例如 runtime.Error
+func (err PanicError) Unwrap() error {
+	if e, ok := err.Value.(error); ok {
+		return e
+	}
+	return nil
+}
+
+// GispError 记录错误向外传播时经过的 gisp 函数调用栈， Stack 由内而外排列
+type GispError struct {
+	Err   error
+	Stack []string
+}
+
+func (err *GispError) Error() string {
+	if len(err.Stack) == 0 {
+		return err.Err.Error()
+	}
+	return fmt.Sprintf("%v (in %s)", err.Err, strings.Join(collapseFrames(err.Stack), " <- "))
+}
+
+// Unwrap 返回原始的错误
+func (err *GispError) Unwrap() error {
+	return err.Err
+}
+
+// withFrame 在错误的调用栈上追加一层函数调用，错误中还没有 GispError 时创建它
+func withFrame(name string, err error) error {
+	if err == nil {
+		return nil
+	}
+	var gerr *GispError
+	if errors.As(err, &gerr) {
+		gerr.Stack = append(gerr.Stack, name)
+		return err
+	}
+	return &GispError{err, []string{name}}
+}
+
+// collapseFrames 把连续重复的栈帧（通常来自递归）合并为 name (xN)
+func collapseFrames(stack []string) []string {
+	frames := []string{}
+	for idx := 0; idx < len(stack); {
+		jdx := idx + 1
+		for jdx < len(stack) && stack[jdx] == stack[idx] {
+			jdx++
+		}
+		if n := jdx - idx; n > 1 {
+			frames = append(frames, fmt.Sprintf("%s (x%d)", stack[idx], n))
+		} else {
+			frames = append(frames, stack[idx])
+		}
+		idx = jdx
+	}
+	return frames
+}
@@ -0,0 +1,136 @@
+package gisp
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestErrorClassify(t *testing.T) {
+	g := testGisp()
+	_, err := g.Parse(`
+	(defun inc (x::int) (+ x 1))
+	(defun fail (msg) (errorf "fail: %s" msg))`)
+	if err != nil {
+		t.Fatalf("expect defun functions but error: %v", err)
+	}
+	cases := map[string]error{
+		"(missing 1)":   ErrName,
+		"(inc 1.5)":     ErrTypeSign,
+		"(inc 1 2)":     ErrArity,
+		`(fail "boom")`: ErrUser,
+	}
+	for code, kind := range cases {
+		_, err := g.Parse(code)
+		if !errors.Is(err, kind) {
+			t.Fatalf("expect %s failed as %v but %v", code, kind, err)
+		}
+	}
+	var uerr UserError
+	_, err = g.Parse(`(fail "boom")`)
+	if !errors.As(err, &uerr) || uerr.Value != "fail: boom" {
+		t.Fatalf("expect UserError with value \"fail: boom\" but %v", err)
+	}
+}
+
+func TestErrorClassifyToolkit(t *testing.T) {
+	g := testGisp()
+	for _, code := range []string{"(upper 1)", `(upper "a" "b")`, `(split "a,b" 1)`} {
+		_, err := g.Parse(code)
+		if !errors.Is(err, ErrTypeSign) {
+			t.Fatalf("expect %s failed as type sign but %v", code, err)
+		}
+	}
+	_, err := g.Parse("(upper 1)")
+	var serr TypeSignError
+	if !errors.As(err, &serr) || serr.Value != Int(1) {
+		t.Fatalf("expect (upper 1) got TypeSignError of 1 but %v", err)
+	}
+	_, err = g.Parse(`(upper "a" "b")`)
+	var sign SignError
+	if !errors.As(err, &sign) {
+		t.Fatalf("expect (upper \"a\" \"b\") got SignError but %v", err)
+	}
+	ret, err := g.Parse("(try (upper 1) (catch e (error-kind e)))")
+	if err != nil || ret != "type sign" {
+		t.Fatalf("expect error-kind of (upper 1) is type sign but %v, %v", ret, err)
+	}
+}
+
+func TestErrorStack(t *testing.T) {
+	g := testGisp()
+	_, err := g.Parse(`
+	(defun inner (x) (error x))
+	(defun middle (x) (inner x))
+	(defun outer (x) (middle x))`)
+	if err != nil {
+		t.Fatalf("expect defun functions but error: %v", err)
+	}
+	_, err = g.Parse(`(outer "deep")`)
+	var gerr *GispError
+	if !errors.As(err, &gerr) {
+		t.Fatalf("expect a GispError but %v", err)
+	}
+	if !reflect.DeepEqual(gerr.Stack, []string{"inner", "middle", "outer"}) {
+		t.Fatalf("expect stack [inner middle outer] but %v", gerr.Stack)
+	}
+	if !errors.Is(err, ErrUser) {
+		t.Fatalf("expect a user error but %v", err)
+	}
+}
+
+func TestErrorStackCollapse(t *testing.T) {
+	g := testGisp()
+	g.SetLimits(Limits{MaxDepth: 5})
+	_, err := g.Parse("(defun forever (n) (forever (forever n))) (forever 1)")
+	var le LimitExceeded
+	if !errors.As(err, &le) {
+		t.Fatalf("expect LimitExceeded but %v", err)
+	}
+	expect := "1:29: limit exceeded: max depth 5 (in forever (x6))"
+	if err.Error() != expect {
+		t.Fatalf("expect error message %q but %q", expect, err.Error())
+	}
+}
+
+type panicBox struct {
+	data map[string]int
+}
+
+func (box *panicBox) Get(key string) int {
+	return box.data[key]
+}
+
+func TestReflectPanic(t *testing.T) {
+	g := testGisp()
+	g.DefAs("half", reflect.ValueOf(func(x Int) Int {
+		return x / 2
+	}))
+	var box *panicBox
+	g.DefAs("box", box)
+	cases := []string{
+		"(half 1 2)",
+		`(half "1")`,
+		`(box.Get "a")`,
+	}
+	for _, code := range cases {
+		_, err := g.Parse(code)
+		var perr PanicError
+		if !errors.As(err, &perr) {
+			t.Fatalf("expect %s recovered as PanicError but %v", code, err)
+		}
+		if !errors.Is(err, ErrPanic) {
+			t.Fatalf("expect %s classified as panic but %v", code, err)
+		}
+	}
+	_, err := g.Parse("(half 1 2)")
+	var perr PanicError
+	errors.As(err, &perr)
+	if perr.Func != "func(gisp.Int) gisp.Int" || len(perr.Args) != 2 {
+		t.Fatalf("expect panic record go func sign and args but %v %v", perr.Func, perr.Args)
+	}
+	ret, err := g.Parse(`(try (half "1") (catch e (error-kind e)))`)
+	if err != nil || ret != "panic" {
+		t.Fatalf("expect catch a panic but got %v, %v", ret, err)
+	}
+}
@@ -3,19 +3,19 @@
 (defun add (a::int b::int)
     (addInt a b))
 (defun add (a::float b::int)
-    (addFloat a (:: float b)))
+    (addFloat a (float b)))
 (defun add (a::int b::float)
-    (addFloat (::float a) b))
+    (addFloat (float a) b))
 (defun add (a::float b::float)
     (addFloat a b))
 
 (defun sub (a b)
     (- a b))
 (defun sub (a::int b::int)
-    (addInt a b))
-(defun add (a::float b::int)
-    (addFloat a (:: float b)))
-(defun add (a::int b::float)
-    (addFloat (:: float a) b))
-(defun add (a::float b::float)
-    (addFloat a b))
+    (subInt a b))
+(defun sub (a::float b::int)
+    (subFloat a (float b)))
+(defun sub (a::int b::float)
+    (subFloat (float a) b))
+(defun sub (a::float b::float)
+    (subFloat a b))
@@ -0,0 +1,182 @@
+package gisp
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+)
+
+func TestForkCopyOnWrite(t *testing.T) {
+	base := NewGisp(map[string]Toolbox{
+		"axioms": Axiom,
+		"props":  Propositions,
+	})
+	_, err := base.Parse(`
+	(var rate 2)
+	(defun scale (x r) (* x r))`)
+	if err != nil {
+		t.Fatalf("expect base definitions but error: %v", err)
+	}
+	fork := base.Fork()
+	ret, err := fork.Parse(`
+	(set 'rate 3)
+	(defun scale (x::string) x)
+	(var extra 1)
+	(scale 10 rate)`)
+	if err != nil || ret != Int(30) {
+		t.Fatalf("expect (scale 10 rate) got 30 in fork but %v, %v", ret, err)
+	}
+	ret, err = fork.Parse(`(scale "s")`)
+	if err != nil || ret != "s" {
+		t.Fatalf("expect fork overload scale for string but %v, %v", ret, err)
+	}
+	ret, err = base.Parse("(scale 10 rate)")
+	if err != nil || ret != Int(20) {
+		t.Fatalf("expect base rate unchanged and got 20 but %v, %v", ret, err)
+	}
+	if _, err := base.Parse(`(scale "s")`); err == nil {
+		t.Fatalf("expect base scale not overloaded by fork")
+	}
+	if _, ok := base.Lookup("extra"); ok {
+		t.Fatalf("expect var extra defined only in fork")
+	}
+	if err := fork.Defvar("rate", VarSlot(INTMUST)); err == nil {
+		t.Fatalf("expect defvar rate in fork failed as it exists in base")
+	}
+}
+
+func TestForkConcurrent(t *testing.T) {
+	base := NewGisp(map[string]Toolbox{
+		"axioms": Axiom,
+		"props":  Propositions,
+	})
+	base.SetLimits(Limits{MaxSteps: 10000})
+	_, err := base.Parse(`
+	(var rate 2)
+	(defun scale (x r) (* x r))
+	(defun apply (f x r) (f x r))
+	(defmacro twice (x) ` + "`" + `(+ ,x ,x))`)
+	if err != nil {
+		t.Fatalf("expect base definitions but error: %v", err)
+	}
+	var wg sync.WaitGroup
+	errs := make(chan error, 32)
+	for idx := 0; idx < 32; idx++ {
+		wg.Add(1)
+		go func(idx int) {
+			defer wg.Done()
+			fork := base.Fork()
+			code := fmt.Sprintf(`
+			(set 'rate %d)
+			(var mine %d)
+			(twice (apply scale mine rate))`, idx, idx)
+			ret, err := fork.ParseContext(context.Background(), code)
+			if err != nil {
+				errs <- err
+				return
+			}
+			if ret != Int(2*idx*idx) {
+				errs <- fmt.Errorf("expect goroutine %d got %d but %v", idx, 2*idx*idx, ret)
+			}
+		}(idx)
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		t.Fatal(err)
+	}
+	rate, _ := base.Lookup("rate")
+	if rate != Int(2) {
+		t.Fatalf("expect base rate still 2 but %v", rate)
+	}
+}
+
+func TestForkBaseClosureSet(t *testing.T) {
+	base := NewGisp(map[string]Toolbox{
+		"axioms": Axiom,
+		"props":  Propositions,
+	})
+	_, err := base.Parse(`
+	(var counter 0)
+	(defun bump (n)
+	    (set 'counter (+ counter n))
+	    counter)`)
+	if err != nil {
+		t.Fatalf("expect base definitions but error: %v", err)
+	}
+	var wg sync.WaitGroup
+	errs := make(chan error, 32)
+	for idx := 1; idx <= 32; idx++ {
+		wg.Add(1)
+		go func(idx int) {
+			defer wg.Done()
+			fork := base.Fork()
+			ret, err := fork.Parse(fmt.Sprintf("(bump %d) (bump %d)", idx, idx))
+			if err != nil {
+				errs <- err
+				return
+			}
+			if ret != Int(2*idx) {
+				errs <- fmt.Errorf("expect fork %d read its own counter %d but %v", idx, 2*idx, ret)
+				return
+			}
+			if counter, _ := fork.Lookup("counter"); counter != Int(2*idx) {
+				errs <- fmt.Errorf("expect fork %d counter %d but %v", idx, 2*idx, counter)
+			}
+		}(idx)
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		t.Fatal(err)
+	}
+	counter, _ := base.Lookup("counter")
+	if counter != Int(0) {
+		t.Fatalf("expect base counter still 0 but %v", counter)
+	}
+}
+
+// TestForkBaseClosureLet 应该用 go test -race 运行。基础环境中捕获了 let 变量的 lambda 只读
+// 这些变量，在多个 Fork 中并发调用时没有数据竞争
+func TestForkBaseClosureLet(t *testing.T) {
+	base := NewGisp(map[string]Toolbox{
+		"axioms": Axiom,
+		"props":  Propositions,
+	})
+	_, err := base.Parse(`
+	(var scale (let ((k 3)) (lambda (x) (* x k))))
+	(var total 0)
+	(defun add (x)
+	    (set 'total (+ total (scale x)))
+	    total)`)
+	if err != nil {
+		t.Fatalf("expect base definitions but error: %v", err)
+	}
+	var wg sync.WaitGroup
+	errs := make(chan error, 8)
+	for idx := 1; idx <= 8; idx++ {
+		wg.Add(1)
+		go func(idx int) {
+			defer wg.Done()
+			fork := base.Fork()
+			ret, err := fork.Parse(fmt.Sprintf("(add %d) (add %d)", idx, idx))
+			if err != nil {
+				errs <- err
+				return
+			}
+			if ret != Int(6*idx) {
+				errs <- fmt.Errorf("expect fork %d got %d but %v", idx, 6*idx, ret)
+			}
+		}(idx)
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		t.Fatal(err)
+	}
+	total, _ := base.Lookup("total")
+	if total != Int(0) {
+		t.Fatalf("expect base total still 0 but %v", total)
+	}
+}
@@ -2,6 +2,9 @@ package gisp
 
 import (
 	"fmt"
+	"strings"
+
+	p "github.com/Dwarfartisan/goparsec2"
 )
 
 // TypeSignError 定义签名错误
@@ -53,10 +56,44 @@ func (fun Function) Name() string {
 	return fun.atom.Name
 }
 
-// Task 实现了 Function 对象的求值逻辑
+// Task 实现了 Function 对象的求值逻辑。参数只求值一次，然后在所有签名匹配的 Lambda 重载中
+// 选择最具体的一个，与重载定义的先后顺序无关；没有 Lambda 匹配时按定义顺序（新定义优先）尝试
+// 其它 Functor ，最后回退到外层环境的同名定义
 func (fun Function) Task(env Env, args ...interface{}) (Lisp, error) {
+	params, err := Evals(env, args...)
+	if err != nil {
+		return nil, err
+	}
+	return fun.taskParams(env, params)
+}
+
+// taskParams 以已经求值的实参构造调用
+func (fun Function) taskParams(env Env, params []interface{}) (Lisp, error) {
+	quoted := make([]interface{}, len(params))
+	for idx, param := range params {
+		quoted[idx] = Q(param)
+	}
+
+	candidates := []overload{}
+	others := []Functor{}
 	for _, functor := range fun.content {
-		task, err := functor.Task(env, args...)
+		if lambda, ok := functor.(Lambda); ok {
+			if actuals, err := lambda.matchParams(params); err == nil {
+				candidates = append(candidates, overload{lambda, actuals})
+			}
+			continue
+		}
+		others = append(others, functor)
+	}
+	if len(candidates) > 0 {
+		best, err := fun.mostSpecific(candidates, params)
+		if err != nil {
+			return nil, err
+		}
+		return best.lambda.task(fun.Name(), best.actuals), nil
+	}
+	for _, functor := range others {
+		task, err := functor.Task(env, quoted...)
 		if err == nil {
 			return task, nil
 		}
@@ -65,26 +102,117 @@ func (fun Function) Task(env Env, args ...interface{}) (Lisp, error) {
 	if f, ok := fun.Global.Global(fun.Name()); ok {
 		switch foo := f.(type) {
 		case Functor:
-			return foo.Task(env, args...)
+			task, err := foo.Task(env, quoted...)
+			if err != nil {
+				return nil, withFrame(fun.Name(), err)
+			}
+			return task, nil
 		case TaskExpr:
-			task, err := foo(env, args...)
+			task, err := foo(env, quoted...)
 			if err != nil {
-				return nil, err
+				return nil, withFrame(fun.Name(), err)
 			}
 			return TaskBox{task}, nil
 		case LispExpr:
-			lisp, err := foo(env, args...)
+			lisp, err := foo(env, quoted...)
 			if err != nil {
-				return nil, err
+				return nil, withFrame(fun.Name(), err)
 			}
 			return lisp, nil
 		}
 	}
-	return nil, fmt.Errorf("not found args type sign for %v", args)
+	for _, functor := range fun.content {
+		if lambda, ok := functor.(Lambda); ok && lambda.acceptArity(len(params)) {
+			return nil, SignError{fun.Name(), params}
+		}
+	}
+	if len(others) == 0 {
+		return nil, ArityError{fun.Name(), len(params)}
+	}
+	return nil, SignError{fun.Name(), params}
+}
+
+// overload 是一个签名匹配成功的候选重载及其绑定好的实参
+type overload struct {
+	lambda  Lambda
+	actuals interface{}
+}
+
+// mostSpecific 在候选重载中找出比其它所有候选都更具体的一个，找不到时报告歧义
+func (fun Function) mostSpecific(candidates []overload, params []interface{}) (overload, error) {
+	if len(candidates) == 1 {
+		return candidates[0], nil
+	}
+	ranks := make([][]int, len(candidates))
+	for idx, candidate := range candidates {
+		ranks[idx] = candidate.lambda.signRanks(len(params))
+	}
+	for idx, candidate := range candidates {
+		best := true
+		for jdx := range candidates {
+			if idx != jdx && !moreSpecific(ranks[idx], ranks[jdx]) {
+				best = false
+				break
+			}
+		}
+		if best {
+			return candidate, nil
+		}
+	}
+	// 列出没有被其它候选覆盖的那些签名，它们之间无法比较
+	conflicts := []string{}
+	for idx, candidate := range candidates {
+		dominated := false
+		for jdx := range candidates {
+			if idx != jdx && moreSpecific(ranks[jdx], ranks[idx]) {
+				dominated = true
+				break
+			}
+		}
+		if !dominated {
+			conflicts = append(conflicts, candidate.lambda.SignString())
+		}
+	}
+	return overload{}, fmt.Errorf("ambiguous call %s %v: conflicting signatures %s",
+		fun.Name(), params, strings.Join(conflicts, ", "))
+}
+
+// typeRank 给出一个参数类型的具体程度：具体类型高于 any ，非 option 高于 option
+func typeRank(typ Type) int {
+	rank := 0
+	if typ.Type != ANY {
+		rank += 2
+	}
+	if !typ.Option() {
+		rank++
+	}
+	return rank
+}
+
+// moreSpecific 判断签名 x 是否严格比 y 更具体，即每个位置都不低于 y 且至少有一个位置高于 y
+func moreSpecific(x, y []int) bool {
+	greater := false
+	for idx := range x {
+		if x[idx] < y[idx] {
+			return false
+		}
+		if x[idx] > y[idx] {
+			greater = true
+		}
+	}
+	return greater
 }
 
-// Overload 实现了 Function 的 Overload 行为
+// Overload 实现了 Function 的 Overload 行为，签名与已有 Lambda 相同时替换掉旧的定义
 func (fun *Function) Overload(functor Functor) error {
+	if lambda, ok := functor.(Lambda); ok {
+		for idx, f := range fun.content {
+			if old, ok := f.(Lambda); ok && old.sameSign(lambda) {
+				fun.content[idx] = functor
+				return nil
+			}
+		}
+	}
 	fun.content = append([]Functor{functor}, fun.content...)
 	return nil
 }
@@ -94,29 +222,41 @@ func (fun Function) Content() []Functor {
 	return fun.content
 }
 
-// DefunExpr 是构造 Function 的表达式
+// defunLocal 是 Let、Task、GinQ 这类用 map[string]Var 保存本地命名的环境共用的 Defun 逻辑。
+// 本地已有同名函数时对其 Overload ；否则在本地构造一个新的 Function 遮蔽外层定义，
+// 调用时本地的重载都不匹配，Function 会回退到外层环境中的同名定义。
+func defunLocal(env Env, local map[string]Var, name string, functor Functor) error {
+	if slot, ok := local[name]; ok {
+		if fun, ok := slot.Get().(Func); ok {
+			return fun.Overload(functor)
+		}
+		return fmt.Errorf("%s defined as a var", name)
+	}
+	slot := StrictVarAs(NewFunction(name, env, functor))
+	local[name] = &slot
+	return nil
+}
+
+// DefunExpr 是构造 Function 的表达式 (defun name (args...) body...)，重复定义同名函数时
+// 新的定义作为 Overload 加入已有的 Function
 func DefunExpr(env Env, args ...interface{}) (Tasker, error) {
+	st := p.NewBasicState(args)
+	_, err := TypeAs(ATOM).Then(TypeAs(LIST))(&st)
+	if err != nil {
+		return nil, fmt.Errorf("Defun Args Error: expect (defun name (args...) body...) but error: %v", err)
+	}
 	funName := args[0].(Atom)
-	_args := args[1].(List)
-	var err error
-	lambda, err := DeclareLambda(env, _args, args[2:]...)
+	prepare := map[string]bool{funName.Name: true}
+	lambda, err := declareLambda(env, prepare, args[1].(List), args[2:]...)
 	if err != nil {
 		return nil, err
 	}
-	if f, ok := env.Local(funName.Name); ok {
-		if fun, ok := f.(Function); ok {
-			err := fun.Overload(*lambda)
-			if err == nil {
-				return Q(fun).Eval, nil
-			}
+	return func(env Env) (interface{}, error) {
+		err := env.Defun(funName.Name, *lambda)
+		if err != nil {
 			return nil, err
 		}
-		return nil, fmt.Errorf("%v is defined as no Expr", funName.Name)
-	}
-
-	err = env.Defun(funName.Name, *lambda)
-	if err == nil {
-		return nil, nil
-	}
-	return nil, err
+		fun, _ := env.Local(funName.Name)
+		return fun, nil
+	}, nil
 }
@@ -1,7 +1,9 @@
 package gisp
 
 import (
+	"io/ioutil"
 	"reflect"
+	"strings"
 	"testing"
 
 	px "github.com/Dwarfartisan/goparsec/parsex"
@@ -125,3 +127,157 @@ func TestMulAutoOverload(t *testing.T) {
 		t.Fatalf("expect %v * %v is %v but %v", in, ratio, out, ret)
 	}
 }
+
+func overloadGisp(t *testing.T) *Gisp {
+	g := testGisp()
+	g.DefAs("addInt", reflect.ValueOf(func(x, y Int) Int { return x + y }))
+	g.DefAs("subInt", reflect.ValueOf(func(x, y Int) Int { return x - y }))
+	g.DefAs("addFloat", reflect.ValueOf(func(x, y Float) Float { return x + y }))
+	g.DefAs("subFloat", reflect.ValueOf(func(x, y Float) Float { return x - y }))
+	g.DefAs("float", reflect.ValueOf(func(x Int) Float { return Float(x) }))
+	code, err := ioutil.ReadFile("examples/overload.lisp")
+	if err != nil {
+		t.Fatalf("expect read examples/overload.lisp but error: %v", err)
+	}
+	_, err = g.Parse(string(code))
+	if err != nil {
+		t.Fatalf("expect defun overloads from examples/overload.lisp but error: %v", err)
+	}
+	return g
+}
+
+func TestDefunOverload(t *testing.T) {
+	g := overloadGisp(t)
+	fun, ok := g.Lookup("add")
+	if !ok {
+		t.Fatalf("expect add defined as a function")
+	}
+	if l := len(fun.(Func).Content()); l != 5 {
+		t.Fatalf("expect add has 5 overloads but %d", l)
+	}
+	cases := map[string]interface{}{
+		"(add 1 2)":     Int(3),
+		"(add 1.5 2)":   Float(3.5),
+		"(add 1 2.5)":   Float(3.5),
+		"(add 1.5 2.5)": Float(4),
+		"(sub 5 2)":     Int(3),
+		"(sub 5.5 2)":   Float(3.5),
+	}
+	for code, expect := range cases {
+		ret, err := g.Parse(code)
+		if err != nil {
+			t.Fatalf("expect %s got %v but error: %v", code, expect, err)
+		}
+		if !reflect.DeepEqual(ret, expect) {
+			t.Fatalf("expect %s got %v but %v", code, expect, ret)
+		}
+	}
+}
+
+func TestDefunShadowInLet(t *testing.T) {
+	g := overloadGisp(t)
+	ret, err := g.Parse(`
+(let ((x 1))
+	(defun add (a::string b::string) "local add")
+	(add "a" "b"))
+`)
+	if err != nil {
+		t.Fatalf("expect local add shadow the global one but error: %v", err)
+	}
+	if !reflect.DeepEqual(ret, "local add") {
+		t.Fatalf("expect local add got \"local add\" but %v", ret)
+	}
+	ret, err = g.Parse(`
+(let ((x 1))
+	(defun add (a::string b::string) "local add")
+	(add x 2))
+`)
+	if err != nil {
+		t.Fatalf("expect local add fallback to the global one but error: %v", err)
+	}
+	if !reflect.DeepEqual(ret, Int(3)) {
+		t.Fatalf("expect global add got 3 but %v", ret)
+	}
+	if fun, _ := g.Lookup("add"); len(fun.(Func).Content()) != 5 {
+		t.Fatalf("expect local defun don't overload the global add")
+	}
+}
+
+func TestOverloadMostSpecific(t *testing.T) {
+	g := NewGisp(map[string]Toolbox{
+		"axioms": Axiom,
+		"props":  Propositions,
+	})
+	_, err := g.Parse(`
+(defun kind (a::int b::int) "ints")
+(defun kind (a::int b) "int and any")
+(defun kind (a b ...) "variadic")
+(defun kind (a b) "any")
+`)
+	if err != nil {
+		t.Fatalf("expect defun kind overloads but error: %v", err)
+	}
+	cases := map[string]interface{}{
+		"(kind 1 2)":     "ints",
+		`(kind 1 "x")`:   "int and any",
+		`(kind "x" "y")`: "any",
+		`(kind "x")`:     "variadic",
+		`(kind 1 2 3)`:   "variadic",
+	}
+	for code, expect := range cases {
+		ret, err := g.Parse(code)
+		if err != nil {
+			t.Fatalf("expect %s got %v but error: %v", code, expect, err)
+		}
+		if !reflect.DeepEqual(ret, expect) {
+			t.Fatalf("expect %s got %v but %v", code, expect, ret)
+		}
+	}
+}
+
+func TestOverloadAmbiguous(t *testing.T) {
+	g := NewGisp(map[string]Toolbox{
+		"axioms": Axiom,
+		"props":  Propositions,
+	})
+	_, err := g.Parse(`
+(defun pick (a::int b) "left")
+(defun pick (a b::int) "right")
+`)
+	if err != nil {
+		t.Fatalf("expect defun pick overloads but error: %v", err)
+	}
+	ret, err := g.Parse(`(pick 1 "x")`)
+	if err != nil || ret != "left" {
+		t.Fatalf("expect (pick 1 \"x\") got left but %v, %v", ret, err)
+	}
+	_, err = g.Parse(`(pick 1 2)`)
+	if err == nil {
+		t.Fatalf("expect (pick 1 2) is ambiguous")
+	}
+	if !strings.Contains(err.Error(), "ambiguous") {
+		t.Fatalf("expect ambiguous error but %v", err)
+	}
+}
+
+func TestOverloadRedefine(t *testing.T) {
+	g := NewGisp(map[string]Toolbox{
+		"axioms": Axiom,
+		"props":  Propositions,
+	})
+	ret, err := g.Parse(`
+(defun version (a::int) "old")
+(defun version (a::int) "new")
+(version 1)
+`)
+	if err != nil {
+		t.Fatalf("expect redefine version but error: %v", err)
+	}
+	if ret != "new" {
+		t.Fatalf("expect redefined version got new but %v", ret)
+	}
+	fun, _ := g.Lookup("version")
+	if l := len(fun.(Func).Content()); l != 1 {
+		t.Fatalf("expect redefine replace the same sign but got %d overloads", l)
+	}
+}
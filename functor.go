@@ -1,6 +1,7 @@
 package gisp
 
 import (
+	"errors"
 	"fmt"
 
 	p "github.com/Dwarfartisan/goparsec2"
@@ -16,13 +17,24 @@ type Functor interface {
 // ArgsSignChecker 定义函数签名的验证器类型
 type ArgsSignChecker func(args ...interface{}) error
 
-// SignChecker 定义 Parsex 环境下的函数签名验证器
+// SignChecker 定义 Parsex 环境下的函数签名验证器，验证失败时返回 TypeSignError 或 SignError
 func SignChecker(parser p.P) ArgsSignChecker {
 	return func(args ...interface{}) error {
 		st := p.NewBasicState(args)
-		_, err := parser(&st)
+		if _, err := parser(&st); err != nil {
+			return signError(args, err)
+		}
+		return nil
+	}
+}
+
+// signError 把签名解析器的错误归类：某个参数的类型不符时保留 TypeSignError ，参数的个数或
+// 排列不符时返回 SignError
+func signError(params []interface{}, err error) error {
+	if errors.Is(err, ErrTypeSign) {
 		return err
 	}
+	return SignError{Params: params}
 }
 
 // EmptyFunc 定义一个空函数，它用于封装其内含的 functor。
@@ -95,7 +107,7 @@ func (box ExprxBox) Task(env Env, args ...interface{}) (Lisp, error) {
 	}
 	err = box.checker(params...)
 	if err != nil {
-		return nil, fmt.Errorf("Args Type Sign Error: pass %v got error: %v", args, err)
+		return nil, fmt.Errorf("Args Type Sign Error: pass %v got error: %w", args, err)
 	}
 
 	return box.TaskerBox.Task(env, args...)
@@ -115,11 +127,16 @@ func BoxExpr(expr TaskExpr) TaskerBox {
 func (box TaskerBox) Task(env Env, args ...interface{}) (Lisp, error) {
 	task, err := box.functor(env, args...)
 	if err != nil {
-		return nil, fmt.Errorf("Args Type Sign Error: pass %v got error: %v", args, err)
+		return nil, boxError(args, err)
 	}
 	return TaskBox{task}, nil
 }
 
+// boxError 是 TaskerBox 构造 task 失败时报告的错误
+func boxError(args []interface{}, err error) error {
+	return fmt.Errorf("Args Type Sign Error: pass %v got error: %w", args, err)
+}
+
 // EvalBox 定义了对一个 LispExpr 的求值封装
 type EvalBox struct {
 	functor LispExpr
@@ -135,7 +152,7 @@ func (box EvalBox) Task(env Env, args ...interface{}) (Lisp, error) {
 	lisp, err := box.functor(env, args...)
 	if err != nil {
 		//		panic(args[0])
-		return nil, fmt.Errorf("Eval Expr Call Error: pass %v got error: %v", args, err)
+		return nil, fmt.Errorf("Eval Expr Call Error: pass %v got error: %w", args, err)
 	}
 	return lisp, nil
 }
@@ -1,6 +1,7 @@
 package gisp
 
 import (
+	"context"
 	"fmt"
 	"reflect"
 	"sort"
@@ -342,6 +343,8 @@ func (ginq Ginq) Task(env Env, args ...interface{}) (Lisp, error) {
 	for k, v := range ginq.Meta {
 		meta[k] = v
 	}
+	// 每次查询使用自己的本地命名空间，查询中定义的变量和捕获它们的闭包不会在多次查询间共享
+	meta["local"] = map[string]Var{}
 	return GinQ{meta, ginq.queries, l}, nil
 }
 
@@ -352,12 +355,26 @@ type GinQ struct {
 	data    List
 }
 
-// Eval 实现 GinQ 的求值
+// Eval 实现 GinQ 的求值。查询子句中的自由命名与 lambda 一样在构造 ginq 的环境中查找，
+// 所以查询在构造它的 let 或循环结束后执行时，子句中的 lambda 仍然能看到当时的变量。
+// 没有构造环境时在执行查询的环境 env 中查找
 func (ginq GinQ) Eval(env Env) (interface{}, error) {
 	ginq.Meta["global"] = env
+	if closure, ok := ginq.Meta["closure"].(Env); ok {
+		ginq.Meta["global"] = closure
+		if base, ok := closure.(*Gisp); ok {
+			if fork := forkOf(ContextOf(env), base); fork != nil {
+				ginq.Meta["global"] = fork
+			}
+		}
+	}
+	ginq.Meta["context"] = ContextOf(env)
 	var rel interface{} = ginq.data
 	var err error
 	for _, query := range ginq.queries {
+		if err := CheckContext(ginq); err != nil {
+			return nil, err
+		}
 		call := L(query, rel)
 		rel, err = Eval(ginq, call)
 		if err != nil {
@@ -367,6 +384,11 @@ func (ginq GinQ) Eval(env Env) (interface{}, error) {
 	return rel, nil
 }
 
+// Context 实现 Contexter
+func (ginq GinQ) Context() context.Context {
+	return metaContext(ginq.Meta)
+}
+
 // Defvar 实现 Env.Defvar 行为
 func (ginq GinQ) Defvar(name string, slot Var) error {
 	if _, ok := ginq.Local(name); ok {
@@ -379,19 +401,8 @@ func (ginq GinQ) Defvar(name string, slot Var) error {
 
 // Defun 实现 Env.Defun
 func (ginq GinQ) Defun(name string, functor Functor) error {
-	if s, ok := ginq.Local(name); ok {
-		switch slot := s.(type) {
-		case Func:
-			slot.Overload(functor)
-		case Var:
-			return fmt.Errorf("%s defined as a var", name)
-		default:
-			return fmt.Errorf("exists name %s isn't Expr", name)
-		}
-	}
-	local := ginq.Meta["local"].(map[string]interface{})
-	local[name] = NewFunction(name, ginq, functor)
-	return nil
+	local := ginq.Meta["local"].(map[string]Var)
+	return defunLocal(ginq, local, name, functor)
 }
 
 // Setvar 实现 Env.Setvar
@@ -589,6 +600,9 @@ type Selector struct {
 func (sp Selector) Eval(env Env) (interface{}, error) {
 	pool := make(List, len(sp.data))
 	for idx, row := range sp.data {
+		if err := CheckContext(env); err != nil {
+			return nil, err
+		}
 		call := L(sp.fun, Q(row))
 		rev, err := Eval(env, call)
 		if err != nil {
@@ -0,0 +1,19 @@
+package gisp
+
+import (
+	p "github.com/Dwarfartisan/goparsec2"
+)
+
+// Keyword 是 :name 形式的关键字，它求值为自身，用于 &key 参数的命名实参
+type Keyword string
+
+func (kw Keyword) String() string {
+	return ":" + string(kw)
+}
+
+// KeywordParser 解析关键字
+var KeywordParser = p.Do(func(st p.State) interface{} {
+	p.Chr(':').Exec(st)
+	name := atomNameParser().Exec(st)
+	return Keyword(name.(string))
+})
@@ -2,6 +2,8 @@ package gisp
 
 import (
 	"fmt"
+	"reflect"
+	"strings"
 
 	p "github.com/Dwarfartisan/goparsec2"
 )
@@ -14,17 +16,55 @@ type Lambda struct {
 
 // DeclareLambda 构造 Lambda 表达式 (lambda (args...) body)
 func DeclareLambda(env Env, args List, lisps ...interface{}) (*Lambda, error) {
+	return declareLambda(env, map[string]bool{}, args, lisps...)
+}
+
+// declareLambda 允许预先声明一些在运行时才能找到的命名，例如 defun 定义的函数递归调用自身。
+// lambda 记录声明它的环境 env ，函数体中的自由命名在调用时到 env 中查找和赋值，所以闭包
+// 看到的总是外层变量的当前值，多个闭包可以共享同一个外层变量
+func declareLambda(env Env, prepare map[string]bool, args List, lisps ...interface{}) (*Lambda, error) {
+	ret, err := buildLambda(env, prepare, args, lisps...)
+	if err != nil {
+		return nil, err
+	}
+	if engineOf(env) == VM {
+		ret.Meta["chunk"] = compileBody(ret.Meta["formal parameters"].(List), ret.Content)
+	}
+	return ret, nil
+}
+
+// buildLambda 检查并构造 Lambda ，不编译函数体。字节码中的 lambda 使用预先编译好的函数体
+func buildLambda(env Env, prepare map[string]bool, args List, lisps ...interface{}) (*Lambda, error) {
 	ret := Lambda{map[string]interface{}{
 		"category": "lambda",
-		"local":    map[string]interface{}{},
+		"closure":  env,
 	}, List{}}
-	ret.prepareArgs(args)
-	prepare := map[string]bool{}
+	if err := ret.prepareArgs(args); err != nil {
+		return nil, err
+	}
+	declared := map[string]bool{}
+	for key := range prepare {
+		declared[key] = true
+	}
+	for _, formal := range ret.Meta["formal parameters"].(List) {
+		declared[formal.(Atom).Name] = true
+	}
+	for _, arg := range args {
+		if _, ok := arg.(Atom); !ok {
+			patternNames(arg, declared)
+		}
+	}
 	for _, lisp := range lisps {
-		err := ret.prepare(env, prepare, lisp)
+		err := ret.prepare(env, declared, lisp)
 		if err != nil {
 			return nil, err
 		}
+		// 函数体中 var 定义的变量对其后的表达式可见
+		if list, ok := lisp.(List); ok && len(list) > 1 && clauseIs(list, "var") {
+			if name, ok := list[1].(Atom); ok {
+				declared[name.Name] = true
+			}
+		}
 	}
 	return &ret, nil
 }
@@ -38,128 +78,237 @@ func LambdaExpr(env Env, args ...interface{}) (Tasker, error) {
 	}
 	lptr, err := DeclareLambda(env, args[0].(List), args[1:]...)
 	if err != nil {
-		return nil, fmt.Errorf("Lambda Args Error: expect lambda tasker but error: %v", err)
+		return nil, lambdaArgsError(err)
 	}
 	return Q(lptr).Eval, nil
 }
 
-func (lambda *Lambda) prepareArgs(args List) {
+// lambdaArgsError 是 lambda 的参数或函数体不正确时报告的错误
+func lambdaArgsError(err error) error {
+	return fmt.Errorf("Lambda Args Error: expect lambda tasker but error: %w", err)
+}
+
+// prepareArgs 构造形参和参数解析器。形参依次是必需参数、 &optional 之后的可选参数和 &key
+// 之后的命名参数，可选参数和命名参数写作 x 或 (x default) 。必需参数可以是 match 的 List
+// 模式，它匹配一个实参，调用时模式中的变量绑定到 task 中，形参本身以模式的文本为名，不会
+// 与变量重名。最后一个必需参数之后可以写 ... 表示变长参数，它不能与 &optional 和 &key 同用
+func (lambda *Lambda) prepareArgs(args List) error {
 	l := len(args)
-	formals := make(List, len(args))
-	if l == 0 {
-		lambda.Meta["parameters parsex"] = []Var{}
-		return
-	}
-	lidx := l - 1
-	last := args[lidx].(Atom)
 	// variadic function args formal as (last[::Type] ... )
 	isVariadic := false
-	if last.Name == "..." && len(args) > 1 {
+	if l > 1 && clauseWord(args[l-1], "...") {
 		isVariadic = true
+		args = args[:l-1]
+		if _, ok := args[l-2].(Atom); !ok {
+			return fmt.Errorf("lambda args error: variadic parameter must be a atom but %v", args[l-2])
+		}
 	}
 	lambda.Meta["is variadic"] = isVariadic
-	ps := make([]p.P, l+1)
-	for idx, arg := range args[:lidx] {
-		ps[idx] = argParser(arg.(Atom))
-		formals[idx] = arg
+	keyed := false
+	for _, arg := range args {
+		keyed = keyed || clauseWord(arg, "&key")
+	}
+	formals := List{}
+	ps := []p.P{}
+	patterns := map[int]interface{}{}
+	defaults := map[int]interface{}{}
+	keys := []p.P{}
+	required := 0
+	mode := ""
+	closure, _ := lambda.Meta["closure"].(Env)
+	for _, arg := range args {
+		if clauseWord(arg, "...") {
+			return fmt.Errorf("lambda args error: ... must be the last of %v", args)
+		}
+		if clauseWord(arg, "&optional") || clauseWord(arg, "&key") {
+			name := arg.(Atom).Name
+			if isVariadic || mode == "&key" || mode == name {
+				return fmt.Errorf("lambda args error: unexpected %s in %v", name, args)
+			}
+			mode = name
+			continue
+		}
+		idx := len(formals)
+		atom, ok := arg.(Atom)
+		switch {
+		case mode == "" && ok:
+			ps = append(ps, argParser(atom))
+			required++
+		case mode == "":
+			atom = Atom{patternString(arg), ANYMUST}
+			ps = append(ps, patternParser(closure, arg))
+			patterns[idx] = arg
+			required++
+		default:
+			var expr interface{}
+			var err error
+			if atom, expr, err = defaultFormal(arg); err != nil {
+				return err
+			}
+			if expr != nil {
+				defaults[idx] = expr
+			}
+			if mode == "&optional" {
+				ps = append(ps, optionalParser(argParser(atom), keyed))
+			} else {
+				keys = append(keys, argParser(atom))
+			}
+		}
+		formals = append(formals, atom)
+	}
+	if keyed {
+		ps = append(ps, keysParser(formals[len(formals)-len(keys):], keys))
 	}
 	if isVariadic {
-		varArg := args[l-2].(Atom)
-		ps[lidx] = p.Many(argParser(last))
-		larg := Atom{varArg.Name, varArg.Type}
-		formals[lidx] = larg
-	} else {
-		ps[lidx] = argParser(last)
-		formals[lidx] = last
-	}
-	ps[l] = p.EOF
+		ps[len(ps)-1] = p.Many(p.Try(ps[len(ps)-1]))
+	}
+	ps = append(ps, p.EOF)
 	lambda.Meta["formal parameters"] = formals
 	lambda.Meta["parameter parsexs"] = ps
+	lambda.Meta["parameter patterns"] = patterns
+	lambda.Meta["parameter defaults"] = defaults
+	lambda.Meta["required parameters"] = required
+	lambda.Meta["keyword parameters"] = len(keys)
+	return nil
 }
 
-func (lambda *Lambda) prepare(env Env, prepare map[string]bool, content interface{}) error {
-	next := map[string]bool{}
-	for key := range prepare {
-		next[key] = true
-	}
-	var err error
-	switch lisp := content.(type) {
-	case Atom:
-		err = lambda.prepareAtom(env, next, lisp)
+func (lambda *Lambda) prepare(env Env, declared map[string]bool, content interface{}) error {
+	if err := checkNames(env, declared, content); err != nil {
 		return err
-	case List:
-		err = lambda.prepareList(env, next, lisp)
-	}
-	if err == nil {
-		lambda.Content = append(lambda.Content, content)
 	}
-	return err
+	lambda.Content = append(lambda.Content, content)
+	return nil
 }
 
-func (lambda Lambda) prepareAtom(env Env, prepare map[string]bool, one Atom) error {
-	if _, ok := prepare[one.Name]; ok {
-		return nil
-	}
-	next := map[string]bool{}
-	for key := range prepare {
-		next[key] = true
-	}
-
-	for _, arg := range lambda.Meta["formal parameters"].(List) {
-		if (arg.(Atom)).Name == one.Name {
+// checkNames 检查 content 中的命名都已经在 declared 中声明，或者能在 env 中找到，找不到时
+// 返回带有 atom 位置的 NameError 。 declared 是运行时才绑定的命名，例如参数和局部变量
+func checkNames(env Env, declared map[string]bool, content interface{}) error {
+	switch lisp := content.(type) {
+	case Atom:
+		if declared[lisp.Name] {
 			return nil
 		}
-	}
-	if _, ok := prepare[one.Name]; !ok {
-		if v, ok := env.Lookup(one.Name); ok {
-			local := (lambda.Meta["local"]).(map[string]interface{})
-			local[one.Name] = v
-		} else {
-			return fmt.Errorf("%s not found", one.Name)
+		if _, ok := env.Lookup(lisp.Name); !ok {
+			return NameError{lisp.Name}
+		}
+	case List:
+		if clauseIs(lisp, "quote") {
+			return nil
+		}
+		next, err := scopeOf(declared, lisp)
+		if err != nil {
+			span, _ := SpanOf(lisp)
+			return withSpan(span, err)
+		}
+		for idx, item := range lisp {
+			if err := checkNames(env, next, item); err != nil {
+				span := lisp.itemSpan(idx)
+				if !span.IsValid() {
+					span, _ = SpanOf(lisp)
+				}
+				return withSpan(span, err)
+			}
+		}
+	case Dict:
+		for _, item := range lisp {
+			if err := checkNames(env, declared, item); err != nil {
+				return err
+			}
 		}
 	}
 	return nil
 }
 
-func (lambda Lambda) prepareList(env Env, prepare map[string]bool, content List) error {
+// scopeOf 给出 list 及其子表达式中可见的命名，即 declared 加上 list 这个特殊形式绑定的
+// 命名。特殊形式的结构不能绑定命名时返回错误
+func scopeOf(declared map[string]bool, list List) (map[string]bool, error) {
 	next := map[string]bool{}
-	for key := range prepare {
+	for key := range declared {
 		next[key] = true
 	}
-	var err error
-	fun := content[0].(Atom)
+	if len(list) == 0 {
+		return next, nil
+	}
+	fun, ok := list[0].(Atom)
+	if !ok {
+		return next, nil
+	}
 	switch fun.Name {
 	case "var":
-		name := content[1].(string)
-		if err != nil {
-			return err
+		if len(list) < 2 {
+			return nil, fmt.Errorf("var form error: expect (var name [value]) but %v", list)
 		}
-		next[name] = true
+		name, ok := list[1].(Atom)
+		if !ok {
+			return nil, fmt.Errorf("var form error: expect a atom name but %v", list[1])
+		}
+		next[name.Name] = true
 	case "lambda":
-		args := content[1].(List)
-		for _, a := range args {
-			arg := a.(Atom)
-			next[arg.Name] = true
+		if len(list) < 2 {
+			return nil, fmt.Errorf("lambda form error: expect (lambda (args...) body...) but %v", list)
+		}
+		patternNames(list[1], next)
+	case "try":
+		next["catch"] = true
+		next["finally"] = true
+	case "catch":
+		if len(list) > 1 {
+			if name, ok := list[1].(Atom); ok {
+				next[name.Name] = true
+			}
+		}
+	case "defun", "defmacro":
+		if len(list) < 3 {
+			return nil, fmt.Errorf("%s form error: expect (%s name (args...) body...) but %v",
+				fun.Name, fun.Name, list)
+		}
+		name, ok := list[1].(Atom)
+		if !ok {
+			return nil, fmt.Errorf("%s form error: expect a atom name but %v", fun.Name, list[1])
+		}
+		next[name.Name] = true
+		patternNames(list[2], next)
+	case "dotimes", "for":
+		if len(list) < 2 {
+			return nil, fmt.Errorf("%s form error: expect (%s (vars... expr) body...) but %v",
+				fun.Name, fun.Name, list)
+		}
+		if head, ok := list[1].(List); ok && len(head) > 0 {
+			for _, v := range head[:len(head)-1] {
+				if arg, ok := v.(Atom); ok {
+					next[arg.Name] = true
+				}
+			}
+		}
+	case "match":
+		if len(list) < 2 {
+			return nil, fmt.Errorf("match form error: expect (match expr clauses...) but %v", list)
+		}
+		for _, c := range list[2:] {
+			if clause, ok := c.(List); ok && len(clause) > 0 {
+				patternNames(clause[0], next)
+			}
 		}
 	case "let":
-		for _, def := range content[1].(List) {
-			define := def.(List)
-			name := define[0].(string)
-			next[name] = true
+		if len(list) < 2 {
+			return nil, fmt.Errorf("let form error: expect (let ((name value)...) body...) but %v", list)
 		}
-	}
-	for _, l := range content {
-		switch lisp := l.(type) {
-		case List:
-			err = lambda.prepareList(env, next, lisp)
-		case Atom:
-			err = lambda.prepareAtom(env, next, lisp)
+		defs, ok := list[1].(List)
+		if !ok {
+			return nil, fmt.Errorf("let form error: expect a bindings list but %v", list[1])
+		}
+		for _, def := range defs {
+			binding, ok := def.(List)
+			if !ok || len(binding) == 0 {
+				return nil, fmt.Errorf("let form error: expect (name value) but %v", def)
+			}
+			patternNames(binding[0], next)
 		}
 	}
-	return err
+	return next, nil
 }
 
-// TypeSign 生成反射类型签名
+// TypeSign 生成反射类型签名，依次是必需参数、可选参数和命名参数的类型
 func (lambda Lambda) TypeSign() []Type {
 	formals := lambda.Meta["formal parameters"].(List)
 	types := make([]Type, len(formals))
@@ -169,37 +318,212 @@ func (lambda Lambda) TypeSign() []Type {
 	return types
 }
 
+// signRanks 给出按 n 个实参展开签名后每个位置的具体程度（见 typeRank），变长参数的类型覆盖
+// 其余所有实参，命名参数的实参位置为 0 ；最后追加一位表示参数个数固定的签名比带变长、可选
+// 或命名参数的签名更具体
+func (lambda Lambda) signRanks(n int) []int {
+	types := lambda.TypeSign()
+	positional := len(types) - lambda.keywords()
+	ranks := make([]int, n+1)
+	for idx := 0; idx < n; idx++ {
+		switch {
+		case idx < positional:
+			ranks[idx] = typeRank(types[idx])
+		case lambda.IsVariadic():
+			ranks[idx] = typeRank(types[len(types)-1])
+		}
+	}
+	if !lambda.IsVariadic() && lambda.required() == len(types) {
+		ranks[n] = 1
+	}
+	return ranks
+}
+
+// sameSign 判断两个 lambda 的签名是否完全一致
+func (lambda Lambda) sameSign(other Lambda) bool {
+	return lambda.IsVariadic() == other.IsVariadic() &&
+		lambda.required() == other.required() &&
+		reflect.DeepEqual(lambda.TypeSign(), other.TypeSign()) &&
+		reflect.DeepEqual(lambda.keywordNames(), other.keywordNames())
+}
+
+// ParamKind 表示形式参数的种类
+type ParamKind int
+
+const (
+	// ParamRequired 是必需的位置参数
+	ParamRequired ParamKind = iota
+	// ParamOptional 是 &optional 之后的可选参数
+	ParamOptional
+	// ParamKeyword 是 &key 之后的命名参数，以 :name value 传入
+	ParamKeyword
+	// ParamVariadic 是以 ... 结尾的变长参数
+	ParamVariadic
+)
+
+func (kind ParamKind) String() string {
+	switch kind {
+	case ParamOptional:
+		return "&optional"
+	case ParamKeyword:
+		return "&key"
+	case ParamVariadic:
+		return "..."
+	}
+	return "required"
+}
+
+// Param 描述 lambda 的一个形式参数， Default 是可选参数或命名参数的默认值表达式，没有时为 nil
+type Param struct {
+	Name    string
+	Type    Type
+	Kind    ParamKind
+	Default interface{}
+}
+
+// Signature 依次给出 lambda 的形式参数，包括参数的种类、命名参数的名字和默认值
+func (lambda Lambda) Signature() []Param {
+	formals := lambda.Meta["formal parameters"].(List)
+	defaults, _ := lambda.Meta["parameter defaults"].(map[int]interface{})
+	required := lambda.required()
+	keys := len(formals) - lambda.keywords()
+	params := make([]Param, len(formals))
+	for idx, formal := range formals {
+		atom := formal.(Atom)
+		kind := ParamRequired
+		switch {
+		case idx == len(formals)-1 && lambda.IsVariadic():
+			kind = ParamVariadic
+		case idx >= keys:
+			kind = ParamKeyword
+		case idx >= required:
+			kind = ParamOptional
+		}
+		params[idx] = Param{atom.Name, atom.Type, kind, defaults[idx]}
+	}
+	return params
+}
+
+// SignString 以 gisp 的形式输出签名，如 (a::int &optional b::float &key c::string)
+func (lambda Lambda) SignString() string {
+	frags := []string{}
+	last := ParamRequired
+	for _, param := range lambda.Signature() {
+		if param.Kind != last && param.Kind != ParamVariadic {
+			frags = append(frags, param.Kind.String())
+		}
+		last = param.Kind
+		frags = append(frags, Atom{param.Name, param.Type}.String())
+	}
+	if lambda.IsVariadic() {
+		frags = append(frags, "...")
+	}
+	return fmt.Sprintf("(%s)", strings.Join(frags, " "))
+}
+
 // MatchArgsSign 校验参数是否匹配
 func (lambda Lambda) MatchArgsSign(env Env, args ...interface{}) (interface{}, error) {
-	params := make([]interface{}, len(args))
-	for idx, arg := range args {
-		param, err := Eval(env, arg)
-		if err != nil {
-			return nil, err
-		}
-		params[idx] = param
+	params, err := Evals(env, args...)
+	if err != nil {
+		return nil, err
 	}
+	return lambda.matchParams(params)
+}
+
+// matchParams 校验已经求值的参数是否匹配签名，匹配成功时返回绑定好的实参，命名参数按形参
+// 的顺序展开，没有传入的可选参数和命名参数在 task 执行时绑定默认值
+func (lambda Lambda) matchParams(params []interface{}) (interface{}, error) {
 	pxs := lambda.Meta["parameter parsexs"].([]p.P)
 	st := p.NewBasicState(params)
-	return p.UnionAll(pxs...)(&st)
+	actuals, err := p.UnionAll(pxs...)(&st)
+	if err != nil || lambda.keywords() == 0 {
+		return actuals, err
+	}
+	items := actuals.([]interface{})
+	at := len(lambda.Meta["formal parameters"].(List)) - lambda.keywords()
+	spliced := append([]interface{}{}, items[:at]...)
+	spliced = append(spliced, items[at].([]interface{})...)
+	return append(spliced, items[at+1:]...), nil
+}
+
+// IsVariadic 指示 lambda 的最后一个参数是否是变长参数
+func (lambda Lambda) IsVariadic() bool {
+	return lambda.Meta["is variadic"].(bool)
+}
+
+// required 给出必需参数的个数
+func (lambda Lambda) required() int {
+	if required, ok := lambda.Meta["required parameters"].(int); ok {
+		return required
+	}
+	return len(lambda.Meta["formal parameters"].(List))
+}
+
+// keywords 给出命名参数的个数
+func (lambda Lambda) keywords() int {
+	keys, _ := lambda.Meta["keyword parameters"].(int)
+	return keys
+}
+
+// keywordNames 给出命名参数的名字
+func (lambda Lambda) keywordNames() []string {
+	formals := lambda.Meta["formal parameters"].(List)
+	names := []string{}
+	for _, formal := range formals[len(formals)-lambda.keywords():] {
+		names = append(names, formal.(Atom).Name)
+	}
+	return names
+}
+
+// acceptArity 判断 lambda 能否接受 n 个参数
+func (lambda Lambda) acceptArity(n int) bool {
+	l := len(lambda.Meta["formal parameters"].(List))
+	if lambda.IsVariadic() {
+		return n >= l-1
+	}
+	if keys := lambda.keywords(); keys > 0 {
+		return n >= lambda.required() && n <= l+keys
+	}
+	return n >= lambda.required() && n <= l
 }
 
 // Task create a lambda s-Expr can be eval
 func (lambda Lambda) Task(env Env, args ...interface{}) (Lisp, error) {
-	meta := map[string]interface{}{}
-	for k, v := range lambda.Meta {
-		meta[k] = v
-	}
-	actuals, err := lambda.MatchArgsSign(env, args...)
+	params, err := Evals(env, args...)
 	if err != nil {
 		return Nil{}, err
 	}
-	meta["actual parameters"] = actuals
-	meta["my"] = map[string]Var{}
-	l := len(lambda.Content)
-	content := make([]interface{}, l)
-	for idx, data := range lambda.Content {
-		content[idx] = data
+	return lambda.taskParams(params)
+}
+
+// taskParams 以已经求值的实参构造调用
+func (lambda Lambda) taskParams(params []interface{}) (Lisp, error) {
+	actuals, err := lambda.matchParams(params)
+	if err != nil {
+		if !lambda.acceptArity(len(params)) {
+			return Nil{}, ArityError{"lambda", len(params)}
+		}
+		return Nil{}, SignError{"lambda", params}
+	}
+	return lambda.task("lambda", actuals), nil
+}
+
+// task 用匹配好的实参构造可执行的 Task ， name 是错误调用栈中显示的函数名
+func (lambda Lambda) task(name string, actuals interface{}) *Task {
+	meta := map[string]interface{}{
+		"name":              name,
+		"actual parameters": actuals,
+	}
+	my := map[string]Var{}
+	patterns, _ := lambda.Meta["parameter patterns"].(map[int]interface{})
+	for idx := range patterns {
+		// 解析参数时已经匹配并绑定了模式中的变量
+		if slot, ok := actuals.([]interface{})[idx].(patternVar); ok {
+			for name, v := range slot.bound {
+				my[name] = v
+			}
+		}
 	}
-	return &Task{meta, content}, nil
+	meta["my"] = my
+	return &Task{meta, lambda.Content, lambda.Meta}
 }
@@ -1,9 +1,8 @@
 package gisp
 
 import (
+	"context"
 	"fmt"
-
-	p "github.com/Dwarfartisan/goparsec2"
 )
 
 // Let 实现 let 环境
@@ -14,63 +13,139 @@ type Let struct {
 
 // LetFunc 构造一个 Let 环境
 func LetFunc(env Env, args ...interface{}) (Lisp, error) {
-	st := p.NewBasicState(args)
-	_, err := TypeAs(LIST)(&st)
-	if err != nil {
-		return nil, fmt.Errorf("Let Args Error: expect args list but error: %v", err)
+	if err := checkLet(args); err != nil {
+		return nil, fmt.Errorf("Let Args Error: %w", err)
 	}
+	return bindLet(env, args)
+}
+
+// LetExpr 将 let => (let ((a, value), (b, value)...) ...) 形式构造为一个 let 环境
+func LetExpr(env Env, args ...interface{}) (Tasker, error) {
+	if err := checkLet(args); err != nil {
+		return nil, err
+	}
+	return func(env Env) (interface{}, error) {
+		let, err := bindLet(env, args)
+		if err != nil {
+			return nil, err
+		}
+		return let.Eval(env)
+	}, nil
+}
 
+func checkLet(args []interface{}) error {
+	if len(args) < 1 {
+		return fmt.Errorf("let args error: expect vars list at last but a empty let as (let )")
+	}
+	defs, ok := args[0].(List)
+	if !ok {
+		return fmt.Errorf("let args error: expect vars list but %v", args[0])
+	}
+	for _, def := range defs {
+		if binding, ok := def.(List); !ok || len(binding) != 2 {
+			return fmt.Errorf("let args error: expect binding as (var value) but %v", def)
+		}
+	}
+	return nil
+}
+
+// bindLet 在 env 中对 let 的变量求值，构造 let 环境。变量可以是 match 的 List 模式，值与
+// 模式不匹配时返回错误
+func bindLet(env Env, args []interface{}) (Let, error) {
 	local := map[string]Var{}
-	vars := args[0].(List)
-	for _, v := range vars {
+	for _, v := range args[0].(List) {
 		declares := v.(List)
-		varb := declares[0].(Atom)
-		slot := VarSlot(varb.Type)
-		value, err := Eval(env, (declares[1]))
+		value, err := Eval(env, declares[1])
 		if err != nil {
-			return nil, err
+			return Let{}, err
+		}
+		if err := bindTarget(env, declares[0], value, local); err != nil {
+			return Let{}, err
 		}
-		slot.Set(value)
-		local[varb.Name] = slot
 	}
 	meta := map[string]interface{}{
 		"local": local,
 	}
-	let := Let{meta, args}
-	return let, nil
+	return Let{meta, args[1:]}, nil
 }
 
-// LetExpr 将 let => (let ((a, value), (b, value)...) ...) 形式构造为一个 let 环境
-func LetExpr(env Env, args ...interface{}) (Tasker, error) {
-	var (
-		vars List
-		ok   bool
-	)
-	if len(args) < 1 {
-		return nil, fmt.Errorf("let args error: expect vars list at last but a empty let as (let )")
+// bindTarget 把 value 绑定到 let 的变量或模式 target ，绑定的变量写入 local
+func bindTarget(env Env, target interface{}, value interface{}, local map[string]Var) error {
+	varb, ok := target.(Atom)
+	if !ok {
+		ok, err := matchPattern(env, target, value, local)
+		if err != nil {
+			return err
+		}
+		if !ok {
+			return fmt.Errorf("let binding error: %v not match pattern %s", value, patternString(target))
+		}
+		return nil
 	}
-	if vars, ok = args[0].(List); !ok {
-		return nil, fmt.Errorf("let args error: expect vars list but %v", args[0])
+	slot := VarSlot(varb.Type)
+	slot.Set(value)
+	local[varb.Name] = slot
+	return nil
+}
+
+// letBindings 拆分结构正确的 let 变量表，给出变量或模式以及对应的值表达式
+func letBindings(args []interface{}) (List, []interface{}, bool) {
+	if checkLet(args) != nil {
+		return nil, nil, false
 	}
-	return func(env Env) (interface{}, error) {
-		local := map[string]Var{}
-		for _, v := range vars {
-			declares := v.(List)
-			varb := declares[0].(Atom)
-			slot := VarSlot(varb.Type)
-			value, err := Eval(env, (declares[1]))
-			if err != nil {
-				return nil, err
-			}
-			slot.Set(value)
-			local[varb.Name] = slot
-		}
-		meta := map[string]interface{}{
-			"local": local,
+	defs := args[0].(List)
+	targets := make(List, len(defs))
+	values := make([]interface{}, len(defs))
+	for idx, def := range defs {
+		binding := def.(List)
+		targets[idx], values[idx] = binding[0], binding[1]
+	}
+	return targets, values, true
+}
+
+// letScope 把 values 依次绑定到 targets ，构造 env 中的 let 作用域，字节码据此进入 let 、
+// 循环和 catch 的作用域
+func letScope(env Env, targets List, values []interface{}) (Let, error) {
+	local := map[string]Var{}
+	for idx, target := range targets {
+		if err := bindTarget(env, target, values[idx], local); err != nil {
+			return Let{}, err
 		}
-		let := Let{meta, args[1:]}
-		return let.Eval(env)
-	}, nil
+	}
+	return Let{map[string]interface{}{
+		"local":   local,
+		"global":  env,
+		"context": ContextOf(env),
+	}, List{}}, nil
+}
+
+// letForm 实现 let 特殊形式，它是独立的类型，尾调用据此识别 let 并在尾位置上对函数体求值
+type letForm struct{}
+
+// Task 实现 Functor
+func (lf letForm) Task(env Env, args ...interface{}) (Lisp, error) {
+	task, err := LetExpr(env, args...)
+	if err != nil {
+		return nil, fmt.Errorf("Args Type Sign Error: pass %v got error: %w", args, err)
+	}
+	return TaskBox{task}, nil
+}
+
+// let 检查参数并构造 let 环境
+func (lf letForm) let(env Env, args ...interface{}) (Let, error) {
+	if err := checkLet(args); err != nil {
+		return Let{}, fmt.Errorf("Args Type Sign Error: pass %v got error: %w", args, err)
+	}
+	return bindLet(env, args)
+}
+
+// evalTail 在尾位置上对 let 的函数体求值
+func (lf letForm) evalTail(env Env, args ...interface{}) (interface{}, *tailCall, error) {
+	let, err := lf.let(env, args...)
+	if err != nil {
+		return nil, nil, err
+	}
+	return let.evalTail(env)
 }
 
 // Defvar 实现 Env.Defvar
@@ -85,24 +160,16 @@ func (let Let) Defvar(name string, slot Var) error {
 
 // Defun 实现 Env.Defun
 func (let Let) Defun(name string, functor Functor) error {
-	if s, ok := let.Local(name); ok {
-		switch slot := s.(type) {
-		case Func:
-			slot.Overload(functor)
-		case Var:
-			return fmt.Errorf("%s defined as a var", name)
-		default:
-			return fmt.Errorf("exists name %s isn't Expr", name)
-		}
-	}
-	local := let.Meta["local"].(map[string]interface{})
-	local[name] = NewFunction(name, let, functor)
-	return nil
+	local := let.Meta["local"].(map[string]Var)
+	return defunLocal(let, local, name, functor)
 }
 
 // Setvar 实现 Env.Setvar
 func (let Let) Setvar(name string, value interface{}) error {
-	if _, ok := let.Local(name); ok {
+	if v, ok := let.Local(name); ok {
+		if _, ok := v.(Func); ok {
+			return fmt.Errorf("%v is a Expr", name)
+		}
 		local := let.Meta["local"].(map[string]Var)
 		local[name].Set(value)
 		return nil
@@ -135,23 +202,36 @@ func (let Let) Global(name string) (interface{}, bool) {
 	return global.Lookup(name)
 }
 
+// Context 实现 Contexter
+func (let Let) Context() context.Context {
+	return metaContext(let.Meta)
+}
+
 // Eval 实现 Lisp.Eval
 func (let Let) Eval(env Env) (interface{}, error) {
+	value, call, err := let.evalTail(env)
+	if err != nil {
+		return nil, err
+	}
+	if call != nil {
+		return call.eval()
+	}
+	return value, nil
+}
+
+// evalTail 在尾位置上对 let 的函数体求值，最后一个表达式中的 Lambda 调用作为 tailCall 返回
+func (let Let) evalTail(env Env) (interface{}, *tailCall, error) {
 	let.Meta["global"] = env
+	let.Meta["context"] = ContextOf(env)
 	l := len(let.Content)
-	switch l {
-	case 0:
-		return nil, nil
-	case 1:
-		return Eval(let, let.Content[0])
-	default:
-		for _, Expr := range let.Content[:l-1] {
-			_, err := Eval(let, Expr)
-			if err != nil {
-				return nil, err
-			}
+	if l == 0 {
+		return nil, nil, nil
+	}
+	for _, Expr := range let.Content[:l-1] {
+		_, err := Eval(let, Expr)
+		if err != nil {
+			return nil, nil, err
 		}
-		Expr := let.Content[l-1]
-		return Eval(let, Expr)
 	}
+	return evalTail(let, let.Content[l-1])
 }
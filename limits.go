@@ -0,0 +1,121 @@
+package gisp
+
+import (
+	"context"
+	"fmt"
+	"sync/atomic"
+)
+
+// Limits 定义一次求值的预算，值为 0 的项不做限制
+type Limits struct {
+	// MaxSteps 限制 List.Eval 的调用次数
+	MaxSteps int
+	// MaxDepth 限制 Task （ lambda 、 defun ）调用的嵌套深度，尾调用不增加深度
+	MaxDepth int
+	// MaxListLen 限制求值结果中 List 的长度
+	MaxListLen int
+	// MaxStringLen 限制求值结果中字符串的字节长度
+	MaxStringLen int
+}
+
+// LimitExceeded 表示求值超出了 Limits 中的某一项预算， Limit 是该项的名字
+type LimitExceeded struct {
+	Limit string
+	Max   int
+}
+
+func (err LimitExceeded) Error() string {
+	return fmt.Sprintf("limit exceeded: %s %d", err.Limit, err.Max)
+}
+
+// budget 记录一次求值过程中已经消耗的预算，它随 context 传递给所有的内层环境
+type budget struct {
+	limits Limits
+	steps  int64
+	depth  int64
+}
+
+type budgetKey struct{}
+
+func budgetOf(ctx context.Context) *budget {
+	b, _ := ctx.Value(budgetKey{}).(*budget)
+	return b
+}
+
+func (b *budget) step() error {
+	if b.limits.MaxSteps > 0 && atomic.AddInt64(&b.steps, 1) > int64(b.limits.MaxSteps) {
+		return LimitExceeded{"max steps", b.limits.MaxSteps}
+	}
+	return nil
+}
+
+func (b *budget) enter() error {
+	depth := atomic.AddInt64(&b.depth, 1)
+	if b.limits.MaxDepth > 0 && depth > int64(b.limits.MaxDepth) {
+		atomic.AddInt64(&b.depth, -1)
+		return LimitExceeded{"max depth", b.limits.MaxDepth}
+	}
+	return nil
+}
+
+func (b *budget) leave() {
+	atomic.AddInt64(&b.depth, -1)
+}
+
+func (b *budget) check(value interface{}) error {
+	switch v := value.(type) {
+	case List:
+		if b.limits.MaxListLen > 0 && len(v) > b.limits.MaxListLen {
+			return LimitExceeded{"max list length", b.limits.MaxListLen}
+		}
+	case []interface{}:
+		if b.limits.MaxListLen > 0 && len(v) > b.limits.MaxListLen {
+			return LimitExceeded{"max list length", b.limits.MaxListLen}
+		}
+	case string:
+		if b.limits.MaxStringLen > 0 && len(v) > b.limits.MaxStringLen {
+			return LimitExceeded{"max string length", b.limits.MaxStringLen}
+		}
+	}
+	return nil
+}
+
+// evalStep 在每次 List.Eval 之前检查 context 和步数预算
+func evalStep(env Env) error {
+	ctx := ContextOf(env)
+	if err := ctx.Err(); err != nil {
+		return ContextError{err}
+	}
+	if b := budgetOf(ctx); b != nil {
+		return b.step()
+	}
+	return nil
+}
+
+// checkResult 检查求值结果是否超出长度预算
+func checkResult(env Env, value interface{}) error {
+	if b := budgetOf(ContextOf(env)); b != nil {
+		return b.check(value)
+	}
+	return nil
+}
+
+// checkListLen 在构造长度为 n 的 List 之前检查长度预算
+func checkListLen(env Env, n uint64) error {
+	if b := budgetOf(ContextOf(env)); b != nil && b.limits.MaxListLen > 0 && n > uint64(b.limits.MaxListLen) {
+		return LimitExceeded{"max list length", b.limits.MaxListLen}
+	}
+	return nil
+}
+
+// enterTask 在 Task 求值前检查调用深度，成功时返回的 leave 用于退出时归还深度
+func enterTask(env Env) (func(), error) {
+	b := budgetOf(ContextOf(env))
+	if b == nil {
+		return func() {}, nil
+	}
+	if err := b.enter(); err != nil {
+		return nil, err
+	}
+	return b.leave, nil
+}
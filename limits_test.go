@@ -0,0 +1,72 @@
+package gisp
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func expectLimit(t *testing.T, err error, limit string) {
+	var le LimitExceeded
+	if !errors.As(err, &le) {
+		t.Fatalf("expect LimitExceeded %s but %v", limit, err)
+	}
+	if le.Limit != limit {
+		t.Fatalf("expect limit %s exceeded but %s", limit, le.Limit)
+	}
+}
+
+func TestLimitSteps(t *testing.T) {
+	g := testGisp()
+	g.SetLimits(Limits{MaxSteps: 100})
+	_, err := g.Parse("(defun forever (n) (forever n))")
+	if err != nil {
+		t.Fatalf("expect defun forever but error: %v", err)
+	}
+	_, err = g.Parse("(forever 1)")
+	expectLimit(t, err, "max steps")
+	// 每次 Parse 得到新的预算
+	ret, err := g.Parse("(+ 1 2)")
+	if err != nil || ret != Int(3) {
+		t.Fatalf("expect 3 with a fresh budget but got %v, %v", ret, err)
+	}
+}
+
+func TestLimitDepth(t *testing.T) {
+	g := testGisp()
+	g.SetLimits(Limits{MaxDepth: 10})
+	_, err := g.Parse(`
+	(defun forever (n) (forever (forever n)))
+	(defun inc (n) (+ n 1))
+	(defun inc2 (n) (inc (inc n)))`)
+	if err != nil {
+		t.Fatalf("expect defun functions but error: %v", err)
+	}
+	ret, err := g.Parse("(inc2 1)")
+	if err != nil || ret != Int(3) {
+		t.Fatalf("expect (inc2 1) within depth got 3 but %v, %v", ret, err)
+	}
+	_, err = g.Parse("(forever 1)")
+	expectLimit(t, err, "max depth")
+}
+
+func TestLimitLength(t *testing.T) {
+	g := testGisp()
+	g.SetLimits(Limits{MaxListLen: 3, MaxStringLen: 5})
+	g.DefAs("dup", reflect.ValueOf(func(s string, n Int) string {
+		return strings.Repeat(s, int(n))
+	}))
+	_, err := g.Parse("(defun five () `(1 2 3 4 5))")
+	if err != nil {
+		t.Fatalf("expect defun five but error: %v", err)
+	}
+	_, err = g.Parse("(five)")
+	expectLimit(t, err, "max list length")
+	ret, err := g.Parse(`(dup "ab" 2)`)
+	if err != nil || ret != "abab" {
+		t.Fatalf("expect abab but %v, %v", ret, err)
+	}
+	_, err = g.Parse(`(dup "ab" 3)`)
+	expectLimit(t, err, "max string length")
+}
@@ -18,18 +18,49 @@ func (list List) String() string {
 	return fmt.Sprintf("(%s)", body)
 }
 
-// Eval 实现 Lisp.Eval 方法
+// Eval 实现 Lisp.Eval 方法，每次求值都会消耗一步预算，结果受 Limits 的长度限制，
+// 错误会附上 list 的源码位置
 func (list List) Eval(env Env) (interface{}, error) {
-	l := len(list)
-	if l == 0 {
+	return list.evalWith(env, list.eval)
+}
+
+// evalWith 以 eval 对 list 求值，检查结果的长度并给错误附上 list 的源码位置
+func (list List) evalWith(env Env, eval Tasker) (interface{}, error) {
+	value, err := eval(env)
+	if err == nil {
+		err = checkResult(env, value)
+	}
+	if err != nil {
+		return nil, withSpan(list.errSpan(err), err)
+	}
+	return value, nil
+}
+
+func (list List) eval(env Env) (interface{}, error) {
+	if err := evalStep(env); err != nil {
+		return nil, err
+	}
+	if info := list.compiled(); info != nil {
+		return info.code(env)
+	}
+	if len(list) == 0 {
 		return nil, nil
 	}
+	lisp, err := list.callee(env)
+	if err != nil {
+		return nil, err
+	}
+	return list.call(env, lisp)
+}
+
+// callee 求出 list 头部的可调用对象
+func (list List) callee(env Env) (interface{}, error) {
 	var lisp interface{}
 	switch fun := list[0].(type) {
 	case Atom:
 		var ok bool
 		if lisp, ok = env.Lookup(fun.Name); !ok {
-			return nil, fmt.Errorf("any callable named %s not found", fun.Name)
+			return nil, NameError{fun.Name}
 		}
 	case List:
 		var err error
@@ -50,6 +81,11 @@ func (list List) Eval(env Env) (interface{}, error) {
 			lisp = fun
 		}
 	}
+	return lisp, nil
+}
+
+// call 以 list 的其余元素为参数调用 lisp
+func (list List) call(env Env, lisp interface{}) (interface{}, error) {
 	switch item := lisp.(type) {
 	case TaskExpr:
 		task, err := item(env, list[1:]...)
@@ -106,17 +142,7 @@ func (list List) Eval(env Env) (interface{}, error) {
 			if err != nil {
 				return nil, err
 			}
-			values := make([]reflect.Value, len(args))
-			for idx, arg := range args {
-				values[idx] = reflect.ValueOf(arg)
-			}
-			var revs []reflect.Value
-			if value.Type().IsVariadic() {
-				revs = value.CallSlice(values)
-			} else {
-				revs = value.Call(values)
-			}
-			res, err := InReflects(revs)
+			res, err := callReflect(value, args)
 			if err != nil {
 				return nil, err
 			}
@@ -130,31 +156,105 @@ func (list List) Eval(env Env) (interface{}, error) {
 		if err != nil {
 			return nil, err
 		}
-		values := make([]reflect.Value, len(args))
-		for idx, arg := range args {
-			values[idx] = reflect.ValueOf(arg)
-		}
-		var revs []reflect.Value
-		if item.Type().IsVariadic() {
-			revs = item.CallSlice(values)
-		} else {
-			revs = item.Call(values)
-		}
-		res, err := InReflects(revs)
+		return callValue(env, item, args)
+	}
+	return nil, fmt.Errorf("List %v Eval Error: %v(%v):%v is't callable",
+		list, list[0], lisp, reflect.TypeOf(lisp))
+}
+
+// isStrict 判断 callee 是否对实参求值后再调用，即 Function 、 Lambda 和 Go 函数，
+// 其它可调用对象（特殊形式）接收未求值的参数
+func isStrict(callee interface{}) bool {
+	switch item := callee.(type) {
+	case *Function, *Lambda:
+		return true
+	case reflect.Value:
+		return item.Kind() == reflect.Func
+	}
+	return false
+}
+
+// callStrict 以已经求值的实参 args 调用 isStrict 的 callee
+func callStrict(env Env, callee interface{}, args []interface{}) (interface{}, error) {
+	switch item := callee.(type) {
+	case *Function:
+		task, err := item.taskParams(env, args)
 		if err != nil {
 			return nil, err
 		}
-		data, err := Evals(env, res...)
+		return task.Eval(env)
+	case *Lambda:
+		task, err := item.taskParams(args)
 		if err != nil {
 			return nil, err
 		}
-		if len(data) == 1 {
-			return data[0], nil
+		return task.Eval(env)
+	case reflect.Value:
+		return callValue(env, item, args)
+	}
+	return nil, fmt.Errorf("%v(%v) is't a function", callee, reflect.TypeOf(callee))
+}
+
+// applyValue 以已经求值的实参 args 调用任意可调用的 fn ，除 isStrict 的对象外， Toolkit 中的
+// Functor 等形式收到的是引用后的实参。以名字引用时 TaskExpr 会被直接求值，这时可以写作
+// 'name ， fn 为 Atom 时在 env 中查找它的定义
+func applyValue(env Env, fn interface{}, args []interface{}) (interface{}, error) {
+	if atom, ok := fn.(Atom); ok {
+		slot, ok := env.Lookup(atom.Name)
+		if !ok {
+			return nil, NameError{atom.Name}
 		}
-		return data, nil
+		if v, ok := slot.(Var); ok {
+			slot = v.Get()
+		}
+		fn = slot
 	}
-	return nil, fmt.Errorf("List %v Eval Error: %v(%v):%v is't callable",
-		list, list[0], lisp, reflect.TypeOf(lisp))
+	if isStrict(fn) {
+		return callStrict(env, fn, args)
+	}
+	call := List{fn}
+	for _, arg := range args {
+		call = append(call, Q(arg))
+	}
+	return call.call(env, fn)
+}
+
+// callValue 调用作为 list 头部的 Go 函数，返回值会再求值一次，只有一个返回值时直接返回它
+func callValue(env Env, fn reflect.Value, args []interface{}) (interface{}, error) {
+	res, err := callReflect(fn, args)
+	if err != nil {
+		return nil, err
+	}
+	data, err := Evals(env, res...)
+	if err != nil {
+		return nil, err
+	}
+	if len(data) == 1 {
+		return data[0], nil
+	}
+	return data, nil
+}
+
+// callReflect 以 args 调用 Go 函数 fn 并转换返回值，调用中的 panic （参数个数或类型错误、
+// 空指针等）被恢复为 PanicError
+func callReflect(fn reflect.Value, args []interface{}) (res []interface{}, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			res = nil
+			err = PanicError{fn.Type().String(), args, r}
+		}
+	}()
+	values := make([]reflect.Value, len(args))
+	for idx, arg := range args {
+		values[idx] = reflect.ValueOf(arg)
+	}
+	var revs []reflect.Value
+	if fn.Type().IsVariadic() {
+		revs = fn.CallSlice(values)
+	} else {
+		revs = fn.Call(values)
+	}
+	return InReflects(revs)
 }
 
 func (list List) indexn(index Int) interface{} {
@@ -177,12 +277,16 @@ func (list List) Anchor(index Int) (interface{}, error) {
 
 // IndexIs 将负索引正规化， 返回正负索引对应的正规化索引[0, length)。如果索引index不在[-length, length)的范围内，返回－1
 func (list List) IndexIs(index Int) int {
+	return indexIs(index, len(list))
+}
+
+// indexIs 是 IndexIs 对任意长度为 ll 的序列的版本
+func indexIs(index Int, ll int) int {
 	idx := int(index)
-	ll := len(list)
-	if 0 <= idx || idx < ll {
+	if 0 <= idx && idx < ll {
 		return idx
 	}
-	if -ll <= idx || idx < 0 {
+	if -ll <= idx && idx < 0 {
 		return ll + idx
 	}
 	return -1
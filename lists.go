@@ -0,0 +1,229 @@
+package gisp
+
+import (
+	"fmt"
+	"reflect"
+	"unicode/utf8"
+
+	p "github.com/Dwarfartisan/goparsec2"
+)
+
+// Lists 提供序列操作。序列参数可以是 nil 、 List 或任意 Go 的 slice 和 array ，结果总是新的
+// List 。函数参数可以是任何可调用的对象： Lambda 、 Function 、 TaskExpr 、 LispExpr 或 Go 函数
+var Lists = Toolkit{
+	Meta: map[string]interface{}{
+		"category": "toolkit",
+		"name":     "list",
+	},
+	Content: map[string]interface{}{
+		// map 实现 (map f seq...) ，多个序列时依次取各序列同一位置的元素作为 f 的参数，到最短的
+		// 序列结束为止
+		"map": SimpleBox{
+			SignChecker(p.P(p.One).Then(p.Many1(p.One)).Then(p.EOF)),
+			func(args ...interface{}) Tasker {
+				return func(env Env) (interface{}, error) {
+					seqs := make([]List, len(args)-1)
+					size := -1
+					for idx, arg := range args[1:] {
+						seq, err := seqOf("map", arg)
+						if err != nil {
+							return nil, err
+						}
+						if size < 0 || len(seq) < size {
+							size = len(seq)
+						}
+						seqs[idx] = seq
+					}
+					ret := make(List, size)
+					for idx := range ret {
+						params := make([]interface{}, len(seqs))
+						for i, seq := range seqs {
+							params[i] = seq[idx]
+						}
+						var err error
+						if ret[idx], err = applyValue(env, args[0], params); err != nil {
+							return nil, err
+						}
+					}
+					return ret, nil
+				}
+			}},
+		// filter 给出 (f item) 为真的元素
+		"filter": SimpleBox{
+			SignChecker(p.P(p.One).Then(p.One).Then(p.EOF)),
+			func(args ...interface{}) Tasker {
+				return func(env Env) (interface{}, error) {
+					seq, err := seqOf("filter", args[1])
+					if err != nil {
+						return nil, err
+					}
+					ret := List{}
+					for _, item := range seq {
+						test, err := applyValue(env, args[0], []interface{}{item})
+						if err != nil {
+							return nil, err
+						}
+						if Truthy(test) {
+							ret = append(ret, item)
+						}
+					}
+					return ret, nil
+				}
+			}},
+		// reduce 实现 (reduce f init seq) 和 (reduce f seq) ，后者以第一个元素为初值，空序列
+		// 给出 nil
+		"reduce": SimpleBox{
+			SignChecker(p.P(p.One).Then(p.One).Then(p.Choice(p.Try(p.EOF), p.P(p.One).Then(p.EOF)))),
+			func(args ...interface{}) Tasker {
+				return func(env Env) (interface{}, error) {
+					seq, err := seqOf("reduce", args[len(args)-1])
+					if err != nil {
+						return nil, err
+					}
+					var acc interface{}
+					if len(args) == 3 {
+						acc = args[1]
+					} else if len(seq) > 0 {
+						acc, seq = seq[0], seq[1:]
+					}
+					for _, item := range seq {
+						if acc, err = applyValue(env, args[0], []interface{}{acc, item}); err != nil {
+							return nil, err
+						}
+					}
+					return acc, nil
+				}
+			}},
+		// range 实现 (range end) 、 (range start end) 和 (range start end step) ，给出
+		// [start, end) 中按 step 递增的整数
+		"range": SimpleBox{
+			SignChecker(p.P(TypeAs(INT)).Then(p.Many(TypeAs(INT))).Then(p.EOF)),
+			func(args ...interface{}) Tasker {
+				return func(env Env) (interface{}, error) {
+					start, end, step := Int(0), args[0].(Int), Int(1)
+					switch len(args) {
+					case 1:
+					case 2:
+						start, end = args[0].(Int), args[1].(Int)
+					case 3:
+						start, end, step = args[0].(Int), args[1].(Int), args[2].(Int)
+					default:
+						return nil, fmt.Errorf("range args error: expect 1 to 3 ints but %v", args)
+					}
+					if step == 0 {
+						return nil, fmt.Errorf("range args error: step can't be 0")
+					}
+					count := rangeLen(start, end, step)
+					if err := checkListLen(env, count); err != nil {
+						return nil, err
+					}
+					ret := List{}
+					for i := uint64(0); i < count; i++ {
+						ret = append(ret, start+Int(i)*step)
+					}
+					return ret, nil
+				}
+			}},
+		// append 依次连接多个序列
+		"append": SimpleBox{
+			SignChecker(p.P(p.Many(p.One)).Then(p.EOF)),
+			func(args ...interface{}) Tasker {
+				return func(env Env) (interface{}, error) {
+					ret := List{}
+					for _, arg := range args {
+						seq, err := seqOf("append", arg)
+						if err != nil {
+							return nil, err
+						}
+						ret = append(ret, seq...)
+					}
+					return ret, nil
+				}
+			}},
+		// len 给出序列、 string 和 map 的长度， string 的长度是其中 rune 的个数， nil 的长度为 0
+		"len": SimpleBox{
+			SignChecker(p.P(p.One).Then(p.EOF)),
+			func(args ...interface{}) Tasker {
+				return func(env Env) (interface{}, error) {
+					if args[0] == nil {
+						return Int(0), nil
+					}
+					val := reflect.ValueOf(args[0])
+					switch val.Kind() {
+					case reflect.String:
+						return Int(utf8.RuneCountInString(val.String())), nil
+					case reflect.Slice, reflect.Array, reflect.Map:
+						return Int(val.Len()), nil
+					}
+					return nil, fmt.Errorf("len args error: expect a sequence, string or map but %v", args[0])
+				}
+			}},
+		// nth 按序号取出序列中的元素，负数从末尾开始计算，与 List.IndexIs 一致
+		"nth": SimpleBox{
+			SignChecker(p.P(p.One).Then(TypeAs(INT)).Then(p.EOF)),
+			func(args ...interface{}) Tasker {
+				return func(env Env) (interface{}, error) {
+					seq, err := seqOf("nth", args[0])
+					if err != nil {
+						return nil, err
+					}
+					return seq.Index(args[1].(Int))
+				}
+			}},
+		// flatten 把嵌套的序列展开为一层
+		"flatten": SimpleBox{
+			SignChecker(p.P(p.One).Then(p.EOF)),
+			func(args ...interface{}) Tasker {
+				return func(env Env) (interface{}, error) {
+					seq, err := seqOf("flatten", args[0])
+					if err != nil {
+						return nil, err
+					}
+					return flatten(List{}, seq), nil
+				}
+			}},
+	},
+}
+
+// rangeLen 给出 range 在 [start, end) 中按 step 递增时的元素个数，以无符号数计算以免溢出
+func rangeLen(start, end, step Int) uint64 {
+	switch {
+	case step > 0 && start < end:
+		return (uint64(end)-uint64(start)-1)/uint64(step) + 1
+	case step < 0 && start > end:
+		return (uint64(start)-uint64(end)-1)/(-uint64(step)) + 1
+	}
+	return 0
+}
+
+// seqOf 把序列参数转为 List ， Go 的元素会经过 Value 转换
+func seqOf(name string, seq interface{}) (List, error) {
+	switch s := seq.(type) {
+	case nil:
+		return List{}, nil
+	case List:
+		return s, nil
+	}
+	val := reflect.ValueOf(seq)
+	if val.Kind() != reflect.Slice && val.Kind() != reflect.Array {
+		return nil, fmt.Errorf("%s args error: expect a list or slice but %v", name, seq)
+	}
+	ret := make(List, val.Len())
+	for idx := range ret {
+		ret[idx] = Value(val.Index(idx).Interface())
+	}
+	return ret, nil
+}
+
+func flatten(ret, seq List) List {
+	for _, item := range seq {
+		val := reflect.ValueOf(item)
+		if val.Kind() == reflect.Slice || val.Kind() == reflect.Array {
+			inner, _ := seqOf("flatten", item)
+			ret = flatten(ret, inner)
+			continue
+		}
+		ret = append(ret, item)
+	}
+	return ret
+}
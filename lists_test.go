@@ -0,0 +1,102 @@
+package gisp
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestListsHigherOrder(t *testing.T) {
+	cases := map[string]interface{}{
+		"(map (lambda (x) (* x x)) '(1 2 3))":            List{Int(1), Int(4), Int(9)},
+		"(map + '(1 2 3) ints)":                          List{Int(2), Int(4), Int(6)},
+		`(map upper '("a" "b"))`:                         List{"A", "B"},
+		"(defun inc (x) (+ x 1)) (map inc ints)":         List{Int(2), Int(3), Int(4), Int(5)},
+		"(map 'twice '(1 (2)))":                          List{List{Int(1), Int(1)}, List{List{Int(2)}, List{Int(2)}}},
+		"(map + nil)":                                    List{},
+		"(filter (lambda (x) (< 2 x)) ints)":             List{Int(3), Int(4)},
+		"(filter 'not '(1 nil false 2))":                 List{nil, Bool(false)},
+		"(reduce + 0 ints)":                              Int(10),
+		"(reduce + ints)":                                Int(10),
+		"(reduce + '())":                                 nil,
+		"(reduce (lambda (acc x) (* acc x)) 1 ints)":     Int(24),
+		"(var r 0) (map (lambda (x) (set 'r x)) ints) r": Int(4),
+	}
+	twice := TaskExpr(func(env Env, args ...interface{}) (Tasker, error) {
+		params, err := Evals(env, args...)
+		if err != nil {
+			return nil, err
+		}
+		return func(env Env) (interface{}, error) {
+			return List{params[0], params[0]}, nil
+		}, nil
+	})
+	for code, expect := range cases {
+		g := testGisp()
+		g.DefAs("ints", []int{1, 2, 3, 4})
+		g.DefAs("upper", reflect.ValueOf(strings.ToUpper))
+		g.DefAs("twice", twice)
+		ret, err := g.Parse(code)
+		if err != nil {
+			t.Fatalf("expect %s got %v but error: %v", code, expect, err)
+		}
+		if !reflect.DeepEqual(ret, expect) {
+			t.Fatalf("expect %s got %v but %v", code, expect, ret)
+		}
+	}
+	g := testGisp()
+	for _, code := range []string{"(map 1 '(1))", "(map + 1)", "(filter (lambda (x) (error \"f\")) '(1))"} {
+		if _, err := g.Parse(code); err == nil {
+			t.Fatalf("expect %s got error but nil", code)
+		}
+	}
+}
+
+func TestListsSeq(t *testing.T) {
+	g := testGisp()
+	g.DefAs("ints", []int{1, 2, 3, 4})
+	cases := map[string]interface{}{
+		"(range 3)":                     List{Int(0), Int(1), Int(2)},
+		"(range 2 5)":                   List{Int(2), Int(3), Int(4)},
+		"(range 5 0 -2)":                List{Int(5), Int(3), Int(1)},
+		"(range 0)":                     List{},
+		"(range 0 10 3)":                List{Int(0), Int(3), Int(6), Int(9)},
+		"(range 1 -8 -4)":               List{Int(1), Int(-3), Int(-7)},
+		"(range 5 2)":                   List{},
+		"(append '(1) ints '() nil)":    List{Int(1), Int(1), Int(2), Int(3), Int(4)},
+		"(append)":                      List{},
+		"(len ints)":                    Int(4),
+		"(len '())":                     Int(0),
+		`(len "abc")`:                   Int(3),
+		`(len "中文")`:                    Int(2),
+		"(len nil)":                     Int(0),
+		"(nth ints 0)":                  Int(1),
+		"(nth ints -1)":                 Int(4),
+		"(nth '(a b c) -3)":             Atom{"a", ANYMUST},
+		"(flatten '(1 (2 (3 4)) () 5))": List{Int(1), Int(2), Int(3), Int(4), Int(5)},
+		"(flatten (map (lambda (x) ints) '(1 2)))": List{Int(1), Int(2), Int(3), Int(4), Int(1), Int(2), Int(3), Int(4)},
+	}
+	for code, expect := range cases {
+		ret, err := g.Parse(code)
+		if err != nil {
+			t.Fatalf("expect %s got %v but error: %v", code, expect, err)
+		}
+		if !reflect.DeepEqual(ret, expect) {
+			t.Fatalf("expect %s got %v but %v", code, expect, ret)
+		}
+	}
+	for _, code := range []string{"(nth ints 4)", "(nth ints -5)", "(range 1 2 0)", "(range 1.5)", "(len 1)", "(append 1)"} {
+		if _, err := g.Parse(code); err == nil {
+			t.Fatalf("expect %s got error but nil", code)
+		}
+	}
+	g.SetLimits(Limits{MaxListLen: 10})
+	if ret, err := g.Parse("(range 10)"); err != nil || len(ret.(List)) != 10 {
+		t.Fatalf("expect (range 10) within max list length 10 but %v, %v", ret, err)
+	}
+	var limit LimitExceeded
+	if _, err := g.Parse("(range -9223372036854775808 9223372036854775807)"); !errors.As(err, &limit) {
+		t.Fatalf("expect a huge range got limit exceeded before allocating but %v", err)
+	}
+}
@@ -0,0 +1,288 @@
+package gisp
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"sort"
+	"unicode/utf8"
+)
+
+// loopEscape 是 break 和 continue 的信号，它作为错误沿求值向外传播，由最近的循环接住。
+// try 不能捕获它。它不能穿过函数调用，到达 lambda 的边界时变为 escapeError ，在循环之外
+// 使用时就是一个求值错误
+type loopEscape struct {
+	name  string
+	value interface{}
+}
+
+func (esc loopEscape) Error() string {
+	return fmt.Sprintf("%s outside of loop", esc.name)
+}
+
+// escapeBoundary 在 lambda 的边界上截住 break 和 continue ，把它们变为普通的求值错误，
+// 函数体中的 break 不能结束调用者的循环
+func escapeBoundary(err error) error {
+	var esc loopEscape
+	if err == nil || !errors.As(err, &esc) {
+		return err
+	}
+	var serr SourceError
+	if errors.As(err, &serr) {
+		return withSpan(serr.Span, escapeError{esc.name})
+	}
+	return escapeError{esc.name}
+}
+
+// escapeError 是在函数体中、循环之外使用 break 或 continue 的错误，它可以被 try 捕获
+type escapeError struct {
+	name string
+}
+
+func (err escapeError) Error() string {
+	return fmt.Sprintf("%s outside of loop", err.name)
+}
+
+// breakBody 实现 (break) 和 (break value) ，结束最近的循环，循环的值为 value
+func breakBody(env Env, args []interface{}) ([]interface{}, interface{}, error) {
+	if len(args) > 1 {
+		return nil, nil, fmt.Errorf("break args error: expect (break) or (break value) but %v", args)
+	}
+	var value interface{}
+	if len(args) == 1 {
+		var err error
+		if value, err = Eval(env, args[0]); err != nil {
+			return nil, nil, err
+		}
+	}
+	return nil, nil, loopEscape{"break", value}
+}
+
+// continueBody 实现 (continue) ，跳过本次循环体余下的部分
+func continueBody(env Env, args []interface{}) ([]interface{}, interface{}, error) {
+	if len(args) != 0 {
+		return nil, nil, fmt.Errorf("continue args error: expect (continue) but %v", args)
+	}
+	return nil, nil, loopEscape{"continue", nil}
+}
+
+// iterate 执行一次循环体。循环体在绑定了 vars 和 values 的 let 环境中求值，每次循环的
+// 作用域都是新的，循环体中 var 定义的变量只在当次可见，闭包捕获的是当次的值。返回循环
+// 是否被 break 结束以及 break 的值
+func iterate(env Env, vars []Atom, values []interface{}, body []interface{}) (bool, interface{}, error) {
+	if err := evalStep(env); err != nil {
+		return true, nil, err
+	}
+	local := map[string]Var{}
+	for idx, v := range vars {
+		slot := VarSlot(v.Type)
+		slot.Set(values[idx])
+		local[v.Name] = slot
+	}
+	_, err := Let{map[string]interface{}{"local": local}, body}.Eval(env)
+	var esc loopEscape
+	if err != nil && errors.As(err, &esc) {
+		return esc.name == "break", esc.value, nil
+	}
+	return err != nil, nil, err
+}
+
+// whileBody 实现 (while test body...) ，test 为真时重复执行 body 。循环的值是 break
+// 给出的值，正常结束时为 nil
+func whileBody(env Env, args []interface{}) ([]interface{}, interface{}, error) {
+	if len(args) < 1 {
+		return nil, nil, fmt.Errorf("while args error: expect (while test body...) but %v", args)
+	}
+	for {
+		test, err := Eval(env, args[0])
+		if err != nil {
+			return nil, nil, err
+		}
+		if !Truthy(test) {
+			return nil, nil, nil
+		}
+		stop, value, err := iterate(env, nil, nil, args[1:])
+		if stop {
+			return nil, value, err
+		}
+	}
+}
+
+// loopHead 检查 (var... expr) 形式的循环头，给出变量和求值后的 expr
+func loopHead(env Env, name string, args []interface{}, min, max int) ([]Atom, interface{}, error) {
+	if len(args) < 1 {
+		return nil, nil, fmt.Errorf("%s args error: expect (%s (var... expr) body...) but %v", name, name, args)
+	}
+	head, ok := args[0].(List)
+	if !ok || len(head) < min+1 || len(head) > max+1 {
+		return nil, nil, fmt.Errorf("%s args error: expect %d to %d vars and a expr but %v", name, min, max, args[0])
+	}
+	vars := make([]Atom, len(head)-1)
+	for idx := range vars {
+		if vars[idx], ok = head[idx].(Atom); !ok {
+			return nil, nil, fmt.Errorf("%s args error: expect a var name but %v", name, head[idx])
+		}
+	}
+	value, err := Eval(env, head[len(head)-1])
+	return vars, value, err
+}
+
+// loopVars 检查循环头 (var... expr) 中有 min 到 max 个变量，给出循环头
+func loopVars(args []interface{}, min, max int) (List, bool) {
+	if len(args) < 1 {
+		return nil, false
+	}
+	head, ok := args[0].(List)
+	if !ok || len(head) < min+1 || len(head) > max+1 {
+		return nil, false
+	}
+	for _, v := range head[:len(head)-1] {
+		if _, ok := v.(Atom); !ok {
+			return nil, false
+		}
+	}
+	return head, true
+}
+
+// dotimesBody 实现 (dotimes (i n) body...) ，i 从 0 到 n-1 依次执行 body
+func dotimesBody(env Env, args []interface{}) ([]interface{}, interface{}, error) {
+	vars, count, err := loopHead(env, "dotimes", args, 1, 1)
+	if err != nil {
+		return nil, nil, err
+	}
+	values, err := dotimesValues(count)
+	if err != nil {
+		return nil, nil, err
+	}
+	return runLoop(env, vars, values, args[1:])
+}
+
+// forBody 实现 (for (x coll) body...) 和 (for (k x coll) body...) 。 coll 可以是 List 、
+// Go 的 slice 和 array 、 string 、 map 和 *Chan 。两个变量时， k 依次是序号（ string 中是
+// 字节位置）或 map 的键； map 只有一个变量时依次给出键， map 按键的顺序遍历。 *Chan 只能
+// 有一个变量，一直读到 channel 关闭
+func forBody(env Env, args []interface{}) ([]interface{}, interface{}, error) {
+	vars, coll, err := loopHead(env, "for", args, 1, 2)
+	if err != nil {
+		return nil, nil, err
+	}
+	values, err := forValues(env, args[0], len(vars), coll)
+	if err != nil {
+		return nil, nil, err
+	}
+	return runLoop(env, vars, values, args[1:])
+}
+
+// runLoop 以 values 给出的变量值依次执行循环体，直到没有更多的值或者 break
+func runLoop(env Env, vars []Atom, values loopValues, body []interface{}) ([]interface{}, interface{}, error) {
+	for {
+		items, ok, err := values()
+		if err != nil || !ok {
+			return nil, nil, err
+		}
+		stop, value, err := iterate(env, vars, items, body)
+		if stop {
+			return nil, value, err
+		}
+	}
+}
+
+// loopValues 依次给出每次循环的变量值，没有更多的值时返回 false 。解释执行和字节码共用它，
+// 保证两者遍历的顺序和检查一致
+type loopValues func() ([]interface{}, bool, error)
+
+// dotimesValues 检查 dotimes 的次数，依次给出 0 到 n-1
+func dotimesValues(count interface{}) (loopValues, error) {
+	n, ok := count.(Int)
+	if !ok {
+		return nil, fmt.Errorf("dotimes args error: expect a int count but %v", count)
+	}
+	i := Int(0)
+	return func() ([]interface{}, bool, error) {
+		if i >= n {
+			return nil, false, nil
+		}
+		i++
+		return []interface{}{i - 1}, true, nil
+	}, nil
+}
+
+// forValues 给出 for 以 vars 个变量遍历 coll 时每次的变量值， head 是循环头，用于错误信息
+func forValues(env Env, head interface{}, vars int, coll interface{}) (loopValues, error) {
+	pair := func(key, item interface{}) []interface{} {
+		if vars == 2 {
+			return []interface{}{key, item}
+		}
+		return []interface{}{item}
+	}
+	switch c := coll.(type) {
+	case string:
+		pos := 0
+		return func() ([]interface{}, bool, error) {
+			if pos >= len(c) {
+				return nil, false, nil
+			}
+			r, size := utf8.DecodeRuneInString(c[pos:])
+			pos += size
+			return pair(Int(pos-size), Rune(r)), true, nil
+		}, nil
+	case *Chan:
+		if vars != 1 {
+			return nil, fmt.Errorf("for args error: expect one var for chan but %v", head)
+		}
+		return func() ([]interface{}, bool, error) {
+			item, ok, err := c.RecvContext(ContextOf(env))
+			if err != nil || !ok {
+				return nil, false, err
+			}
+			return []interface{}{Value(item)}, true, nil
+		}, nil
+	}
+	val := reflect.ValueOf(coll)
+	idx := 0
+	switch val.Kind() {
+	case reflect.Slice, reflect.Array:
+		return func() ([]interface{}, bool, error) {
+			if idx >= val.Len() {
+				return nil, false, nil
+			}
+			idx++
+			return pair(Int(idx-1), Value(val.Index(idx-1).Interface())), true, nil
+		}, nil
+	case reflect.Map:
+		keys := sortedKeys(val)
+		return func() ([]interface{}, bool, error) {
+			if idx >= len(keys) {
+				return nil, false, nil
+			}
+			key := keys[idx]
+			idx++
+			item := Value(key.Interface())
+			if vars == 2 {
+				item = Value(val.MapIndex(key).Interface())
+			}
+			return pair(Value(key.Interface()), item), true, nil
+		}, nil
+	}
+	return nil, fmt.Errorf("for args error: expect a iterable value but %v", coll)
+}
+
+// sortedKeys 给出 map 排好序的键，数值按大小排序，其它类型按字符串形式排序
+func sortedKeys(m reflect.Value) []reflect.Value {
+	keys := m.MapKeys()
+	sort.Slice(keys, func(i, j int) bool {
+		a, b := keys[i], keys[j]
+		switch a.Kind() {
+		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+			return a.Int() < b.Int()
+		case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+			return a.Uint() < b.Uint()
+		case reflect.Float32, reflect.Float64:
+			return a.Float() < b.Float()
+		case reflect.String:
+			return a.String() < b.String()
+		}
+		return fmt.Sprint(a.Interface()) < fmt.Sprint(b.Interface())
+	})
+	return keys
+}
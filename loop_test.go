@@ -0,0 +1,146 @@
+package gisp
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestLoopWhile(t *testing.T) {
+	g := testGisp()
+	ret, err := g.Parse(`
+	(var n 0)
+	(var sum 0)
+	(while (< n 10)
+		(set 'n (+ n 1))
+		(when (== n 3) (continue))
+		(when (== n 8) (break))
+		(set 'sum (+ sum n)))
+	sum`)
+	if err != nil {
+		t.Fatalf("expect while loop but error: %v", err)
+	}
+	// 1+2+4+5+6+7
+	if ret != Int(25) {
+		t.Fatalf("expect sum got 25 but %v", ret)
+	}
+	ret, err = g.Parse("(while true (break 42))")
+	if err != nil || ret != Int(42) {
+		t.Fatalf("expect break value 42 but %v, %v", ret, err)
+	}
+}
+
+func TestLoopDotimes(t *testing.T) {
+	g := testGisp()
+	ret, err := g.Parse(`
+	(var sum 0)
+	(dotimes (i 5) (set 'sum (+ sum i)))
+	sum`)
+	if err != nil || ret != Int(10) {
+		t.Fatalf("expect dotimes sum got 10 but %v, %v", ret, err)
+	}
+	if _, err := g.Parse(`(dotimes (i "3") i)`); err == nil {
+		t.Fatalf("expect dotimes a string count got error but nil")
+	}
+}
+
+func TestLoopFor(t *testing.T) {
+	cases := map[string]interface{}{
+		"(var r 0) (for (x '(1 2 3)) (set 'r (+ r x))) r":            Int(6),
+		"(var r 0) (for (i x ints) (set 'r (+ r (* i x)))) r":        Int(8),
+		`(var r "") (for (k scores) (set 'r k)) r`:                   "c",
+		`(var r 0) (for (k v scores) (set 'r (+ (* r 10) v))) r`:     Int(123),
+		`(var r 0) (for (c "héllo") (set 'r (+ r 1))) r`:             Int(5),
+		`(for (c "abc") (when (== c 'b') (break c)))`:                Rune('b'),
+		"(for (x '(1 2 3)) (for (y '(1 2)) (break y)) (break x))":    Int(1),
+		"(var r 0) (for (x '(1 2 3)) (try (continue)) (set 'r x)) r": Int(0),
+		"(for (x '()) (error \"never\"))":                            nil,
+	}
+	for code, expect := range cases {
+		g := testGisp()
+		g.DefAs("ints", []int{1, 2, 3})
+		g.DefAs("scores", map[string]int{"b": 2, "a": 1, "c": 3})
+		ret, err := g.Parse(code)
+		if err != nil {
+			t.Fatalf("expect %s got %v but error: %v", code, expect, err)
+		}
+		if !reflect.DeepEqual(ret, expect) {
+			t.Fatalf("expect %s got %v but %v", code, expect, ret)
+		}
+	}
+}
+
+func TestLoopForChan(t *testing.T) {
+	g := testGisp()
+	ch := MakeBothChan(reflect.TypeOf(make(chan int)), 3)
+	ch.Send(1)
+	ch.Send(2)
+	ch.Send(3)
+	ch.value.Close()
+	g.DefAs("ch", ch)
+	ret, err := g.Parse("(var r 0) (for (x ch) (set 'r (+ r x))) r")
+	if err != nil || ret != Int(6) {
+		t.Fatalf("expect sum from chan got 6 but %v, %v", ret, err)
+	}
+}
+
+func TestLoopEscapeOutside(t *testing.T) {
+	g := testGisp()
+	_, err := g.Parse("(break)")
+	var esc loopEscape
+	if !errors.As(err, &esc) {
+		t.Fatalf("expect break outside of loop got error but %v", err)
+	}
+	g.SetLimits(Limits{MaxSteps: 1000})
+	_, err = g.Parse("(while true)")
+	var lerr LimitExceeded
+	if !errors.As(err, &lerr) {
+		t.Fatalf("expect endless while exceed steps but %v", err)
+	}
+}
+
+func TestLoopInLambda(t *testing.T) {
+	g := testGisp()
+	_, err := g.Parse(`
+	(defun sum-to (n)
+		(var r 0)
+		(dotimes (i n) (set 'r (+ r i)))
+		r)`)
+	if err != nil {
+		t.Fatalf("expect defun sum-to but error: %v", err)
+	}
+	ret, err := g.Parse("(sum-to 101)")
+	if err != nil || ret != Int(5050) {
+		t.Fatalf("expect (sum-to 101) got 5050 but %v, %v", ret, err)
+	}
+}
+
+func TestLoopEscapeBoundary(t *testing.T) {
+	g := testGisp()
+	_, err := g.Parse(`
+	(defun stop () (break 1))
+	(var n 0)`)
+	if err != nil {
+		t.Fatalf("expect defun stop but error: %v", err)
+	}
+	_, err = g.Parse("(while (< n 3) (set 'n (+ n 1)) (stop))")
+	if err == nil || !strings.Contains(err.Error(), "break outside of loop") {
+		t.Fatalf("expect break in a function not stop the caller's loop but %v", err)
+	}
+	ret, err := g.Parse(`(try (stop) (catch e "caught"))`)
+	if err != nil || ret != "caught" {
+		t.Fatalf("expect break outside of loop caught got caught but %v, %v", ret, err)
+	}
+	ret, err = g.Parse(`
+	(var i 0)
+	(var total 0)
+	(while (< i 3)
+		(var x (* i 10))
+		(set 'total (+ total x))
+		(set 'i (+ i 1)))
+	total`)
+	if err != nil || ret != Int(30) {
+		t.Fatalf("expect var in while body defined once each iteration got 30 but %v, %v", ret, err)
+	}
+}
@@ -0,0 +1,120 @@
+package gisp
+
+import (
+	"fmt"
+	"reflect"
+
+	p "github.com/Dwarfartisan/goparsec2"
+)
+
+// Macro 实现 defmacro 定义的宏。宏的参数不求值，以 List 、 Atom 等原始数据绑定到形参，
+// 宏体的求值结果是展开后的代码，它随后在调用环境中求值
+type Macro struct {
+	Name   string
+	Lambda Lambda
+}
+
+// Expand 对一次宏调用做一步展开，返回展开后的代码
+func (macro Macro) Expand(env Env, args ...interface{}) (interface{}, error) {
+	actuals, err := macro.Lambda.matchParams(args)
+	if err != nil {
+		return nil, fmt.Errorf("macro %s args error: %w", macro.Name, err)
+	}
+	return macro.Lambda.task(macro.Name, actuals).Eval(env)
+}
+
+// Task 实现 Functor ，先展开宏，再在调用环境中对展开结果求值
+func (macro Macro) Task(env Env, args ...interface{}) (Lisp, error) {
+	expansion, err := macro.Expand(env, args...)
+	if err != nil {
+		return nil, err
+	}
+	return TaskBox{func(env Env) (interface{}, error) {
+		return Eval(env, expansion)
+	}}, nil
+}
+
+// MacroExpand 反复展开 form ，直到它不再是一个宏调用
+func MacroExpand(env Env, form interface{}) (interface{}, error) {
+	for {
+		expansion, ok, err := MacroExpand1(env, form)
+		if err != nil {
+			return nil, err
+		}
+		if !ok {
+			return form, nil
+		}
+		form = expansion
+	}
+}
+
+// MacroExpand1 只做一步展开，如果 form 不是宏调用，返回的 bool 为 false
+func MacroExpand1(env Env, form interface{}) (interface{}, bool, error) {
+	list, ok := form.(List)
+	if !ok || len(list) == 0 {
+		return form, false, nil
+	}
+	var head interface{} = list[0]
+	if atom, ok := head.(Atom); ok {
+		if head, ok = env.Lookup(atom.Name); !ok {
+			return form, false, nil
+		}
+	}
+	macro, ok := head.(Macro)
+	if !ok {
+		return form, false, nil
+	}
+	expansion, err := macro.Expand(env, list[1:]...)
+	if err != nil {
+		return nil, false, err
+	}
+	return expansion, true, nil
+}
+
+// DefmacroExpr 是构造 Macro 的表达式 (defmacro name (args...) body...) ，重复定义时替换旧的宏
+func DefmacroExpr(env Env, args ...interface{}) (Tasker, error) {
+	st := p.NewBasicState(args)
+	_, err := TypeAs(ATOM).Then(TypeAs(LIST))(&st)
+	if err != nil {
+		return nil, fmt.Errorf("Defmacro Args Error: expect (defmacro name (args...) body...) but error: %v", err)
+	}
+	name := args[0].(Atom).Name
+	prepare := map[string]bool{name: true}
+	lambda, err := declareLambda(env, prepare, args[1].(List), args[2:]...)
+	if err != nil {
+		return nil, err
+	}
+	macro := Macro{name, *lambda}
+	return func(env Env) (interface{}, error) {
+		if m, ok := env.Local(name); ok {
+			if _, ok := m.(Macro); ok {
+				return macro, env.Setvar(name, macro)
+			}
+		}
+		slot := VarSlot(Type{reflect.TypeOf(macro), false})
+		slot.Set(macro)
+		return macro, env.Defvar(name, slot)
+	}, nil
+}
+
+func macroexpand(expand func(env Env, form interface{}) (interface{}, error)) TaskExpr {
+	return func(env Env, args ...interface{}) (Tasker, error) {
+		if len(args) != 1 {
+			return nil, fmt.Errorf("Macroexpand Args Error: expect only one form but %v", args)
+		}
+		form, err := Eval(env, args[0])
+		if err != nil {
+			return nil, err
+		}
+		return func(env Env) (interface{}, error) {
+			return expand(env, form)
+		}, nil
+	}
+}
+
+var macroexpandExpr = macroexpand(MacroExpand)
+
+var macroexpand1Expr = macroexpand(func(env Env, form interface{}) (interface{}, error) {
+	expansion, _, err := MacroExpand1(env, form)
+	return expansion, err
+})
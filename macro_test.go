@@ -0,0 +1,115 @@
+package gisp
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestQuasiQuote(t *testing.T) {
+	g := NewGisp(map[string]Toolbox{
+		"axioms": Axiom,
+		"props":  Propositions,
+	})
+	ret, err := g.Parse("(let ((x 1) (ys '(2 3))) `(a ,x ,@ys (b ,(+ x 1))))")
+	if err != nil {
+		t.Fatalf("expect quasiquote a list but error: %v", err)
+	}
+	expect := L(Atom{"a", ANYMUST}, Int(1), Int(2), Int(3), L(Atom{"b", ANYMUST}, Int(2)))
+	if !reflect.DeepEqual(ret, expect) {
+		t.Fatalf("expect quasiquote got %v but %v", expect, ret)
+	}
+}
+
+func TestDefmacro(t *testing.T) {
+	g := NewGisp(map[string]Toolbox{
+		"axioms": Axiom,
+		"props":  Propositions,
+	})
+	_, err := g.Parse("(defmacro swap (f a b) `(,f ,b ,a))")
+	if err != nil {
+		t.Fatalf("expect defmacro swap but error: %v", err)
+	}
+	ret, err := g.Parse("(swap - 1 10)")
+	if err != nil {
+		t.Fatalf("expect (swap - 1 10) got 9 but error: %v", err)
+	}
+	if !reflect.DeepEqual(ret, Int(9)) {
+		t.Fatalf("expect (swap - 1 10) got 9 but %v", ret)
+	}
+}
+
+func TestDefmacroSplicing(t *testing.T) {
+	g := NewGisp(map[string]Toolbox{
+		"axioms": Axiom,
+		"props":  Propositions,
+	})
+	ret, err := g.Parse("(defmacro plus (xs ...) `(+ ,@xs)) (plus 1 2 (plus 3 4))")
+	if err != nil {
+		t.Fatalf("expect (plus 1 2 (plus 3 4)) got 10 but error: %v", err)
+	}
+	if !reflect.DeepEqual(ret, Int(10)) {
+		t.Fatalf("expect (plus 1 2 (plus 3 4)) got 10 but %v", ret)
+	}
+}
+
+func TestMacroexpand(t *testing.T) {
+	g := NewGisp(map[string]Toolbox{
+		"axioms": Axiom,
+		"props":  Propositions,
+	})
+	_, err := g.Parse(`
+(defmacro swap (f a b) ` + "`" + `(,f ,b ,a))
+(defmacro rsub (a b) ` + "`" + `(swap - ,a ,b))
+`)
+	if err != nil {
+		t.Fatalf("expect define macros but error: %v", err)
+	}
+	sub := Atom{"-", ANYMUST}
+	ret, err := g.Parse("(macroexpand1 '(rsub 1 10))")
+	if err != nil {
+		t.Fatalf("expect expand rsub once but error: %v", err)
+	}
+	expect := L(Atom{"swap", ANYMUST}, sub, Int(1), Int(10))
+	if !reflect.DeepEqual(ret, expect) {
+		t.Fatalf("expect expand rsub once got %v but %v", expect, ret)
+	}
+	ret, err = g.Parse("(macroexpand '(rsub 1 10))")
+	if err != nil {
+		t.Fatalf("expect expand rsub but error: %v", err)
+	}
+	expect = L(sub, Int(10), Int(1))
+	if !reflect.DeepEqual(ret, expect) {
+		t.Fatalf("expect expand rsub got %v but %v", expect, ret)
+	}
+}
+
+func TestQuasiQuoteNested(t *testing.T) {
+	g := testGisp()
+	g.DefAs("box", map[string]interface{}{"b": Int(2)})
+	_, err := g.Parse(`
+	(defmacro setq (name v) ` + "`" + `(set ',name ,v))
+	(defmacro pack (v) ` + "`" + `{"v" ,v "w" {"x" ,v}})
+	(defmacro at (key) ` + "`" + `box[,key])`)
+	if err != nil {
+		t.Fatalf("expect define macros but error: %v", err)
+	}
+	cases := map[string]interface{}{
+		"(var a 1) (setq a 5) a": Int(5),
+		"(pack (+ 1 2))":         map[string]interface{}{"v": Int(3), "w": map[string]interface{}{"x": Int(3)}},
+		`(at "b")`:               Int(2),
+		"(let ((x 1)) `'(a ,x))": Quote{L(Atom{"a", ANYMUST}, Int(1))},
+		"(let ((x 1)) `(a `(b ,(c ,x))))": L(Atom{"a", ANYMUST},
+			QuasiQuote{L(Atom{"b", ANYMUST}, Unquote{L(Atom{"c", ANYMUST}, Int(1))})}),
+		"(let ((xs '(1 2))) `(a `(b ,@xs ,,@xs)))": L(Atom{"a", ANYMUST},
+			QuasiQuote{L(Atom{"b", ANYMUST}, UnquoteSplicing{Atom{"xs", ANYMUST}}, Unquote{Int(1)}, Unquote{Int(2)})}),
+	}
+	for code, expect := range cases {
+		ret, err := g.Parse(code)
+		if err != nil {
+			t.Fatalf("expect %s got %v but error: %v", code, expect, err)
+		}
+		if !reflect.DeepEqual(ret, expect) {
+			t.Fatalf("expect %s got %v but %v", code, expect, ret)
+		}
+	}
+}
@@ -0,0 +1,313 @@
+package gisp
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+
+	p "github.com/Dwarfartisan/goparsec2"
+)
+
+// MatchError 表示 match 的所有子句都不能匹配
+type MatchError struct {
+	Value interface{}
+}
+
+func (err MatchError) Error() string {
+	return fmt.Sprintf("match error: no pattern matched %v", err.Value)
+}
+
+// matchForm 实现 (match expr (pattern body...)... ) ，依次用 pattern 匹配 expr 的值，在绑定
+// 了模式变量的 let 环境中对第一个匹配的子句的 body 求值。子句可以写作
+// (pattern when guard body...) ，guard 在同一个环境中求值，为真时才选中该子句。模式有：
+//
+//	_                       匹配任意值，不绑定
+//	x 、 x::int              绑定任意值或指定类型的值
+//	1 、 "s" 、 true 、 nil    与字面值相等
+//	'expr                   与引用的值相等
+//	(p1 p2 rest ...)        匹配 List 或 slice ， rest 绑定剩余的元素
+//	(p1 p2 . rest)          与 (p1 p2 rest ...) 相同
+//	(dict key p ...)        匹配 Dict 或以 string 为键的 map ，键必须存在
+//	{key p ...}             与 (dict key p ...) 相同
+//	(struct T Field p ...)  匹配类型为 T 的 struct 或其指针， T 写作 _ 时匹配任意 struct
+//	T{Field p ...}          与 (struct T Field p ...) 相同
+type matchForm struct{}
+
+// Task 实现 Functor
+func (mf matchForm) Task(env Env, args ...interface{}) (Lisp, error) {
+	return TaskBox{func(env Env) (interface{}, error) {
+		let, err := mf.choose(env, args...)
+		if err != nil {
+			return nil, err
+		}
+		return let.Eval(env)
+	}}, nil
+}
+
+// evalTail 在尾位置上对选中子句的 body 求值
+func (mf matchForm) evalTail(env Env, args ...interface{}) (interface{}, *tailCall, error) {
+	let, err := mf.choose(env, args...)
+	if err != nil {
+		return nil, nil, err
+	}
+	return let.evalTail(env)
+}
+
+// choose 对 expr 求值并依次尝试各个子句，给出选中子句的 let 环境
+func (mf matchForm) choose(env Env, args ...interface{}) (Let, error) {
+	if len(args) < 1 {
+		return Let{}, fmt.Errorf("match args error: expect (match expr (pattern body...)...) but %v", args)
+	}
+	value, err := Eval(env, args[0])
+	if err != nil {
+		return Let{}, err
+	}
+	for _, c := range args[1:] {
+		clause, ok := c.(List)
+		if !ok || len(clause) < 1 {
+			return Let{}, fmt.Errorf("match args error: expect clause as (pattern body...) but %v", c)
+		}
+		local := map[string]Var{}
+		ok, err := matchPattern(env, clause[0], value, local)
+		if err != nil {
+			return Let{}, err
+		}
+		if !ok {
+			continue
+		}
+		let := Let{map[string]interface{}{"local": local}, clause[1:]}
+		if len(clause) > 2 && clauseWord(clause[1], "when") {
+			test, err := Let{let.Meta, clause[2:3]}.Eval(env)
+			if err != nil {
+				return Let{}, err
+			}
+			if !Truthy(test) {
+				continue
+			}
+			let.Content = clause[3:]
+		}
+		return let, nil
+	}
+	return Let{}, MatchError{value}
+}
+
+func clauseWord(x interface{}, name string) bool {
+	atom, ok := x.(Atom)
+	return ok && atom.Name == name
+}
+
+// matchPattern 用 pattern 匹配 value ，匹配时把模式变量绑定到 local 中
+func matchPattern(env Env, pattern, value interface{}, local map[string]Var) (bool, error) {
+	if val, ok := value.(reflect.Value); ok && val.IsValid() && val.CanInterface() {
+		value = Value(val.Interface())
+	}
+	switch pat := pattern.(type) {
+	case Atom:
+		if pat.Name == "_" {
+			return true, nil
+		}
+		if pat.Type.Type != ANY {
+			if _, err := typeis(pat)(0, value); err != nil {
+				return false, nil
+			}
+		}
+		slot := VarSlot(pat.Type)
+		slot.Set(value)
+		local[pat.Name] = slot
+		return true, nil
+	case Quote:
+		return reflect.DeepEqual(pat.Lisp, value), nil
+	case List:
+		if len(pat) > 0 {
+			switch {
+			case clauseWord(pat[0], "dict"):
+				return matchDict(env, pat[1:], value, local)
+			case clauseWord(pat[0], "struct"):
+				return matchStruct(env, pat[1:], value, local)
+			}
+		}
+		return matchList(env, pat, value, local)
+	case Dict:
+		return matchDict(env, dictPairs(pat), value, local)
+	case Lisp:
+		return false, fmt.Errorf("match pattern error: unsupported pattern %v", pattern)
+	}
+	return reflect.DeepEqual(Value(pattern), value), nil
+}
+
+func matchList(env Env, pattern List, value interface{}, local map[string]Var) (bool, error) {
+	val := reflect.ValueOf(value)
+	if val.Kind() != reflect.Slice && val.Kind() != reflect.Array {
+		return false, nil
+	}
+	fixed := pattern
+	var rest interface{}
+	switch l := len(pattern); {
+	case l > 1 && clauseWord(pattern[l-1], "..."):
+		fixed, rest = pattern[:l-2], pattern[l-2]
+	case l > 1 && clauseWord(pattern[l-2], "."):
+		fixed, rest = pattern[:l-2], pattern[l-1]
+	}
+	if val.Len() < len(fixed) || (rest == nil && val.Len() != len(fixed)) {
+		return false, nil
+	}
+	for idx, pat := range fixed {
+		ok, err := matchPattern(env, pat, Value(val.Index(idx).Interface()), local)
+		if !ok || err != nil {
+			return false, err
+		}
+	}
+	if rest == nil {
+		return true, nil
+	}
+	tail := make(List, 0, val.Len()-len(fixed))
+	for idx := len(fixed); idx < val.Len(); idx++ {
+		tail = append(tail, Value(val.Index(idx).Interface()))
+	}
+	return matchPattern(env, rest, tail, local)
+}
+
+func matchDict(env Env, pairs []interface{}, value interface{}, local map[string]Var) (bool, error) {
+	if len(pairs)%2 != 0 {
+		return false, fmt.Errorf("match pattern error: expect (dict key pattern ...) but %v", pairs)
+	}
+	val := reflect.ValueOf(value)
+	if val.Kind() != reflect.Map || val.Type().Key().Kind() != reflect.String {
+		return false, nil
+	}
+	for idx := 0; idx < len(pairs); idx += 2 {
+		key, ok := pairs[idx].(string)
+		if !ok {
+			return false, fmt.Errorf("match pattern error: expect a string key but %v", pairs[idx])
+		}
+		item := val.MapIndex(reflect.ValueOf(key).Convert(val.Type().Key()))
+		if !item.IsValid() {
+			return false, nil
+		}
+		ok, err := matchPattern(env, pairs[idx+1], Value(item.Interface()), local)
+		if !ok || err != nil {
+			return false, err
+		}
+	}
+	return true, nil
+}
+
+// dictPairs 按键的顺序把 Dict 模式展开为 key pattern 序列
+func dictPairs(dict Dict) []interface{} {
+	pairs := make([]interface{}, 0, 2*len(dict))
+	for _, key := range sortedKeys(reflect.ValueOf(dict)) {
+		pairs = append(pairs, key.String(), dict[key.String()])
+	}
+	return pairs
+}
+
+func matchStruct(env Env, args []interface{}, value interface{}, local map[string]Var) (bool, error) {
+	if len(args) < 1 || len(args)%2 != 1 {
+		return false, fmt.Errorf("match pattern error: expect (struct Type Field pattern ...) but %v", args)
+	}
+	name, ok := args[0].(Atom)
+	if !ok {
+		return false, fmt.Errorf("match pattern error: expect a struct type name but %v", args[0])
+	}
+	val := reflect.Indirect(reflect.ValueOf(value))
+	if val.Kind() != reflect.Struct {
+		return false, nil
+	}
+	if name.Name != "_" {
+		typ, ok := env.Lookup(name.Name)
+		if !ok {
+			return false, NameError{name.Name}
+		}
+		if t, ok := typ.(reflect.Type); !ok || t != val.Type() {
+			return false, nil
+		}
+	}
+	for idx := 1; idx < len(args); idx += 2 {
+		field, ok := args[idx].(Atom)
+		if !ok {
+			return false, fmt.Errorf("match pattern error: expect a field name but %v", args[idx])
+		}
+		item := val.FieldByName(field.Name)
+		if !item.IsValid() || !item.CanInterface() {
+			return false, nil
+		}
+		ok, err := matchPattern(env, args[idx+1], Value(item.Interface()), local)
+		if !ok || err != nil {
+			return false, err
+		}
+	}
+	return true, nil
+}
+
+// patternVar 是解构参数的实参，bound 保存匹配时绑定的模式变量
+type patternVar struct {
+	Var
+	bound map[string]Var
+}
+
+// patternParser 构造匹配解构参数的 parsec 解析器，实参与 pattern 匹配时给出保存实参和
+// 模式变量的 patternVar
+func patternParser(env Env, pattern interface{}) p.P {
+	return func(st p.State) (interface{}, error) {
+		data, err := st.Next()
+		if err != nil {
+			return nil, err
+		}
+		bound := map[string]Var{}
+		ok, err := matchPattern(env, pattern, data, bound)
+		if err != nil {
+			return nil, err
+		}
+		if !ok {
+			return nil, fmt.Errorf("%v not match pattern %s", data, patternString(pattern))
+		}
+		slot := VarSlot(ANYMUST)
+		slot.Set(data)
+		return patternVar{slot, bound}, nil
+	}
+}
+
+// patternString 以 gisp 的形式输出 pattern
+func patternString(pattern interface{}) string {
+	switch pat := pattern.(type) {
+	case Atom:
+		if pat.Type.Type == ANY {
+			return pat.Name
+		}
+		return pat.String()
+	case List:
+		frags := make([]string, len(pat))
+		for idx, item := range pat {
+			frags[idx] = patternString(item)
+		}
+		return fmt.Sprintf("(%s)", strings.Join(frags, " "))
+	case Dict:
+		pairs := dictPairs(pat)
+		frags := make([]string, len(pairs))
+		for idx, item := range pairs {
+			frags[idx] = patternString(item)
+		}
+		return fmt.Sprintf("{%s}", strings.Join(frags, " "))
+	case Quote:
+		return "'" + patternString(pat.Lisp)
+	case string:
+		return fmt.Sprintf("%q", pat)
+	}
+	return fmt.Sprintf("%v", pattern)
+}
+
+// patternNames 给出 pattern 中出现的命名，声明 lambda 时它们不需要在外层环境中存在
+func patternNames(pattern interface{}, names map[string]bool) {
+	switch pat := pattern.(type) {
+	case Atom:
+		names[pat.Name] = true
+	case List:
+		for _, item := range pat {
+			patternNames(item, names)
+		}
+	case Dict:
+		for _, item := range pat {
+			patternNames(item, names)
+		}
+	}
+}
@@ -0,0 +1,77 @@
+package gisp
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestMatchPatterns(t *testing.T) {
+	cases := map[string]interface{}{
+		"(match 1 (0 'zero) (1 'one) (_ 'many))":                                 Atom{"one", ANYMUST},
+		"(match 5 (0 'zero) (n::int (* n 2)))":                                   Int(10),
+		`(match "s" (n::int n) (s::string s))`:                                   "s",
+		"(match nil (nil 'none) (_ 'some))":                                      Atom{"none", ANYMUST},
+		"(match '(1 2 3) ((a b) 'two) ((a b c) (+ a b c)))":                      Int(6),
+		"(match '(1 2 3) ((a rest ...) rest))":                                   List{Int(2), Int(3)},
+		"(match '(1) ((a rest ...) rest))":                                       List{},
+		"(match '(1 2 3) ((a b . rest) rest))":                                   List{Int(3)},
+		"(match '(1 2) ((a b c . rest) 'long) ((a . rest) rest))":                List{Int(2)},
+		"(match '(1 (2 3)) ((a (b c)) (+ a b c)))":                               Int(6),
+		"(match '(a 1) (('b x) x) (('a x) (+ x 1)))":                             Int(2),
+		"(match ints ((a b c) (+ a c)))":                                         Int(4),
+		`(match row ((dict "id" id "name" n) id))`:                               Int(7),
+		`(match row ((dict "missing" m) m) (_ 'no))`:                             Atom{"no", ANYMUST},
+		"(match cash ((struct money Amount a Currency \"CNY\") a))":              Float(100),
+		"(match cash ((struct money Currency \"USD\") 'usd) (_ 'cny))":           Atom{"cny", ANYMUST},
+		"(match pcash ((struct _ Amount a) a))":                                  Float(100),
+		"(match cash (money{Amount a Currency \"CNY\"} a))":                      Float(100),
+		"(match pcash (money{Currency \"USD\"} 'usd) (money{} 'money))":          Atom{"money", ANYMUST},
+		"(match cash (n::int 'int) (m::money 'money))":                           Atom{"money", ANYMUST},
+		"(match 5 (n when (< n 3) 'small) (n when (< n 10) 'medium) (_ 'large))": Atom{"medium", ANYMUST},
+	}
+	for code, expect := range cases {
+		g := testGisp()
+		g.DefAs("money", reflect.TypeOf(money{}))
+		g.DefAs("ints", []int{1, 2, 3})
+		g.DefAs("row", Dict{"id": 7, "name": "gisp"})
+		g.DefAs("cash", money{Float(100), "CNY"})
+		g.DefAs("pcash", &money{Float(100), "CNY"})
+		ret, err := g.Parse(code)
+		if err != nil {
+			t.Fatalf("expect %s got %v but error: %v", code, expect, err)
+		}
+		if !reflect.DeepEqual(ret, expect) {
+			t.Fatalf("expect %s got %v but %v", code, expect, ret)
+		}
+	}
+}
+
+func TestMatchNoMatch(t *testing.T) {
+	g := testGisp()
+	_, err := g.Parse("(match 3 (1 'one) (2 'two))")
+	var merr MatchError
+	if !errors.As(err, &merr) {
+		t.Fatalf("expect a MatchError but %v", err)
+	}
+	if merr.Value != Int(3) {
+		t.Fatalf("expect match error value 3 but %v", merr.Value)
+	}
+}
+
+func TestMatchInLambda(t *testing.T) {
+	g := testGisp()
+	g.SetLimits(Limits{MaxDepth: 10})
+	_, err := g.Parse(`
+	(defun sum (xs acc)
+		(match xs
+			(() acc)
+			((x rest ...) (sum rest (+ acc x)))))`)
+	if err != nil {
+		t.Fatalf("expect defun sum but error: %v", err)
+	}
+	ret, err := g.Parse("(sum '(1 2 3 4 5 6 7 8 9 10 11 12) 0)")
+	if err != nil || ret != Int(78) {
+		t.Fatalf("expect sum got 78 within depth 10 but %v, %v", ret, err)
+	}
+}
@@ -0,0 +1,112 @@
+package gisp
+
+import (
+	"fmt"
+
+	p "github.com/Dwarfartisan/goparsec2"
+)
+
+// unsetArg 标记调用时没有传入的可选参数或命名参数， task 执行前替换为默认值
+type unsetArg struct{}
+
+// defaultFormal 解析 x 或 (x default) 形式的可选参数和命名参数
+func defaultFormal(arg interface{}) (Atom, interface{}, error) {
+	switch formal := arg.(type) {
+	case Atom:
+		return formal, nil, nil
+	case List:
+		if len(formal) == 2 {
+			if atom, ok := formal[0].(Atom); ok {
+				return atom, formal[1], nil
+			}
+		}
+	}
+	return Atom{}, nil, fmt.Errorf("lambda args error: expect x or (x default) but %v", arg)
+}
+
+// optionalParser 解析可选参数，没有剩余的实参，或者 lambda 有命名参数而下一个实参是关键字
+// 时，不消耗实参，给出 unsetArg
+func optionalParser(parser p.P, keyed bool) p.P {
+	return func(st p.State) (interface{}, error) {
+		tran := st.Begin()
+		data, err := st.Next()
+		st.Rollback(tran)
+		if _, ok := data.(Keyword); err != nil || (keyed && ok) {
+			return unsetArg{}, nil
+		}
+		return parser(st)
+	}
+}
+
+// keysParser 把剩余的实参按 :name value 解析为命名参数，按 keys 的顺序给出绑定好的参数，
+// 没有传入的参数为 unsetArg
+func keysParser(keys List, parsers []p.P) p.P {
+	return func(st p.State) (interface{}, error) {
+		slots := make([]interface{}, len(keys))
+		for idx := range slots {
+			slots[idx] = unsetArg{}
+		}
+		for {
+			tran := st.Begin()
+			data, err := st.Next()
+			if err != nil {
+				st.Rollback(tran)
+				return slots, nil
+			}
+			st.Commit(tran)
+			kw, ok := data.(Keyword)
+			if !ok {
+				return nil, fmt.Errorf("expect a keyword but %v", data)
+			}
+			idx := keyIndex(keys, string(kw))
+			if idx < 0 {
+				return nil, fmt.Errorf("unknown keyword %v", kw)
+			}
+			if _, ok := slots[idx].(unsetArg); !ok {
+				return nil, fmt.Errorf("keyword %v passed twice", kw)
+			}
+			if slots[idx], err = parsers[idx](st); err != nil {
+				return nil, err
+			}
+		}
+	}
+}
+
+func keyIndex(keys List, name string) int {
+	for idx, key := range keys {
+		if key.(Atom).Name == name {
+			return idx
+		}
+	}
+	return -1
+}
+
+// bindDefaults 在 task 中对没有传入的参数求默认值，默认值可以引用前面的参数。没有默认值的
+// 参数取类型的零值， any 类型为 nil
+func (task Task) bindDefaults() error {
+	actuals, ok := task.Meta["actual parameters"].([]interface{})
+	if !ok {
+		return nil
+	}
+	formals := task.meta("formal parameters").(List)
+	defaults, _ := task.meta("parameter defaults").(map[int]interface{})
+	for idx, actual := range actuals {
+		if _, ok := actual.(unsetArg); !ok {
+			continue
+		}
+		formal := formals[idx].(Atom)
+		slot := VarSlot(formal.Type)
+		if expr, ok := defaults[idx]; ok {
+			value, err := Eval(task, expr)
+			if err != nil {
+				return err
+			}
+			if _, err := typeis(formal)(idx, value); err != nil {
+				return err
+			}
+			slot.Set(value)
+		}
+		actuals[idx] = slot
+	}
+	return nil
+}
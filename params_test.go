@@ -0,0 +1,148 @@
+package gisp
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestOptionalParams(t *testing.T) {
+	g := testGisp()
+	_, err := g.Parse(`
+	(defun scale (x &optional (ratio 10) (offset (* x ratio)) extra) (+ (* x ratio) offset))
+	(defun tag (x &optional y) y)
+	(defun zero (&optional n::int) n)`)
+	if err != nil {
+		t.Fatalf("expect defun with optional params but error: %v", err)
+	}
+	cases := map[string]interface{}{
+		"(scale 2)":       Int(40),
+		"(scale 2 3)":     Int(12),
+		"(scale 2 3 1)":   Int(7),
+		"(scale 2 3 1 0)": Int(7),
+		"(tag 1)":         nil,
+		"(zero)":          Int(0),
+		"(zero 5)":        Int(5),
+	}
+	for code, expect := range cases {
+		ret, err := g.Parse(code)
+		if err != nil {
+			t.Fatalf("expect %s got %v but error: %v", code, expect, err)
+		}
+		if !reflect.DeepEqual(ret, expect) {
+			t.Fatalf("expect %s got %v but %v", code, expect, ret)
+		}
+	}
+	_, err = g.Parse("(scale 1 2 3 4 5)")
+	if !errors.Is(err, ErrArity) {
+		t.Fatalf("expect too many args got arity error but %v", err)
+	}
+	_, err = g.Parse("(zero 1.5)")
+	if !errors.Is(err, ErrTypeSign) {
+		t.Fatalf("expect a float optional int got type sign error but %v", err)
+	}
+}
+
+func TestKeywordParams(t *testing.T) {
+	g := testGisp()
+	_, err := g.Parse(`
+	(defun fetch (url &key (timeout 30) (retries 1) verbose) (+ (* timeout 10) retries))`)
+	if err != nil {
+		t.Fatalf("expect defun with key params but error: %v", err)
+	}
+	cases := map[string]interface{}{
+		`(fetch "u")`:                          Int(301),
+		`(fetch "u" :retries 3)`:               Int(303),
+		`(fetch "u" :retries 3 :timeout 5)`:    Int(53),
+		`(fetch "u" :timeout 5 :verbose true)`: Int(51),
+		":timeout":                             Keyword("timeout"),
+	}
+	for code, expect := range cases {
+		ret, err := g.Parse(code)
+		if err != nil {
+			t.Fatalf("expect %s got %v but error: %v", code, expect, err)
+		}
+		if !reflect.DeepEqual(ret, expect) {
+			t.Fatalf("expect %s got %v but %v", code, expect, ret)
+		}
+	}
+	for _, code := range []string{`(fetch "u" :unknown 1)`, `(fetch "u" :timeout 1 :timeout 2)`,
+		`(fetch "u" 3)`, `(fetch "u" :timeout)`} {
+		if _, err := g.Parse(code); err == nil {
+			t.Fatalf("expect %s got error but nil", code)
+		}
+	}
+	for _, code := range []string{"(lambda (x &key a &optional b) x)", "(lambda (x ... &key a) x)",
+		"(lambda (&optional (a 1 2)) a)"} {
+		if _, err := g.Parse(code); err == nil {
+			t.Fatalf("expect %s got args error but nil", code)
+		}
+	}
+}
+
+func TestOptionalOverload(t *testing.T) {
+	g := testGisp()
+	_, err := g.Parse(`
+	(defun area (w::int &optional (h::int 1)) (* w h))
+	(defun area (w::int h::int) 'fixed)
+	(defun area (w::float &key (h::float 2.0)) (* w h))`)
+	if err != nil {
+		t.Fatalf("expect overload area but error: %v", err)
+	}
+	cases := map[string]interface{}{
+		"(area 3)":          Int(3),
+		"(area 3 4)":        Atom{"fixed", ANYMUST},
+		"(area 1.5)":        Float(3),
+		"(area 1.5 :h 4.0)": Float(6),
+	}
+	for code, expect := range cases {
+		ret, err := g.Parse(code)
+		if err != nil {
+			t.Fatalf("expect %s got %v but error: %v", code, expect, err)
+		}
+		if !reflect.DeepEqual(ret, expect) {
+			t.Fatalf("expect %s got %v but %v", code, expect, ret)
+		}
+	}
+	fun, _ := g.Lookup("area")
+	for _, functor := range fun.(*Function).content {
+		lambda := functor.(Lambda)
+		if lambda.IsVariadic() || len(lambda.TypeSign()) != 2 {
+			t.Fatalf("expect area overloads have 2 params but %v", lambda.SignString())
+		}
+	}
+}
+
+func TestLambdaSignature(t *testing.T) {
+	g := testGisp()
+	_, err := g.Parse(`
+	(defun fetch (url::string &optional (ratio 10) &key (timeout 30) verbose) url)
+	(defun sum (x xs::int ...) x)`)
+	if err != nil {
+		t.Fatalf("expect defun fetch and sum but error: %v", err)
+	}
+	fun, _ := g.Lookup("fetch")
+	sign := fun.(*Function).content[0].(Lambda).Signature()
+	kinds := []ParamKind{ParamRequired, ParamOptional, ParamKeyword, ParamKeyword}
+	names := []string{"url", "ratio", "timeout", "verbose"}
+	if len(sign) != len(kinds) {
+		t.Fatalf("expect fetch has 4 params but %v", sign)
+	}
+	for idx, param := range sign {
+		if param.Kind != kinds[idx] || param.Name != names[idx] {
+			t.Fatalf("expect param %d is %s %s but %v", idx, kinds[idx], names[idx], param)
+		}
+	}
+	if sign[0].Type.Type != STRING || sign[1].Default != Int(10) || sign[3].Default != nil {
+		t.Fatalf("expect url::string, ratio 10 and verbose without default but %v", sign)
+	}
+	fun, _ = g.Lookup("sum")
+	lambda := fun.(*Function).content[0].(Lambda)
+	sign = lambda.Signature()
+	if sign[0].Kind != ParamRequired || sign[1].Kind != ParamVariadic || sign[1].Type.Type != INT {
+		t.Fatalf("expect sum has a required x and a variadic xs::int but %v", sign)
+	}
+	if s := lambda.SignString(); s != "(x::interface {} xs::gisp.Int ...)" {
+		t.Fatalf("expect sum sign (x::interface {} xs::gisp.Int ...) but %s", s)
+	}
+}
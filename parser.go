@@ -1,13 +1,20 @@
 package gisp
 
 import (
+	"context"
 	"fmt"
+	"io"
 	"reflect"
-
-	p "github.com/Dwarfartisan/goparsec2"
+	"strings"
 )
 
-// Gisp 实现一个基本的 gisp 解释器
+// Gisp 实现一个基本的 gisp 解释器。
+//
+// 一个 Gisp 同一时间只能在一个 goroutine 中求值或者定义。需要并发求值时，先在一个 Gisp 中
+// 加载共享的定义，此后只把它当作只读的基础环境，每个 goroutine （例如每个请求）调用 Fork
+// 得到自己的子环境，在子环境中求值。子环境对变量和函数的定义、赋值都写入自身，不会修改
+// 基础环境；基础环境中的变量值如果是可变的 Go 对象（ slice 、 map 等），原地修改它们仍然
+// 需要调用者自行同步
 type Gisp struct {
 	Meta    map[string]interface{}
 	Content map[string]interface{}
@@ -19,6 +26,7 @@ func NewGisp(builtins map[string]Toolbox) *Gisp {
 		Meta: map[string]interface{}{
 			"category": "gisp",
 			"builtins": builtins,
+			"engine":   DefaultEngine,
 		},
 		Content: map[string]interface{}{},
 	}
@@ -37,6 +45,63 @@ func NewGispWith(builtins map[string]Toolbox, ext map[string]Toolbox) *Gisp {
 	return gisp
 }
 
+// Fork 构造一个以 gisp 为只读基础环境的子环境，它共享 gisp 的 builtins 、 Limits 和 Engine ，
+// 查找名字时先查自身再查 gisp 。 Fork 不复制任何定义，开销很小
+//
+// 多个 Fork 可以在不同的 goroutine 中并发求值，基础环境中的 lambda 对 gisp 中变量的赋值
+// 写入调用它的 Fork 。但是 lambda 捕获的 let 变量只有一份，由所有 Fork 共享，并发求值时
+// 不能对它赋值。需要按 Fork 隔离的状态应该定义为 gisp 中的变量
+func (gisp *Gisp) Fork() *Gisp {
+	meta := map[string]interface{}{
+		"category": "gisp",
+		"builtins": gisp.Meta["builtins"],
+		"base":     gisp,
+		"engine":   gisp.Engine(),
+	}
+	if limits, ok := gisp.Meta["limits"]; ok {
+		meta["limits"] = limits
+	}
+	return &Gisp{
+		Meta:    meta,
+		Content: map[string]interface{}{},
+	}
+}
+
+// gispKey 是 context 中记录正在求值的 Gisp 的键
+type gispKey struct{}
+
+// forkOf 在 ctx 中正在求值的 Gisp 是 base Fork 出的（直接或间接）子环境时返回它，否则返回
+// nil 。声明在基础环境中的 lambda 据此在调用它的子环境中查找和赋值，而不是写入只读的 base
+func forkOf(ctx context.Context, base *Gisp) *Gisp {
+	gisp, _ := ctx.Value(gispKey{}).(*Gisp)
+	if gisp == nil || gisp == base {
+		return nil
+	}
+	for b := gisp.Base(); b != nil; b = b.Base() {
+		if b == base {
+			return gisp
+		}
+	}
+	return nil
+}
+
+// Base 返回 Fork 出 gisp 的基础环境，不是 fork 得到的 gisp 返回 nil
+func (gisp Gisp) Base() *Gisp {
+	base, _ := gisp.Meta["base"].(*Gisp)
+	return base
+}
+
+// slot 在 gisp 及其基础环境中查找 name 的原始定义
+func (gisp Gisp) slot(name string) (interface{}, bool) {
+	if s, ok := gisp.Content[name]; ok {
+		return s, true
+	}
+	if base := gisp.Base(); base != nil {
+		return base.slot(name)
+	}
+	return nil, false
+}
+
 // DefAs : def as = def var + set var
 func (gisp *Gisp) DefAs(name string, value interface{}) error {
 	t := Type{reflect.TypeOf(value), false}
@@ -55,41 +120,52 @@ func (gisp *Gisp) DefOptAs(name string, value interface{}) error {
 
 // Defvar 实现 Env.Defvar
 func (gisp *Gisp) Defvar(name string, slot Var) error {
-	if _, ok := gisp.Content[name]; ok {
+	if _, ok := gisp.slot(name); ok {
 		return fmt.Errorf("var %s exists", name)
 	}
 	gisp.Content[name] = slot
 	return nil
 }
 
-// Defun 实现 Env.Defun
+// Defun 实现 Env.Defun ，已有同名函数时对其 Overload ，否则定义一个新的 Function ，
+// 它遮蔽 builtins 中的同名定义。同名函数在基础环境中时，先把它复制到 gisp 再 Overload
 func (gisp *Gisp) Defun(name string, functor Functor) error {
-	if s, ok := gisp.Local(name); ok {
+	if _, ok := gisp.Content[name]; !ok {
+		if s, ok := gisp.slot(name); ok {
+			if fun, ok := s.(*Function); ok {
+				clone := *fun
+				clone.content = append([]Functor{}, fun.content...)
+				gisp.Content[name] = &clone
+			}
+		}
+	}
+	if s, ok := gisp.slot(name); ok {
 		switch slot := s.(type) {
 		case Func:
-			slot.Overload(functor)
+			return slot.Overload(functor)
 		case Var:
 			return fmt.Errorf("%s defined as a var", name)
 		default:
 			return fmt.Errorf("exists name %s isn't Expr", name)
 		}
 	}
-	gisp.Content[name] = &Function{
-		Atom{name, Type{ANY, false}},
-		gisp,
-		[]Functor{functor},
-	}
+	gisp.Content[name] = NewFunction(name, gisp, functor)
 	return nil
 }
 
-// Setvar 实现 Env.Set 接口
+// Setvar 实现 Env.Set 接口，变量在基础环境中时，在 gisp 中建立一个同类型的副本再赋值
 func (gisp *Gisp) Setvar(name string, value interface{}) error {
-	if s, ok := gisp.Content[name]; ok {
+	if s, ok := gisp.slot(name); ok {
 		switch slot := s.(type) {
 		case Var:
+			if _, mine := gisp.Content[name]; !mine {
+				_, option := slot.(*OptionVar)
+				slot = VarSlot(Type{slot.Type(), option})
+				gisp.Content[name] = slot
+			}
 			slot.Set(value)
 			return nil
-		case Function:
+		case Func:
 			return fmt.Errorf("%v is a Expr", name)
 		default:
 			return fmt.Errorf("%v is't a var canbe set", name)
@@ -101,7 +177,7 @@ func (gisp *Gisp) Setvar(name string, value interface{}) error {
 
 // Local 实现了对命名的本地查找定位
 func (gisp Gisp) Local(name string) (interface{}, bool) {
-	if value, ok := gisp.Content[name]; ok {
+	if value, ok := gisp.slot(name); ok {
 		if slot, ok := value.(Var); ok {
 			return slot.Get(), true
 		}
@@ -129,27 +205,116 @@ func (gisp Gisp) Global(name string) (interface{}, bool) {
 	return nil, false
 }
 
+// Context 实现 Contexter ，给出 ParseContext 或 EvalContext 传入的 context
+func (gisp Gisp) Context() context.Context {
+	return metaContext(gisp.Meta)
+}
+
+// withContext 在 fn 执行期间将 ctx 绑定为 gisp 的求值 context
+func (gisp *Gisp) withContext(ctx context.Context, fn func() (interface{}, error)) (interface{}, error) {
+	prev, ok := gisp.Meta["context"]
+	gisp.Meta["context"] = ctx
+	defer func() {
+		if ok {
+			gisp.Meta["context"] = prev
+		} else {
+			delete(gisp.Meta, "context")
+		}
+	}()
+	return fn()
+}
+
+// SetLimits 设定此后每次 Parse 、 Eval 调用的求值预算
+func (gisp *Gisp) SetLimits(limits Limits) {
+	gisp.Meta["limits"] = limits
+}
+
+// Limits 返回 gisp 的求值预算
+func (gisp Gisp) Limits() Limits {
+	limits, _ := gisp.Meta["limits"].(Limits)
+	return limits
+}
+
+// SetEngine 设定此后 Parse 、 Eval 使用的执行方式
+func (gisp *Gisp) SetEngine(engine Engine) {
+	gisp.Meta["engine"] = engine
+}
+
+// Engine 返回 gisp 的执行方式
+func (gisp Gisp) Engine() Engine {
+	engine, _ := gisp.Meta["engine"].(Engine)
+	return engine
+}
+
+// withEval 为一次顶层的求值分配新的预算并绑定执行方式，已经在预算中的嵌套调用共用外层的预算
+func (gisp *Gisp) withEval(fn func() (interface{}, error)) (interface{}, error) {
+	outer := gisp.Context()
+	ctx := outer
+	if limits, ok := gisp.Meta["limits"].(Limits); ok && budgetOf(ctx) == nil {
+		ctx = context.WithValue(ctx, budgetKey{}, &budget{limits: limits})
+	}
+	if engine := gisp.Engine(); engineOf(gisp) != engine {
+		ctx = context.WithValue(ctx, engineKey{}, engine)
+	}
+	if evaluating, _ := ctx.Value(gispKey{}).(*Gisp); evaluating != gisp {
+		ctx = context.WithValue(ctx, gispKey{}, gisp)
+	}
+	if ctx == outer {
+		return fn()
+	}
+	return gisp.withContext(ctx, fn)
+}
+
+// ParseContext 与 Parse 相同，但是 ctx 被取消或超时后求值会中止并返回 ContextError
+func (gisp *Gisp) ParseContext(ctx context.Context, code string) (interface{}, error) {
+	return gisp.withContext(ctx, func() (interface{}, error) {
+		return gisp.Parse(code)
+	})
+}
+
+// EvalContext 与 Eval 相同，但是 ctx 被取消或超时后求值会中止并返回 ContextError
+func (gisp *Gisp) EvalContext(ctx context.Context, lisps ...interface{}) (interface{}, error) {
+	return gisp.withContext(ctx, func() (interface{}, error) {
+		return gisp.Eval(lisps...)
+	})
+}
+
 // Parse 解释执行一段文本
 func (gisp *Gisp) Parse(code string) (interface{}, error) {
-	st := p.BasicStateFromText(code)
+	return gisp.ParseSource("", code)
+}
+
+// ParseSource 解释执行来自 file 的一段文本，解析和求值的错误都会附上 file 中的行列位置
+func (gisp *Gisp) ParseSource(file, code string) (interface{}, error) {
+	return gisp.withEval(func() (interface{}, error) {
+		return gisp.parse(NewSourceState(file, code))
+	})
+}
+
+// Read 解析一段文本，返回其中所有的顶层表达式而不求值，结果可以交给 Eval 求值
+func (gisp *Gisp) Read(code string) ([]interface{}, error) {
+	return gisp.ReadSource("", code)
+}
+
+// ReadSource 与 Read 相同， file 用于标注语法节点的位置
+func (gisp *Gisp) ReadSource(file, code string) ([]interface{}, error) {
+	return NewReader(gisp, file, strings.NewReader(code)).ReadAll()
+}
+
+func (gisp *Gisp) parse(st *SourceState) (interface{}, error) {
 	var v interface{}
 	var e error
 	for {
-		Skip(&st)
-		_, err := p.Try(p.EOF)(&st)
-		if err == nil {
+		value, span, err := readForm(gisp, st)
+		if err == io.EOF {
 			break
 		}
-		value, err := ValueParserExt(gisp)(&st)
 		if err != nil {
 			return nil, err
 		}
-		switch lisp := value.(type) {
-		case Lisp:
-			v, e = lisp.Eval(gisp)
-		default:
-			v = lisp
-			e = nil
+		v, e = gisp.evalForm(value)
+		if e != nil {
+			return nil, withSpan(span, e)
 		}
 	}
 	return v, e
@@ -157,18 +322,35 @@ func (gisp *Gisp) Parse(code string) (interface{}, error) {
 
 // Eval 解释执行一串 Lisp 序列
 func (gisp *Gisp) Eval(lisps ...interface{}) (interface{}, error) {
+	return gisp.withEval(func() (interface{}, error) {
+		return gisp.eval(lisps...)
+	})
+}
+
+func (gisp *Gisp) eval(lisps ...interface{}) (interface{}, error) {
 	var ret interface{}
 	var err error
 	for _, l := range lisps {
-		switch lisp := l.(type) {
-		case Lisp:
-			ret, err = lisp.Eval(gisp)
-			if err != nil {
-				return nil, err
-			}
-		default:
-			ret = lisp
+		ret, err = gisp.evalForm(l)
+		if err != nil {
+			return nil, err
 		}
 	}
 	return ret, nil
 }
+
+// evalForm 按 gisp 的执行方式对一个顶层表达式求值
+func (gisp *Gisp) evalForm(form interface{}) (interface{}, error) {
+	lisp, ok := form.(Lisp)
+	if !ok {
+		return form, nil
+	}
+	if gisp.Engine() == VM {
+		chunk, err := CompileChunk([]interface{}{lisp})
+		if err != nil {
+			return nil, err
+		}
+		return chunk.exec(gisp)
+	}
+	return lisp.Eval(gisp)
+}
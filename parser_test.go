@@ -6,6 +6,19 @@ import (
 	tm "time"
 )
 
+// testGisp 构造加载了全部工具箱的环境，测试需要的其它名字在各自的测试中定义
+func testGisp() *Gisp {
+	return NewGisp(map[string]Toolbox{
+		"axioms":  Axiom,
+		"props":   Propositions,
+		"utils":   Utils,
+		"control": Control,
+		"list":    Lists,
+		"strings": Strings,
+		"dict":    Dicts,
+	})
+}
+
 func TestParseString(t *testing.T) {
 	g := NewGisp(map[string]Toolbox{})
 	gisp := *g
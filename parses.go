@@ -10,8 +10,8 @@ import (
 
 // Ext 扩展表示扩展环境
 
-// Skip 忽略匹配指定算子的内容
-var Skip = p.Skip(p.Space)
+// Skip 忽略空白和注释
+var Skip = p.P(skipBlank)
 
 // IntParser 解析整数
 func IntParser(st p.State) (interface{}, error) {
@@ -82,12 +82,12 @@ var StringParser = p.Between(p.Chr('"'), p.Chr('"'),
 	p.Many(p.Choice(p.Try(EscapeChars), p.NChr('"')))).Bind(p.ReturnString)
 
 func bodyParser(st p.State) (interface{}, error) {
-	value, err := p.SepBy(ValueParser(), Skip)(st)
+	value, err := p.SepBy(itemParser(ValueParser()), Skip)(st)
 	return value, err
 }
 
 func bodyParserExt(env Env) p.P {
-	return p.Many(ValueParserExt(env).Over(Skip))
+	return p.Many(itemParser(ValueParserExt(env)).Over(Skip))
 }
 
 // ListParser 实现列表解析器
@@ -96,20 +96,21 @@ func ListParser() p.P {
 		left := p.Chr('(').Then(Skip)
 		right := Skip.Then(p.Chr(')'))
 		empty := p.Between(left, right, Skip)
+		span := spanAt(st, st.Pos())
 		list, err := p.Between(left, right, bodyParser)(st)
 		if err == nil {
 			switch l := list.(type) {
 			case List:
-				return L(l), nil
+				return locatedItems(l, span), nil
 			case []interface{}:
-				return list.([]interface{}), nil
+				return locatedItems(l, span), nil
 			default:
 				return nil, fmt.Errorf("List Parser Error: %v type is unexpected: %v", list, reflect.TypeOf(list))
 			}
 		} else {
 			_, e := empty(st)
 			if e == nil {
-				return List{}, nil
+				return located(List{}, span), nil
 			}
 			return nil, err
 		}
@@ -122,20 +123,21 @@ func ListParserExt(env Env) p.P {
 	right := Skip.Then(p.Chr(')'))
 	empty := left.Then(right)
 	return func(st p.State) (interface{}, error) {
+		span := spanAt(st, st.Pos())
 		list, err := p.Try(p.Between(left, right, bodyParserExt(env)))(st)
 		if err == nil {
 			switch l := list.(type) {
 			case List:
-				return L(l), nil
+				return locatedItems(l, span), nil
 			case []interface{}:
-				return List(l), nil
+				return locatedItems(l, span), nil
 			default:
 				return nil, fmt.Errorf("List Parser(ext) Error: %v type is unexpected: %v", list, reflect.TypeOf(list))
 			}
 		} else {
 			_, e := empty(st)
 			if e == nil {
-				return List{}, nil
+				return located(List{}, span), nil
 			}
 			return nil, err
 		}
@@ -147,7 +149,10 @@ func QuoteParser(st p.State) (interface{}, error) {
 	lisp, err := p.Chr('\'').Then(
 		p.Choice(
 			p.Try(p.P(AtomParser).Bind(SuffixParser)),
-			ListParser().Bind(SuffixParser),
+			p.Try(ListParser().Bind(SuffixParser)),
+			BraceParser(),
+			p.Try(UnquoteParser),
+			QuasiQuoteParser,
 		))(st)
 	if err == nil {
 		return Quote{lisp}, nil
@@ -160,7 +165,10 @@ func QuoteParserExt(env Env) p.P {
 	return func(st p.State) (interface{}, error) {
 		lisp, err := p.Chr('\'').Then(p.Choice(
 			p.Try(AtomParserExt(env).Bind(SuffixParser)),
-			ListParserExt(env).Bind(SuffixParser),
+			p.Try(ListParserExt(env).Bind(SuffixParser)),
+			BraceParserExt(env),
+			p.Try(UnquoteParserExt(env)),
+			QuasiQuoteParserExt(env),
 		))(st)
 		if err == nil {
 			return Quote{lisp}, nil
@@ -169,6 +177,59 @@ func QuoteParserExt(env Env) p.P {
 	}
 }
 
+// QuasiQuoteParser 实现 `x 语法的解析
+func QuasiQuoteParser(st p.State) (interface{}, error) {
+	lisp, err := p.Chr('`').Then(ValueParser())(st)
+	if err == nil {
+		return QuasiQuote{lisp}, nil
+	}
+	return nil, err
+}
+
+// QuasiQuoteParserExt 实现带扩展的 `x 语法的解析
+func QuasiQuoteParserExt(env Env) p.P {
+	return func(st p.State) (interface{}, error) {
+		lisp, err := p.Chr('`').Then(ValueParserExt(env))(st)
+		if err == nil {
+			return QuasiQuote{lisp}, nil
+		}
+		return nil, err
+	}
+}
+
+// UnquoteParser 实现 ,x 和 ,@x 语法的解析
+func UnquoteParser(st p.State) (interface{}, error) {
+	return unquote(ValueParser())(st)
+}
+
+// UnquoteParserExt 实现带扩展的 ,x 和 ,@x 语法的解析
+func UnquoteParserExt(env Env) p.P {
+	return func(st p.State) (interface{}, error) {
+		return unquote(ValueParserExt(env))(st)
+	}
+}
+
+func unquote(value p.P) p.P {
+	return func(st p.State) (interface{}, error) {
+		_, err := p.Chr(',')(st)
+		if err != nil {
+			return nil, err
+		}
+		if _, err := p.Try(p.Chr('@'))(st); err == nil {
+			lisp, err := value(st)
+			if err != nil {
+				return nil, err
+			}
+			return UnquoteSplicing{lisp}, nil
+		}
+		lisp, err := value(st)
+		if err != nil {
+			return nil, err
+		}
+		return Unquote{lisp}, nil
+	}
+}
+
 // ValueParser 实现简单的值解释器
 func ValueParser() p.P {
 	return func(state p.State) (interface{}, error) {
@@ -179,9 +240,13 @@ func ValueParser() p.P {
 			p.Try(StringParser),
 			p.Try(BoolParser),
 			p.Try(NilParser),
-			p.Try(p.P(AtomParser).Bind(SuffixParser)),
+			p.Try(KeywordParser),
+			p.Try(p.P(AtomParser).Bind(structSuffix(ValueParser())).Bind(SuffixParser)),
 			p.Try(p.P(ListParser()).Bind(SuffixParser)),
 			p.Try(DotExprParser),
+			BraceParser().Bind(SuffixParser),
+			p.Try(QuasiQuoteParser),
+			p.Try(UnquoteParser),
 			QuoteParser,
 		)(state)
 		return value, err
@@ -198,10 +263,14 @@ func ValueParserExt(env Env) p.P {
 			p.Try(StringParser),
 			p.Try(BoolParser),
 			p.Try(NilParser),
-			p.Try(AtomParserExt(env).Bind(SuffixParserExt(env))),
+			p.Try(KeywordParser),
+			p.Try(AtomParserExt(env).Bind(structSuffix(ValueParserExt(env))).Bind(SuffixParserExt(env))),
 			p.Try(ListParserExt(env).Bind(SuffixParserExt(env))),
 			p.Try(DotExprParser),
 			p.Try(BracketExprParserExt(env)),
+			BraceParserExt(env).Bind(SuffixParserExt(env)),
+			p.Try(QuasiQuoteParserExt(env)),
+			p.Try(UnquoteParserExt(env)),
 			QuoteParserExt(env),
 		)(st)
 		return value, err
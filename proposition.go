@@ -14,7 +14,8 @@ var Propositions = Toolkit{
 	},
 	Content: map[string]interface{}{
 		"lambda": BoxExpr(LambdaExpr),
-		"let":    BoxExpr(LetExpr),
+		"let":    letForm{},
+		"defun":  BoxExpr(DefunExpr),
 		"+":      EvalExpr(ParsecExpr(addx)),
 		"add":    EvalExpr(ParsecExpr(addx)),
 		"-":      EvalExpr(ParsecExpr(subx)),
@@ -37,6 +38,11 @@ var Propositions = Toolkit{
 		"==?":    EvalExpr(eqsoExpr),
 		"!=":     EvalExpr(neqsExpr),
 		"!=?":    EvalExpr(neqsoExpr),
+
+		"try":          BoxExpr(TryExpr),
+		"defmacro":     BoxExpr(DefmacroExpr),
+		"macroexpand":  macroexpandExpr,
+		"macroexpand1": macroexpand1Expr,
 	},
 }
 
@@ -1,5 +1,9 @@
 package gisp
 
+import (
+	"fmt"
+)
+
 // Quote 定义了 Lisp Quote
 type Quote struct {
 	Lisp interface{}
@@ -19,3 +23,136 @@ func Q(x interface{}) Quote {
 func QL(args ...interface{}) Quote {
 	return Q(L(args...))
 }
+
+// QuasiQuote 定义了 lisp 的 quasiquote ，即 `x 。它的求值与 Quote 一样返回模板本身，但是其中的
+// Unquote 会被替换为求值结果，UnquoteSplicing 的求值结果会被展开拼接到所在的 List 中
+type QuasiQuote struct {
+	Lisp interface{}
+}
+
+// Eval 实现了 QuasiQuote 的模板展开
+func (qq QuasiQuote) Eval(env Env) (interface{}, error) {
+	return quasi(env, qq.Lisp, 1)
+}
+
+// Unquote 定义了 quasiquote 模板中的 ,x
+type Unquote struct {
+	Lisp interface{}
+}
+
+// Eval 实现了 Eval 行为，unquote 只能出现在 quasiquote 模板中
+func (uq Unquote) Eval(env Env) (interface{}, error) {
+	return nil, fmt.Errorf("unquote ,%v out of quasiquote", uq.Lisp)
+}
+
+// UnquoteSplicing 定义了 quasiquote 模板中的 ,@x
+type UnquoteSplicing struct {
+	Lisp interface{}
+}
+
+// Eval 实现了 Eval 行为，unquote-splicing 只能出现在 quasiquote 模板的 List 中
+func (uqs UnquoteSplicing) Eval(env Env) (interface{}, error) {
+	return nil, fmt.Errorf("unquote-splicing ,@%v out of quasiquote", uqs.Lisp)
+}
+
+// quasi 展开 depth 层 quasiquote 中的模板。嵌套的 `x 使 depth 加一， ,x 和 ,@x 使 depth
+// 减一，只有 depth 为 1 的 unquote 会被求值，更深的层次原样保留。模板中的 Quote 、 Dict 、
+// Bracket 和 Dot 也会被展开
+func quasi(env Env, tmpl interface{}, depth int) (interface{}, error) {
+	switch lisp := tmpl.(type) {
+	case Unquote:
+		if depth == 1 {
+			return Eval(env, lisp.Lisp)
+		}
+		inner, err := quasi(env, lisp.Lisp, depth-1)
+		return Unquote{inner}, err
+	case UnquoteSplicing:
+		if depth == 1 {
+			return nil, fmt.Errorf("unquote-splicing ,@%v out of list", lisp.Lisp)
+		}
+		inner, err := quasi(env, lisp.Lisp, depth-1)
+		return UnquoteSplicing{inner}, err
+	case QuasiQuote:
+		inner, err := quasi(env, lisp.Lisp, depth+1)
+		return QuasiQuote{inner}, err
+	case Quote:
+		inner, err := quasi(env, lisp.Lisp, depth)
+		return Quote{inner}, err
+	case List:
+		ret := List{}
+		for _, item := range lisp {
+			if splicing, ok := item.(UnquoteSplicing); ok && depth == 1 {
+				items, err := splice(env, splicing)
+				if err != nil {
+					return nil, err
+				}
+				ret = append(ret, items...)
+				continue
+			}
+			// ,,@x 在内层模板中展开为每个元素的 ,item
+			if uq, ok := item.(Unquote); ok && depth == 2 {
+				if splicing, ok := uq.Lisp.(UnquoteSplicing); ok {
+					items, err := splice(env, splicing)
+					if err != nil {
+						return nil, err
+					}
+					for _, value := range items {
+						ret = append(ret, Unquote{value})
+					}
+					continue
+				}
+			}
+			value, err := quasi(env, item, depth)
+			if err != nil {
+				return nil, err
+			}
+			ret = append(ret, value)
+		}
+		return ret, nil
+	case Dict:
+		ret := make(Dict, len(lisp))
+		for key, item := range lisp {
+			value, err := quasi(env, item, depth)
+			if err != nil {
+				return nil, err
+			}
+			ret[key] = value
+		}
+		return ret, nil
+	case Bracket:
+		obj, err := quasi(env, lisp.obj, depth)
+		if err != nil {
+			return nil, err
+		}
+		expr, err := quasi(env, List(lisp.expr), depth)
+		if err != nil {
+			return nil, err
+		}
+		return Bracket{obj: obj, expr: expr.(List), span: lisp.span}, nil
+	case Dot:
+		obj, err := quasi(env, lisp.obj, depth)
+		if err != nil {
+			return nil, err
+		}
+		return Dot{obj: obj, expr: lisp.expr, span: lisp.span}, nil
+	default:
+		return tmpl, nil
+	}
+}
+
+// splice 对 ,@x 求值，给出要拼接的元素
+func splice(env Env, splicing UnquoteSplicing) ([]interface{}, error) {
+	value, err := Eval(env, splicing.Lisp)
+	if err != nil {
+		return nil, err
+	}
+	switch items := value.(type) {
+	case List:
+		return items, nil
+	case []interface{}:
+		return items, nil
+	case nil:
+		return nil, nil
+	}
+	return nil, fmt.Errorf("unquote-splicing ,@%v expect a list but %v", splicing.Lisp, value)
+}
@@ -0,0 +1,122 @@
+package gisp
+
+import (
+	"bufio"
+	"io"
+
+	p "github.com/Dwarfartisan/goparsec2"
+)
+
+// Reader 从源码中逐个读出顶层表达式，只解析不求值。读出的 List 、 Atom 等语法树可以缓存，
+// 之后交给 Gisp.Eval 多次求值。扩展类型名在读取时按 env 中已有的定义解析
+type Reader struct {
+	env    Env
+	file   string
+	src    *bufio.Reader
+	text   string
+	origin Span
+	eof    bool
+}
+
+// NewReader 构造从 src 读取的 Reader ， file 用于标注语法节点的位置
+func NewReader(env Env, file string, src io.Reader) *Reader {
+	return &Reader{env: env, file: file, src: bufio.NewReader(src), origin: Span{file, 1, 1}}
+}
+
+// Read 读出下一个顶层表达式，没有更多表达式时返回 io.EOF 。 Reader 按行从 src 读取，
+// 读到的文本构成一个完整的表达式时就返回它，不必等到 src 结束，所以可以从终端或者网络
+// 连接中逐个读取表达式。不完整的文本在 src 结束前不会报告语法错误，而是继续读下一行
+func (reader *Reader) Read() (interface{}, error) {
+	for {
+		if reader.eof || reader.complete() {
+			st := reader.state()
+			form, _, err := readForm(reader.env, st)
+			switch {
+			case err == io.EOF && !reader.eof:
+				reader.consume(st)
+			case err == nil && (reader.eof || st.Pos() < len([]rune(reader.text))):
+				reader.consume(st)
+				return form, nil
+			case reader.eof:
+				return form, err
+			}
+		}
+		if err := reader.more(); err != nil {
+			return nil, err
+		}
+	}
+}
+
+// complete 按词法判断余下的文本中是否已经有一个完整的表达式，避免反复解析不完整的长表达式
+func (reader *Reader) complete() bool {
+	st := reader.state()
+	if _, err := skipBlank(st); err != nil {
+		return false
+	}
+	if _, err := p.Try(p.EOF)(st); err == nil {
+		return true
+	}
+	_, err := skipDatum(st)
+	return err == nil
+}
+
+// state 构造从余下的文本开始解析的 SourceState
+func (reader *Reader) state() *SourceState {
+	st := NewSourceState(reader.file, reader.text)
+	st.origin = reader.origin
+	return st
+}
+
+// consume 丢弃 st 已经读过的文本
+func (reader *Reader) consume(st *SourceState) {
+	pos := st.Pos()
+	reader.origin = st.SpanAt(pos)
+	reader.text = string([]rune(reader.text)[pos:])
+}
+
+// more 从 src 再读一行
+func (reader *Reader) more() error {
+	line, err := reader.src.ReadString('\n')
+	reader.text += line
+	if err == io.EOF {
+		reader.eof = true
+		return nil
+	}
+	return err
+}
+
+// ReadAll 读出余下的所有顶层表达式
+func (reader *Reader) ReadAll() ([]interface{}, error) {
+	forms := []interface{}{}
+	for {
+		form, err := reader.Read()
+		if err == io.EOF {
+			return forms, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		forms = append(forms, form)
+	}
+}
+
+// readForm 跳过空白读出一个顶层表达式和它的位置，到达文本末尾时返回 io.EOF
+func readForm(env Env, st *SourceState) (interface{}, Span, error) {
+	st.fault = nil
+	_, err := Skip(st)
+	span := st.SpanAt(st.Pos())
+	if err != nil {
+		return nil, span, err
+	}
+	if _, err := p.Try(p.EOF)(st); err == nil {
+		return nil, span, io.EOF
+	}
+	value, err := ValueParserExt(env)(st)
+	if err != nil {
+		if st.fault != nil {
+			return nil, span, st.fault
+		}
+		return nil, span, withSpan(span, err)
+	}
+	return value, span, nil
+}
@@ -0,0 +1,99 @@
+package gisp
+
+import (
+	"errors"
+	"io"
+	"strings"
+	"testing"
+)
+
+func TestReadThenEval(t *testing.T) {
+	g := NewGisp(map[string]Toolbox{
+		"axioms": Axiom,
+		"props":  Propositions,
+	})
+	forms, err := g.Read(`
+	(defun double (x) (* x 2))
+	x
+	(double x)`)
+	if err != nil {
+		t.Fatalf("expect read 3 forms but error: %v", err)
+	}
+	if len(forms) != 3 {
+		t.Fatalf("expect read 3 forms but %v", forms)
+	}
+	if _, ok := forms[0].(List); !ok {
+		t.Fatalf("expect first form is a List but %v", forms[0])
+	}
+	if atom, ok := forms[1].(Atom); !ok || atom.Name != "x" {
+		t.Fatalf("expect second form is atom x but %v", forms[1])
+	}
+	if _, ok := g.Lookup("double"); ok {
+		t.Fatalf("expect read not eval defun double")
+	}
+	for idx := 1; idx < 4; idx++ {
+		fork := g.Fork()
+		fork.DefAs("x", Int(idx))
+		ret, err := fork.Eval(forms...)
+		if err != nil || ret != Int(idx*2) {
+			t.Fatalf("expect eval forms got %d but %v, %v", idx*2, ret, err)
+		}
+	}
+}
+
+func TestReaderStream(t *testing.T) {
+	g := NewGisp(map[string]Toolbox{
+		"axioms": Axiom,
+		"props":  Propositions,
+	})
+	reader := NewReader(g, "stream.lisp", strings.NewReader("1 \"two\"\n(+ 1 2)\n  (oops"))
+	expects := []interface{}{Int(1), "two"}
+	for _, expect := range expects {
+		form, err := reader.Read()
+		if err != nil || form != expect {
+			t.Fatalf("expect read %v but %v, %v", expect, form, err)
+		}
+	}
+	form, err := reader.Read()
+	if _, ok := form.(List); !ok || err != nil {
+		t.Fatalf("expect read a List but %v, %v", form, err)
+	}
+	_, err = reader.Read()
+	expectSpan(t, err, Span{"stream.lisp", 3, 3})
+	reader = NewReader(g, "", strings.NewReader("  "))
+	if _, err := reader.Read(); !errors.Is(err, io.EOF) {
+		t.Fatalf("expect io.EOF but %v", err)
+	}
+}
+
+func TestReaderIncremental(t *testing.T) {
+	g := NewGisp(map[string]Toolbox{
+		"axioms": Axiom,
+		"props":  Propositions,
+	})
+	src, sink := io.Pipe()
+	reader := NewReader(g, "repl", src)
+	go func() {
+		io.WriteString(sink, "(+ 1\n   2)  \"next\"\n")
+	}()
+	form, err := reader.Read()
+	if _, ok := form.(List); !ok || err != nil {
+		t.Fatalf("expect read (+ 1 2) before src closed but %v, %v", form, err)
+	}
+	form, err = reader.Read()
+	if form != "next" || err != nil {
+		t.Fatalf("expect read \"next\" before src closed but %v, %v", form, err)
+	}
+	go func() {
+		io.WriteString(sink, "\n\n  (missing)\n")
+		sink.Close()
+	}()
+	form, err = reader.Read()
+	if err != nil {
+		t.Fatalf("expect read (missing) but error: %v", err)
+	}
+	span, _ := SpanOf(form)
+	if span != (Span{"repl", 5, 3}) {
+		t.Fatalf("expect list read at repl:5:3 but %v", span)
+	}
+}
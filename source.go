@@ -0,0 +1,277 @@
+package gisp
+
+import (
+	"errors"
+	"fmt"
+	"runtime"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"unsafe"
+	"weak"
+
+	p "github.com/Dwarfartisan/goparsec2"
+)
+
+// Span 表示语法节点在源码中的位置，Line 和 Column 从 1 开始计数， Line 为 0 表示位置未知
+type Span struct {
+	File   string
+	Line   int
+	Column int
+}
+
+func (span Span) String() string {
+	if span.File == "" {
+		return fmt.Sprintf("%d:%d", span.Line, span.Column)
+	}
+	return fmt.Sprintf("%s:%d:%d", span.File, span.Line, span.Column)
+}
+
+// IsValid 判断 span 是否记录了有效的位置
+func (span Span) IsValid() bool {
+	return span.Line > 0
+}
+
+// SourceError 为求值错误附加出错节点的源码位置， Err 是原始的错误
+type SourceError struct {
+	Span Span
+	Err  error
+}
+
+func (err SourceError) Error() string {
+	return fmt.Sprintf("%v: %v", err.Span, err.Err)
+}
+
+// Unwrap 允许用 errors.Is 、 errors.As 检查原始的错误
+func (err SourceError) Unwrap() error {
+	return err.Err
+}
+
+// withSpan 用 span 包装错误。错误已经带有位置时保留它，这样总是报告最内层节点的位置
+func withSpan(span Span, err error) error {
+	if err == nil || !span.IsValid() {
+		return err
+	}
+	var serr SourceError
+	if errors.As(err, &serr) {
+		return err
+	}
+	return SourceError{span, err}
+}
+
+// SourceState 在 goparsec 的 State 之上记录源码的文件名和行首偏移，
+// 解析器通过它为 List 、 Dot 、 Bracket 节点标注位置
+type SourceState struct {
+	p.State
+	File   string
+	lines  []int
+	origin Span
+	fault  error
+}
+
+// NewSourceState 从源码文本构造 SourceState ， file 仅用于错误信息
+func NewSourceState(file, code string) *SourceState {
+	st := p.BasicStateFromText(code)
+	lines := []int{0}
+	for idx, r := range []rune(code) {
+		if r == '\n' {
+			lines = append(lines, idx+1)
+		}
+	}
+	return &SourceState{State: &st, File: file, lines: lines}
+}
+
+// SpanAt 给出偏移 pos 处的源码位置。 origin 有效时文本是从源码中间开始的，位置从 origin 起算
+func (st *SourceState) SpanAt(pos int) Span {
+	line := sort.Search(len(st.lines), func(idx int) bool {
+		return st.lines[idx] > pos
+	})
+	column := pos - st.lines[line-1] + 1
+	if st.origin.IsValid() {
+		if line == 1 {
+			column += st.origin.Column - 1
+		}
+		line += st.origin.Line - 1
+	}
+	return Span{st.File, line, column}
+}
+
+// faultAt 给出 pos 处确定的语法错误。解析器回溯时会丢掉分支中的错误，所以 st 是
+// SourceState 时还会记下第一个这样的错误，解析失败时 readForm 报告它
+func faultAt(st p.State, pos int, err error) error {
+	err = withSpan(spanAt(st, pos), err)
+	if ss, ok := st.(*SourceState); ok && ss.fault == nil {
+		ss.fault = err
+	}
+	return err
+}
+
+// spanAt 在 st 是 SourceState 时给出 pos 处的位置，否则返回无效的 Span
+func spanAt(st p.State, pos int) Span {
+	if ss, ok := st.(*SourceState); ok {
+		return ss.SpanAt(pos)
+	}
+	return Span{}
+}
+
+// listInfo 是附加在 List 上的信息：源码位置、元素中 Atom 的位置和 Compile 生成的求值代码，
+// tail 在尾位置上求值。 ref 指向登记时 List 的首元素，size 是登记时 List 的长度，截短的子
+// 切片与原 List 首元素相同，但不共用附加信息
+type listInfo struct {
+	span  Span
+	items []Span
+	code  Tasker
+	tail  tailTasker
+	ref   weak.Pointer[interface{}]
+	size  int
+}
+
+// listInfos 是 List 附加信息的旁表，键是 List 首元素的地址。 List 是切片类型无法增加
+// 字段，放在旁表中的信息不影响 len 、 append 和 reflect.DeepEqual 。记录中的弱指针确认
+// 地址上仍然是登记时的 List ，底层数组被回收后对应的记录随之删除
+var listInfos sync.Map
+
+// compiledLists 是旁表中带有编译代码的记录数，没有编译代码时求值 List 不必查找旁表
+var compiledLists atomic.Int64
+
+// withInfo 返回带有附加信息的 list 副本，副本有独立的底层数组。空 List 不记录信息
+func withInfo(list List, info *listInfo) List {
+	if len(list) == 0 {
+		return list
+	}
+	ret := make(List, len(list))
+	copy(ret, list)
+	info.size = len(ret)
+	info.ref = weak.Make(&ret[0])
+	key := uintptr(unsafe.Pointer(&ret[0]))
+	listInfos.Store(key, info)
+	if info.code != nil {
+		compiledLists.Add(1)
+	}
+	runtime.AddCleanup(&ret[0], func(info *listInfo) {
+		listInfos.CompareAndDelete(key, info)
+		if info.code != nil {
+			compiledLists.Add(-1)
+		}
+	}, info)
+	return ret
+}
+
+// info 给出 list 的附加信息，没有时返回 nil
+func (list List) info() *listInfo {
+	if len(list) == 0 {
+		return nil
+	}
+	head := &list[0]
+	if value, ok := listInfos.Load(uintptr(unsafe.Pointer(head))); ok {
+		if info := value.(*listInfo); info.size == len(list) && info.ref.Value() == head {
+			return info
+		}
+	}
+	return nil
+}
+
+// compiled 给出 Compile 为 list 生成的附加信息，没有编译过的 List 时不查找旁表
+func (list List) compiled() *listInfo {
+	if compiledLists.Load() == 0 {
+		return nil
+	}
+	if info := list.info(); info != nil && info.code != nil {
+		return info
+	}
+	return nil
+}
+
+// located 返回带有位置的 list 副本
+func located(list List, span Span) List {
+	if !span.IsValid() {
+		return list
+	}
+	return withInfo(list, &listInfo{span: span})
+}
+
+// spanned 是 List 中解析出的元素和它的起始位置
+type spanned struct {
+	value interface{}
+	span  Span
+}
+
+// itemParser 在 value 解析出的 List 元素上附加起始位置，由 locatedItems 拆开
+func itemParser(value p.P) p.P {
+	return func(st p.State) (interface{}, error) {
+		span := spanAt(st, st.Pos())
+		item, err := value(st)
+		if err != nil {
+			return nil, err
+		}
+		return spanned{item, span}, nil
+	}
+}
+
+// locatedItems 拆开 itemParser 解析的元素，返回带有位置的 List ，同时记录其中 Atom 元素的
+// 位置
+func locatedItems(items []interface{}, span Span) List {
+	list := make(List, len(items))
+	var spans []Span
+	for idx, item := range items {
+		s := item.(spanned)
+		list[idx] = s.value
+		if _, ok := s.value.(Atom); ok && s.span.IsValid() {
+			if spans == nil {
+				spans = make([]Span, len(items))
+			}
+			spans[idx] = s.span
+		}
+	}
+	if !span.IsValid() {
+		return list
+	}
+	return withInfo(list, &listInfo{span: span, items: spans})
+}
+
+// itemSpan 给出 list 第 idx 个元素的位置，只有解析得到的 Atom 元素记录了位置
+func (list List) itemSpan(idx int) Span {
+	if info := list.info(); info != nil && idx < len(info.items) {
+		return info.items[idx]
+	}
+	return Span{}
+}
+
+// errSpan 给出 list 求值出错时的位置：找不到的命名是 list 的 Atom 实参时是这个 Atom 的位置，
+// 否则是 list 的位置
+func (list List) errSpan(err error) Span {
+	info := list.info()
+	if info == nil {
+		return Span{}
+	}
+	var name NameError
+	if info.items != nil && errors.As(err, &name) {
+		for idx := 1; idx < len(list) && idx < len(info.items); idx++ {
+			item := list[idx]
+			if arg, ok := item.(compiledArg); ok {
+				item = arg.form
+			}
+			if atom, ok := item.(Atom); ok && atom.Name == name.Name && info.items[idx].IsValid() {
+				return info.items[idx]
+			}
+		}
+	}
+	return info.span
+}
+
+// SpanOf 给出语法节点的源码位置，没有记录位置时第二个返回值为 false 。 Atom 是可比较的值，
+// 它的位置记录在所在 List 的附加信息中，见 List 的 itemSpan
+func SpanOf(node interface{}) (Span, bool) {
+	var span Span
+	switch n := node.(type) {
+	case List:
+		if info := n.info(); info != nil {
+			span = info.span
+		}
+	case Dot:
+		span = n.span
+	case Bracket:
+		span = n.span
+	}
+	return span, span.IsValid()
+}
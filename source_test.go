@@ -0,0 +1,111 @@
+package gisp
+
+import (
+	"errors"
+	"testing"
+)
+
+func expectSpan(t *testing.T, err error, span Span) {
+	var serr SourceError
+	if !errors.As(err, &serr) {
+		t.Fatalf("expect a SourceError at %v but %v", span, err)
+	}
+	if serr.Span != span {
+		t.Fatalf("expect error at %v but %v: %v", span, serr.Span, serr.Err)
+	}
+}
+
+func TestSourceErrorSpan(t *testing.T) {
+	g := NewGisp(map[string]Toolbox{
+		"axioms": Axiom,
+		"props":  Propositions,
+	})
+	_, err := g.ParseSource("rules.lisp", "(+ 1 2)\n  (foo 1)")
+	expectSpan(t, err, Span{"rules.lisp", 2, 3})
+	if err.Error() != "rules.lisp:2:3: name foo not found" {
+		t.Fatalf("expect error message with position but %v", err)
+	}
+	_, err = g.Parse("\n\n   missing")
+	expectSpan(t, err, Span{"", 3, 4})
+}
+
+func TestSourceErrorInnermost(t *testing.T) {
+	g := NewGisp(map[string]Toolbox{
+		"axioms": Axiom,
+		"props":  Propositions,
+	})
+	_, err := g.ParseSource("f.lisp", `(defun f (x)
+    (+ x
+       (.Missing x)))`)
+	if err != nil {
+		t.Fatalf("expect defun f but error: %v", err)
+	}
+	_, err = g.Parse("(f 1)")
+	expectSpan(t, err, Span{"f.lisp", 3, 8})
+}
+
+func TestSourceSpanKeepsEqual(t *testing.T) {
+	g := NewGisp(map[string]Toolbox{
+		"axioms": Axiom,
+		"props":  Propositions,
+	})
+	ret, err := g.Parse("(equal '(a (b c)) '(a (b c)))")
+	if err != nil || ret != true {
+		t.Fatalf("expect lists at different position are equal but got %v, %v", ret, err)
+	}
+	list, err := g.Parse("'(1 2)")
+	if err != nil {
+		t.Fatalf("expect a quoted list but error: %v", err)
+	}
+	span, ok := SpanOf(list)
+	if !ok || span != (Span{"", 1, 2}) {
+		t.Fatalf("expect list located at 1:2 but %v, %v", span, ok)
+	}
+}
+
+func TestSourceSpanSideTable(t *testing.T) {
+	g := NewGisp(map[string]Toolbox{
+		"axioms": Axiom,
+		"props":  Propositions,
+	})
+	ret, err := g.Parse("'(1 2)")
+	if err != nil {
+		t.Fatalf("expect a quoted list but error: %v", err)
+	}
+	list := ret.(List)
+	more := append(list, Int(3))
+	if len(more) != 3 || more[2] != Int(3) {
+		t.Fatalf("expect append to a quoted list get (1 2 3) but %v", more)
+	}
+	if _, ok := SpanOf(more); ok {
+		t.Fatalf("expect appended list has no span but %v", more)
+	}
+	if _, ok := SpanOf(list[:1]); ok {
+		t.Fatalf("expect sub list has no span but %v", list[:1])
+	}
+	if span, ok := SpanOf(list); !ok || span != (Span{"", 1, 2}) {
+		t.Fatalf("expect list still located at 1:2 but %v, %v", span, ok)
+	}
+}
+
+func TestSourceAtomSpan(t *testing.T) {
+	g := NewGisp(map[string]Toolbox{
+		"axioms": Axiom,
+		"props":  Propositions,
+	})
+	_, err := g.ParseSource("atom.lisp", "(+ 1\n     missing)")
+	expectSpan(t, err, Span{"atom.lisp", 2, 6})
+	_, err = g.ParseSource("atom.lisp", "(defun f (x)\n  (+ x\n     nope))")
+	expectSpan(t, err, Span{"atom.lisp", 3, 6})
+	ret, err := g.Parse("(equal a a)")
+	if err != nil || ret != true {
+		t.Fatalf("expect atoms at different position are equal but got %v, %v", ret, err)
+	}
+	ret, err = g.Parse("'x")
+	if err != nil {
+		t.Fatalf("expect a quoted atom but error: %v", err)
+	}
+	if _, ok := SpanOf(ret); ok {
+		t.Fatalf("expect quoted atom has no span but %v", ret)
+	}
+}
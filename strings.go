@@ -0,0 +1,218 @@
+package gisp
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	p "github.com/Dwarfartisan/goparsec2"
+)
+
+// Strings 封装了 Go 的 strings 、 strconv 和 fmt.Sprintf 。 index 和 substring 以 rune 计算
+// 位置，负数从末尾开始计算。 to-string 、 to-int 、 to-float 和 to-rune 在 string 、 Int 、
+// Float 和 Rune 之间转换
+var Strings = Toolkit{
+	Meta: map[string]interface{}{
+		"category": "toolkit",
+		"name":     "strings",
+	},
+	Content: map[string]interface{}{
+		"split": stringBox(p.P(TypeAs(STRING)).Then(TypeAs(STRING)).Then(p.EOF),
+			func(args ...interface{}) (interface{}, error) {
+				parts := strings.Split(args[0].(string), args[1].(string))
+				ret := make(List, len(parts))
+				for idx, part := range parts {
+					ret[idx] = part
+				}
+				return ret, nil
+			}),
+		// fields 按空白切分字符串，忽略首尾和连续的空白
+		"fields": stringBox(p.P(TypeAs(STRING)).Then(p.EOF),
+			func(args ...interface{}) (interface{}, error) {
+				ret := List{}
+				for _, field := range strings.Fields(args[0].(string)) {
+					ret = append(ret, field)
+				}
+				return ret, nil
+			}),
+		// join 用 sep 连接序列中的字符串
+		"join": stringBox(p.P(p.One).Then(TypeAs(STRING)).Then(p.EOF),
+			func(args ...interface{}) (interface{}, error) {
+				seq, err := seqOf("join", args[0])
+				if err != nil {
+					return nil, err
+				}
+				parts := make([]string, len(seq))
+				for idx, item := range seq {
+					str, ok := item.(string)
+					if !ok {
+						return nil, fmt.Errorf("join args error: expect strings but %v", item)
+					}
+					parts[idx] = str
+				}
+				return strings.Join(parts, args[1].(string)), nil
+			}),
+		"trim":       trimBox(strings.Trim, strings.TrimSpace),
+		"trim-left":  trimBox(strings.TrimLeft, func(s string) string { return strings.TrimLeftFunc(s, unicode.IsSpace) }),
+		"trim-right": trimBox(strings.TrimRight, func(s string) string { return strings.TrimRightFunc(s, unicode.IsSpace) }),
+		"replace": stringBox(p.P(TypeAs(STRING)).Then(TypeAs(STRING)).Then(TypeAs(STRING)).Then(p.EOF),
+			func(args ...interface{}) (interface{}, error) {
+				return strings.ReplaceAll(args[0].(string), args[1].(string), args[2].(string)), nil
+			}),
+		"upper": stringBox(p.P(TypeAs(STRING)).Then(p.EOF),
+			func(args ...interface{}) (interface{}, error) {
+				return strings.ToUpper(args[0].(string)), nil
+			}),
+		"lower": stringBox(p.P(TypeAs(STRING)).Then(p.EOF),
+			func(args ...interface{}) (interface{}, error) {
+				return strings.ToLower(args[0].(string)), nil
+			}),
+		"contains?": stringBox(p.P(TypeAs(STRING)).Then(TypeAs(STRING)).Then(p.EOF),
+			func(args ...interface{}) (interface{}, error) {
+				return Bool(strings.Contains(args[0].(string), args[1].(string))), nil
+			}),
+		"has-prefix?": stringBox(p.P(TypeAs(STRING)).Then(TypeAs(STRING)).Then(p.EOF),
+			func(args ...interface{}) (interface{}, error) {
+				return Bool(strings.HasPrefix(args[0].(string), args[1].(string))), nil
+			}),
+		"has-suffix?": stringBox(p.P(TypeAs(STRING)).Then(TypeAs(STRING)).Then(p.EOF),
+			func(args ...interface{}) (interface{}, error) {
+				return Bool(strings.HasSuffix(args[0].(string), args[1].(string))), nil
+			}),
+		// index 给出子串第一次出现的 rune 位置，没有时为 -1
+		"index": stringBox(p.P(TypeAs(STRING)).Then(TypeAs(STRING)).Then(p.EOF),
+			func(args ...interface{}) (interface{}, error) {
+				str := args[0].(string)
+				pos := strings.Index(str, args[1].(string))
+				if pos < 0 {
+					return Int(-1), nil
+				}
+				return Int(utf8.RuneCountInString(str[:pos])), nil
+			}),
+		// substring 实现 (substring s start) 和 (substring s start end) ，给出 [start, end)
+		// 中的 rune
+		"substring": stringBox(p.P(TypeAs(STRING)).Then(TypeAs(INT)).Then(p.Choice(p.Try(p.EOF), p.P(TypeAs(INT)).Then(p.EOF))),
+			func(args ...interface{}) (interface{}, error) {
+				runes := []rune(args[0].(string))
+				start, ok := runeBound(args[1].(Int), len(runes))
+				end := len(runes)
+				if ok && len(args) > 2 {
+					end, ok = runeBound(args[2].(Int), len(runes))
+				}
+				if !ok || end < start {
+					return nil, fmt.Errorf("substring args error: %v out of range %d", args[1:], len(runes))
+				}
+				return string(runes[start:end]), nil
+			}),
+		// chars 给出字符串中的每一个 Rune
+		"chars": stringBox(p.P(TypeAs(STRING)).Then(p.EOF),
+			func(args ...interface{}) (interface{}, error) {
+				ret := List{}
+				for _, r := range args[0].(string) {
+					ret = append(ret, Rune(r))
+				}
+				return ret, nil
+			}),
+		"sprintf": stringBox(p.P(TypeAs(STRING)).Then(p.Many(p.One)).Then(p.EOF),
+			func(args ...interface{}) (interface{}, error) {
+				return fmt.Sprintf(args[0].(string), args[1:]...), nil
+			}),
+		"to-string": stringBox(p.P(p.One).Then(p.EOF),
+			func(args ...interface{}) (interface{}, error) {
+				switch v := args[0].(type) {
+				case string:
+					return v, nil
+				case Int:
+					return strconv.FormatInt(int64(v), 10), nil
+				case Float:
+					return strconv.FormatFloat(float64(v), 'g', -1, 64), nil
+				case Rune:
+					return string(v), nil
+				}
+				return fmt.Sprint(args[0]), nil
+			}),
+		// to-int 解析字符串，截断 Float ，给出 Rune 的码点
+		"to-int": stringBox(p.P(p.One).Then(p.EOF),
+			func(args ...interface{}) (interface{}, error) {
+				switch v := args[0].(type) {
+				case string:
+					i, err := strconv.ParseInt(v, 10, 64)
+					if err != nil {
+						return nil, fmt.Errorf("to-int args error: %v", err)
+					}
+					return Int(i), nil
+				case Int:
+					return v, nil
+				case Float:
+					return Int(v), nil
+				case Rune:
+					return Int(v), nil
+				}
+				return nil, fmt.Errorf("to-int args error: can't convert %v to int", args[0])
+			}),
+		"to-float": stringBox(p.P(p.One).Then(p.EOF),
+			func(args ...interface{}) (interface{}, error) {
+				switch v := args[0].(type) {
+				case string:
+					f, err := strconv.ParseFloat(v, 64)
+					if err != nil {
+						return nil, fmt.Errorf("to-float args error: %v", err)
+					}
+					return Float(f), nil
+				case Int:
+					return Float(v), nil
+				case Float:
+					return v, nil
+				}
+				return nil, fmt.Errorf("to-float args error: can't convert %v to float", args[0])
+			}),
+		// to-rune 把码点或只有一个字符的字符串转为 Rune
+		"to-rune": stringBox(p.P(p.One).Then(p.EOF),
+			func(args ...interface{}) (interface{}, error) {
+				switch v := args[0].(type) {
+				case Rune:
+					return v, nil
+				case Int:
+					return Rune(v), nil
+				case string:
+					if r, size := utf8.DecodeRuneInString(v); size > 0 && size == len(v) {
+						return Rune(r), nil
+					}
+				}
+				return nil, fmt.Errorf("to-rune args error: can't convert %v to rune", args[0])
+			}),
+	},
+}
+
+// stringBox 构造按 sign 检查实参的 SimpleBox
+func stringBox(sign p.P, fn func(args ...interface{}) (interface{}, error)) SimpleBox {
+	return SimpleBox{
+		SignChecker(sign),
+		func(args ...interface{}) Tasker {
+			return func(env Env) (interface{}, error) {
+				return fn(args...)
+			}
+		}}
+}
+
+// trimBox 构造 (trim s) 和 (trim s cutset) 形式的函数，没有 cutset 时去掉空白
+func trimBox(cut func(s, cutset string) string, space func(s string) string) SimpleBox {
+	return stringBox(p.P(TypeAs(STRING)).Then(p.Choice(p.Try(p.EOF), p.P(TypeAs(STRING)).Then(p.EOF))),
+		func(args ...interface{}) (interface{}, error) {
+			if len(args) > 1 {
+				return cut(args[0].(string), args[1].(string)), nil
+			}
+			return space(args[0].(string)), nil
+		})
+}
+
+// runeBound 把序号正规化到 [0, n] ，负数从末尾开始计算
+func runeBound(index Int, n int) (int, bool) {
+	idx := int(index)
+	if idx < 0 {
+		idx += n
+	}
+	return idx, 0 <= idx && idx <= n
+}
@@ -0,0 +1,64 @@
+package gisp
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestStringsOps(t *testing.T) {
+	g := testGisp()
+	g.DefAs("words", []string{"x", "y"})
+	cases := map[string]interface{}{
+		`(split "a,b,,c" ",")`:                    List{"a", "b", "", "c"},
+		`(fields "  a  b\tc\n")`:                  List{"a", "b", "c"},
+		`(join '("a" "b" "c") "-")`:               "a-b-c",
+		`(join words "")`:                         "xy",
+		`(join '() ",")`:                          "",
+		`(trim "  hi \n")`:                        "hi",
+		`(trim "--hi--" "-")`:                     "hi",
+		`(trim-left "  hi ")`:                     "hi ",
+		`(trim-right "xxhixx" "x")`:               "xxhi",
+		`(replace "a-b-c" "-" "+")`:               "a+b+c",
+		`(upper "héllo")`:                         "HÉLLO",
+		`(lower "HeLLo")`:                         "hello",
+		`(contains? "hello" "ell")`:               Bool(true),
+		`(has-prefix? "hello" "he")`:              Bool(true),
+		`(has-suffix? "hello" "he")`:              Bool(false),
+		`(index "héllo" "l")`:                     Int(2),
+		`(index "hello" "z")`:                     Int(-1),
+		`(substring "héllo" 1 3)`:                 "él",
+		`(substring "héllo" -3)`:                  "llo",
+		`(substring "héllo" 5)`:                   "",
+		`(chars "hé")`:                            List{Rune('h'), Rune('é')},
+		`(sprintf "%s=%d %.1f" "n" 3 2.5)`:        "n=3 2.5",
+		`(to-string 42)`:                          "42",
+		`(to-string 1.5)`:                         "1.5",
+		`(to-string 'é')`:                         "é",
+		`(to-string true)`:                        "true",
+		`(to-int "-17")`:                          Int(-17),
+		`(to-int 3.9)`:                            Int(3),
+		`(to-int 'A')`:                            Int(65),
+		`(to-float "2.5")`:                        Float(2.5),
+		`(to-float 2)`:                            Float(2),
+		`(to-rune 97)`:                            Rune('a'),
+		`(to-rune "é")`:                           Rune('é'),
+		`(map upper (split "a b" " "))`:           List{"A", "B"},
+		`(lower (trim (replace " A_B " "_" "")))`: "ab",
+	}
+	for code, expect := range cases {
+		ret, err := g.Parse(code)
+		if err != nil {
+			t.Fatalf("expect %s got %v but error: %v", code, expect, err)
+		}
+		if !reflect.DeepEqual(ret, expect) {
+			t.Fatalf("expect %s got %v but %v", code, expect, ret)
+		}
+	}
+	for _, code := range []string{`(split "a" 1)`, `(join '(1 2) ",")`, `(substring "abc" 2 1)`,
+		`(substring "abc" 4)`, `(substring "abc" -4)`, `(to-int "1.5")`, `(to-float "x")`,
+		`(to-rune "ab")`, `(to-rune "")`, `(upper 1)`} {
+		if _, err := g.Parse(code); err == nil {
+			t.Fatalf("expect %s got error but nil", code)
+		}
+	}
+}
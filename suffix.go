@@ -7,32 +7,35 @@ import (
 // DotSuffix 表示带 dot 分割的后缀的表达式
 func DotSuffix(x interface{}) p.P {
 	return func(st p.State) (interface{}, error) {
+		span := spanAt(st, st.Pos())
 		d, err := DotParser(st)
 		if err != nil {
 			return nil, err
 		}
-		return dotSuffix(Dot{x, d.(Atom)})(st)
+		return dotSuffix(Dot{x, d.(Atom), span})(st)
 	}
 }
 
 func dotSuffix(x interface{}) p.P {
 	return func(st p.State) (interface{}, error) {
+		span := spanAt(st, st.Pos())
 		d, err := p.Try(DotParser)(st)
 		if err != nil {
 			return x, nil
 		}
-		return dotSuffix(Dot{x, d.(Atom)})(st)
+		return dotSuffix(Dot{x, d.(Atom), span})(st)
 	}
 }
 
 // BracketSuffix 表示带 [] 后缀的表达式
 func BracketSuffix(x interface{}) p.P {
 	return func(st p.State) (interface{}, error) {
+		span := spanAt(st, st.Pos())
 		b, err := p.Try(BracketParser())(st)
 		if err != nil {
 			return nil, err
 		}
-		return bracketSuffix(Bracket{x, b.([]interface{})})(st)
+		return bracketSuffix(Bracket{x, b.([]interface{}), span})(st)
 	}
 }
 
@@ -40,33 +43,36 @@ func BracketSuffix(x interface{}) p.P {
 func BracketSuffixExt(env Env) func(interface{}) p.P {
 	return func(x interface{}) p.P {
 		return func(st p.State) (interface{}, error) {
+			span := spanAt(st, st.Pos())
 			b, err := p.Try(BracketParserExt(env))(st)
 			if err != nil {
 				return nil, err
 			}
-			return bracketSuffixExt(env)(Bracket{x, b.([]interface{})})(st)
+			return bracketSuffixExt(env)(Bracket{x, b.([]interface{}), span})(st)
 		}
 	}
 }
 
 func bracketSuffix(x interface{}) p.P {
 	return func(st p.State) (interface{}, error) {
+		span := spanAt(st, st.Pos())
 		b, err := p.Try(BracketParser())(st)
 		if err != nil {
 			return x, nil
 		}
-		return Bracket{x, b.([]interface{})}, nil
+		return Bracket{x, b.([]interface{}), span}, nil
 	}
 }
 
 func bracketSuffixExt(env Env) func(interface{}) p.P {
 	return func(x interface{}) p.P {
 		return func(st p.State) (interface{}, error) {
+			span := spanAt(st, st.Pos())
 			b, err := p.Try(BracketParserExt(env))(st)
 			if err != nil {
 				return x, nil
 			}
-			return Bracket{x, b.([]interface{})}, nil
+			return Bracket{x, b.([]interface{}), span}, nil
 		}
 	}
 }
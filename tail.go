@@ -0,0 +1,231 @@
+package gisp
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// tailCall 是尾位置上尚未执行的 Lambda 调用。它沿着 List 、 cond 、 let 的求值向外返回，
+// 由最近的 Task.Eval 替换当前的 task 后在循环中执行，所以尾递归不会增长 Go 调用栈。
+// span 是调用所在 List 的源码位置，调用出错时附在错误上。 span 无效时位置在调用所在的 List
+// site 的附加信息中，出错时才查找
+type tailCall struct {
+	task *Task
+	env  Env
+	span Span
+	site List
+}
+
+// where 给出调用所在的源码位置
+func (call *tailCall) where() Span {
+	if call.span.IsValid() {
+		return call.span
+	}
+	span, _ := SpanOf(call.site)
+	return span
+}
+
+// tailTasker 在尾位置上求值，遇到 Lambda 调用时返回 tailCall 而不执行它
+type tailTasker func(env Env) (interface{}, *tailCall, error)
+
+// eval 在非尾位置上执行尾调用，并补上调用所在 List 求值时跳过的结果检查
+func (call *tailCall) eval() (interface{}, error) {
+	value, err := call.task.Eval(call.env)
+	if err == nil {
+		err = checkResult(call.env, value)
+	}
+	if err != nil {
+		return nil, withSpan(call.where(), err)
+	}
+	return value, nil
+}
+
+// evalTail 在尾位置上对 form 求值，遇到 Lambda 调用时返回 tailCall 而不执行它
+func evalTail(env Env, form interface{}) (interface{}, *tailCall, error) {
+	if list, ok := form.(List); ok {
+		return list.evalTail(env)
+	}
+	value, err := Eval(env, form)
+	return value, nil, err
+}
+
+// evalTail 与 Eval 相同，但是 list 是 Lambda 调用时返回 tailCall
+func (list List) evalTail(env Env) (interface{}, *tailCall, error) {
+	value, call, err := list.tail(env)
+	if err == nil && call == nil {
+		err = checkResult(env, value)
+	}
+	if err != nil {
+		return nil, nil, withSpan(list.errSpan(err), err)
+	}
+	if call != nil && !call.span.IsValid() && call.site == nil {
+		call.site = list
+	}
+	return value, call, nil
+}
+
+func (list List) tail(env Env) (interface{}, *tailCall, error) {
+	if len(list) == 0 {
+		value, err := list.eval(env)
+		return value, nil, err
+	}
+	if err := evalStep(env); err != nil {
+		return nil, nil, err
+	}
+	if info := list.compiled(); info != nil {
+		return info.tail(env)
+	}
+	callee, err := list.callee(env)
+	if err != nil {
+		return nil, nil, err
+	}
+	return list.callTail(env, callee)
+}
+
+// tailForm 是可以在尾位置上求值的特殊形式，例如 cond 、 let 和 Control 中的控制形式
+type tailForm interface {
+	evalTail(env Env, args ...interface{}) (interface{}, *tailCall, error)
+}
+
+// callTail 与 call 相同，但是 callee 是 Function 或 Lambda 时返回 tailCall ，是 tailForm
+// 时在尾位置上对选中的分支或函数体求值
+func (list List) callTail(env Env, callee interface{}) (interface{}, *tailCall, error) {
+	switch fun := callee.(type) {
+	case *Function, *Lambda:
+		args, err := Evals(env, list[1:]...)
+		if err != nil {
+			return nil, nil, err
+		}
+		return tailStrict(env, fun, args)
+	case tailForm:
+		return fun.evalTail(env, list[1:]...)
+	}
+	value, err := list.call(env, callee)
+	return value, nil, err
+}
+
+// tailStrict 以已经求值的实参调用 Function 或 Lambda ，得到的 Task 作为 tailCall 返回
+func tailStrict(env Env, callee interface{}, args []interface{}) (interface{}, *tailCall, error) {
+	var lisp Lisp
+	var err error
+	switch fun := callee.(type) {
+	case *Function:
+		lisp, err = fun.taskParams(env, args)
+	case *Lambda:
+		lisp, err = fun.taskParams(args)
+	default:
+		value, err := callStrict(env, callee, args)
+		return value, nil, err
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+	if task, ok := lisp.(*Task); ok {
+		return nil, &tailCall{task: task, env: env}, nil
+	}
+	value, err := lisp.Eval(env)
+	return value, nil, err
+}
+
+// tailFrames 记录被尾调用替换掉的 task ，出错时补回错误的调用栈，重复的帧只写一次并附上次数。
+// 连续的同名帧（尾递归）只记录次数，反复出现的一组帧（相互尾递归）合并为一个循环并记录
+// 次数。记录的帧超过 maxTailFrames 时丢弃最早的帧，只记录丢弃的个数，所以尾调用链再长，
+// 占用的内存也是有限的
+type tailFrames struct {
+	frames  []tailFrame
+	omitted int
+}
+
+// tailFrame 是重复 count 次的一组帧， names 按调用的顺序排列，多个帧的循环至少重复两次
+type tailFrame struct {
+	names []string
+	count int
+}
+
+const (
+	// maxTailCycle 是识别相互尾递归时循环的最大长度
+	maxTailCycle = 8
+	// maxTailFrames 是 tailFrames 最多记录的帧数
+	maxTailFrames = 64
+)
+
+func (frames *tailFrames) push(name string) {
+	frames.frames = append(frames.frames, tailFrame{[]string{name}, 1})
+	frames.fold()
+	if l := len(frames.frames); l > maxTailFrames {
+		frames.omitted += l - maxTailFrames
+		frames.frames = append(frames.frames[:0], frames.frames[l-maxTailFrames:]...)
+	}
+}
+
+// fold 把末尾重复出现的帧合并为循环。末尾的 k 个单帧与它前面的循环相同时增加循环的次数，
+// 与它前面的 k 个单帧相同时合并为重复两次的循环
+func (frames *tailFrames) fold() {
+	fs := frames.frames
+	singles := 0
+	for idx := len(fs) - 1; idx >= 0 && fs[idx].count == 1 && len(fs[idx].names) == 1; idx-- {
+		singles++
+	}
+	for k := 1; k <= maxTailCycle && k <= singles; k++ {
+		tail := fs[len(fs)-k:]
+		names := make([]string, k)
+		for idx, frame := range tail {
+			names[idx] = frame.names[0]
+		}
+		if before := len(fs) - k - 1; before >= 0 && sameNames(fs[before].names, names) {
+			fs[before].count++
+			frames.frames = fs[:before+1]
+			return
+		}
+		if k*2 <= singles {
+			prev := fs[len(fs)-2*k : len(fs)-k]
+			same := true
+			for idx, frame := range prev {
+				same = same && frame.names[0] == names[idx]
+			}
+			if same {
+				frames.frames = append(fs[:len(fs)-2*k], tailFrame{names, 2})
+				return
+			}
+		}
+	}
+}
+
+func sameNames(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for idx := range a {
+		if a[idx] != b[idx] {
+			return false
+		}
+	}
+	return true
+}
+
+// wrap 把记录的帧补到 err 的调用栈上。尾递归写作一帧 name (xN) ，与调用栈上最近的同名帧
+// 合并计数；相互尾递归的循环写作一帧 a > b (xN) ，丢弃的记录写作一帧 ... (xN)
+func (frames tailFrames) wrap(err error) error {
+	for idx := len(frames.frames) - 1; idx >= 0; idx-- {
+		frame := frames.frames[idx]
+		if len(frame.names) > 1 {
+			err = withFrame(fmt.Sprintf("%s (x%d)", strings.Join(frame.names, " > "), frame.count), err)
+			continue
+		}
+		name, count := frame.names[0], frame.count
+		var gerr *GispError
+		if errors.As(err, &gerr) && len(gerr.Stack) > 0 && gerr.Stack[len(gerr.Stack)-1] == name {
+			gerr.Stack = gerr.Stack[:len(gerr.Stack)-1]
+			count++
+		}
+		if count > 1 {
+			name = fmt.Sprintf("%s (x%d)", name, count)
+		}
+		err = withFrame(name, err)
+	}
+	if frames.omitted > 0 {
+		err = withFrame(fmt.Sprintf("... (x%d)", frames.omitted), err)
+	}
+	return err
+}
@@ -0,0 +1,132 @@
+package gisp
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"testing"
+)
+
+func TestTailCallLongList(t *testing.T) {
+	g := testGisp()
+	g.DefAs("empty?", reflect.ValueOf(func(xs List) bool { return len(xs) == 0 }))
+	g.DefAs("rest", reflect.ValueOf(func(xs List) Quote { return Q(xs[1:]) }))
+	data := make(List, 100000)
+	for idx := range data {
+		data[idx] = Int(1)
+	}
+	g.DefAs("data", data)
+	_, err := g.Parse(`
+	(defun count (xs n)
+		(cond (((empty? xs) n)) (count (rest xs) (+ n 1))))`)
+	if err != nil {
+		t.Fatalf("expect defun count but error: %v", err)
+	}
+	ret, err := g.Parse("(count data 0)")
+	if err != nil {
+		t.Fatalf("expect count over 100000 items but error: %v", err)
+	}
+	if ret != Int(100000) {
+		t.Fatalf("expect count got 100000 but %v", ret)
+	}
+}
+
+func TestTailCallInLet(t *testing.T) {
+	g := testGisp()
+	g.SetLimits(Limits{MaxDepth: 10})
+	_, err := g.Parse(`
+	(defun down (n acc)
+		(let ((done (== n 0)))
+			(cond ((done acc)) (down (- n 1) (+ acc 2)))))`)
+	if err != nil {
+		t.Fatalf("expect defun down but error: %v", err)
+	}
+	ret, err := g.Parse("(down 100000 0)")
+	if err != nil || ret != Int(200000) {
+		t.Fatalf("expect (down 100000 0) within depth 10 got 200000 but %v, %v", ret, err)
+	}
+}
+
+func TestTailCallMutual(t *testing.T) {
+	g := testGisp()
+	g.SetLimits(Limits{MaxDepth: 10})
+	_, err := g.Parse(`
+	(defun pong (n) n)
+	(defun ping (n) (cond (((== n 0) "ping")) (pong (- n 1))))
+	(defun pong (n) (cond (((== n 0) "pong")) (ping (- n 1))))`)
+	if err != nil {
+		t.Fatalf("expect defun ping and pong but error: %v", err)
+	}
+	ret, err := g.Parse("(ping 1001)")
+	if err != nil || ret != "pong" {
+		t.Fatalf("expect (ping 1001) within depth 10 got pong but %v, %v", ret, err)
+	}
+}
+
+func TestTailCallErrorStack(t *testing.T) {
+	g := testGisp()
+	_, err := g.Parse(`
+	(defun fail (n) (cond (((== n 0) (error "done"))) (fail (- n 1))))
+	(defun start (n) (fail n))`)
+	if err != nil {
+		t.Fatalf("expect defun fail and start but error: %v", err)
+	}
+	_, err = g.Parse("(start 3)")
+	var gerr *GispError
+	if !errors.As(err, &gerr) {
+		t.Fatalf("expect a GispError but %v", err)
+	}
+	expect := []string{"fail (x4)", "start"}
+	if !reflect.DeepEqual(gerr.Stack, expect) {
+		t.Fatalf("expect stack %v but %v", expect, gerr.Stack)
+	}
+	if !errors.Is(err, ErrUser) {
+		t.Fatalf("expect a user error but %v", err)
+	}
+	_, err = g.Parse("(fail 100000)")
+	if !errors.As(err, &gerr) {
+		t.Fatalf("expect a GispError but %v", err)
+	}
+	if !reflect.DeepEqual(gerr.Stack, []string{"fail (x100001)"}) {
+		t.Fatalf("expect stack [fail (x100001)] but %d frames", len(gerr.Stack))
+	}
+}
+
+func TestTailFramesBounded(t *testing.T) {
+	var frames tailFrames
+	for idx := 0; idx < 10000; idx++ {
+		frames.push("ping")
+		frames.push("pong")
+	}
+	if len(frames.frames) != 1 || frames.frames[0].count != 10000 {
+		t.Fatalf("expect mutual tail calls folded into one cycle but %v", frames.frames)
+	}
+	var gerr *GispError
+	if !errors.As(frames.wrap(errors.New("boom")), &gerr) ||
+		!reflect.DeepEqual(gerr.Stack, []string{"ping > pong (x10000)"}) {
+		t.Fatalf("expect stack [ping > pong (x10000)] but %v", gerr)
+	}
+	frames = tailFrames{}
+	for idx := 0; idx < 1000; idx++ {
+		frames.push(fmt.Sprintf("f%d", idx))
+	}
+	if len(frames.frames) != maxTailFrames || frames.omitted != 1000-maxTailFrames {
+		t.Fatalf("expect %d frames kept but %d, %d omitted", maxTailFrames, len(frames.frames), frames.omitted)
+	}
+	g := testGisp()
+	_, err := g.Parse(`
+	(defun pong (n) n)
+	(defun ping (n) (cond (((== n 0) (error "done"))) (pong (- n 1))))
+	(defun pong (n) (ping n))`)
+	if err != nil {
+		t.Fatalf("expect defun ping and pong but error: %v", err)
+	}
+	_, err = g.Parse("(ping 3)")
+	if !errors.As(err, &gerr) {
+		t.Fatalf("expect a GispError but %v", err)
+	}
+	expect := []string{"ping", "ping > pong (x3)"}
+	if !reflect.DeepEqual(gerr.Stack, expect) {
+		t.Fatalf("expect stack %v but %v", expect, gerr.Stack)
+	}
+}
@@ -1,13 +1,24 @@
 package gisp
 
 import (
+	"context"
 	"fmt"
 )
 
-// Task 定义了可执行的通用结构
+// Task 定义了可执行的通用结构。 Meta 保存一次调用的实参和局部变量，形参、闭包等声明
+// lambda 时确定的信息在 lambda 的 Meta 中，由所有调用共享
 type Task struct {
 	Meta    map[string]interface{}
 	Content []interface{}
+	lambda  map[string]interface{}
+}
+
+// meta 先在 task 的 Meta 中查找 key ，再到 lambda 共享的 Meta 中查找
+func (task Task) meta(key string) interface{} {
+	if value, ok := task.Meta[key]; ok {
+		return value
+	}
+	return task.lambda[key]
 }
 
 // Local 定义了 task 本地环境中的变量查找
@@ -16,45 +27,73 @@ func (task Task) Local(name string) (interface{}, bool) {
 	if slot, ok := my[name]; ok {
 		return slot.Get(), true
 	}
-	if value, ok := task.ParameterValue(name); ok {
-		return value, true
-	}
-
-	local := task.Meta["local"].(map[string]interface{})
-	value, ok := local[name]
-	return value, ok
+	return task.ParameterValue(name)
 }
 
 // ParameterValue 获取指定参数
 func (task Task) ParameterValue(name string) (interface{}, bool) {
-	formals := task.Meta["formal parameters"].(List)
-	actuals := task.Meta["actual parameters"].([]interface{})
-	lastIdx := len(actuals) - 1
+	formals := task.meta("formal parameters").(List)
 	for idx := range formals {
 		formal := formals[idx].(Atom)
 		if formal.Name == name {
-			slot := actuals[idx]
-			if idx == lastIdx {
-				isVariadic := task.Meta["is variadic"].(bool)
-				if isVariadic {
-					slots := actuals[lastIdx].([]Var)
-					value := make([]interface{}, len(slots))
-					for idx, slot := range slots {
-						value[idx] = slot.Get()
-					}
-					return value, true
-				}
-			}
-			return slot.(Var).Get(), true
+			return task.paramAt(idx), true
+		}
+	}
+	return nil, false
+}
+
+// paramAt 获取第 idx 个参数，变长参数以 List 返回
+func (task Task) paramAt(idx int) interface{} {
+	formals := task.meta("formal parameters").(List)
+	actuals := task.Meta["actual parameters"].([]interface{})
+	slot := actuals[idx]
+	if idx == len(formals)-1 && task.meta("is variadic").(bool) {
+		slots := slot.([]interface{})
+		value := make(List, len(slots))
+		for idx, slot := range slots {
+			value[idx] = slot.(Var).Get()
+		}
+		return value
+	}
+	// 默认值引用了后面尚未绑定的参数时，该参数为 nil
+	if v, ok := slot.(Var); ok {
+		return v.Get()
+	}
+	return nil
+}
+
+// paramSlot 给出非变长参数 name 的 Var
+func (task Task) paramSlot(name string) (Var, bool) {
+	formals := task.meta("formal parameters").(List)
+	actuals := task.Meta["actual parameters"].([]interface{})
+	for idx := range formals {
+		if formals[idx].(Atom).Name == name {
+			slot, ok := actuals[idx].(Var)
+			return slot, ok
 		}
 	}
 	return nil, false
 }
 
+// scope 给出 task 的外层环境，即声明 lambda 的环境。声明环境是正在求值的 Gisp 的基础环境
+// 时，以 Fork 出的子环境代替它，这样赋值写入子环境，基础环境保持只读。没有记录声明环境的
+// task 以调用它的环境为外层环境
+func (task Task) scope() Env {
+	if closure, ok := task.meta("closure").(Env); ok {
+		if base, ok := closure.(*Gisp); ok {
+			if fork := forkOf(task.Context(), base); fork != nil {
+				return fork
+			}
+		}
+		return closure
+	}
+	global, _ := task.Meta["global"].(Env)
+	return global
+}
+
 // Global 在外部环境中查找
 func (task Task) Global(name string) (interface{}, bool) {
-	global := task.Meta["global"].(Env)
-	return global.Lookup(name)
+	return task.scope().Lookup(name)
 }
 
 // Lookup 执行自内而外的查找
@@ -72,11 +111,13 @@ func (task Task) Setvar(name string, value interface{}) error {
 		mine[name].Set(value)
 		return nil
 	}
-	local := task.Meta["local"].(map[string]Var)
-	if _, ok := local[name]; ok {
-		local[name].Set(value)
+	if slot, ok := task.paramSlot(name); ok {
+		slot.Set(value)
 		return nil
 	}
+	if scope := task.scope(); scope != nil {
+		return scope.Setvar(name, value)
+	}
 	return fmt.Errorf("can't found var named %s", name)
 }
 
@@ -90,54 +131,87 @@ func (task Task) Defvar(name string, slot Var) error {
 	return nil
 }
 
-// Defun 实现 Env.Defun
+// Defun 实现 Env.Defun ，函数定义在 task 自己的命名空间 my 中
 func (task Task) Defun(name string, functor Functor) error {
-	if s, ok := task.Local(name); ok {
-		switch slot := s.(type) {
-		case Func:
-			slot.Overload(functor)
-		case Var:
-			return fmt.Errorf("%s defined as a var", name)
-		default:
-			return fmt.Errorf("exists name %s isn't Expr", name)
-		}
-	}
-	my := task.Meta["my"].(map[string]interface{})
-	my[name] = NewFunction(name, task, functor)
-	return nil
+	my := task.Meta["my"].(map[string]Var)
+	return defunLocal(task, my, name, functor)
 }
 
-// Eval 实现求值逻辑
+// Context 实现 Contexter ，task 的 context 继承自调用它的环境
+func (task Task) Context() context.Context {
+	return metaContext(task.Meta)
+}
+
+// Eval 实现求值逻辑，实参在 Lambda.Task 匹配签名时已经绑定为 Var 。函数体尾位置上（包括
+// cond 的分支和 let 的函数体）的 Lambda 调用不会在这里递归求值，而是替换当前的 task 继续
+// 循环，所以尾递归既不增长 Go 调用栈，也不消耗 Limits 的 MaxDepth 。自由命名在 lambda 的
+// 声明环境中查找， task 只从调用它的环境 env 继承 context
 func (task Task) Eval(env Env) (interface{}, error) {
-	formals := task.Meta["formal parameters"].(List)
-	actuals := task.Meta["actual parameters"].([]interface{})
-	values := make([]Var, len(actuals))
-	for idx, atom := range formals {
-		formal := atom.(Atom)
-		slot := VarSlot(formal.Type)
-		val, err := Eval(task, actuals[idx])
+	current := task
+	var frames tailFrames
+	var last *tailCall
+	for {
+		value, call, err := current.evalOnce(env)
 		if err != nil {
-			return nil, err
+			if last != nil {
+				err = withSpan(last.where(), err)
+			}
+			return nil, frames.wrap(err)
 		}
-		slot.Set(val)
-		values[idx] = slot
+		if call == nil {
+			return value, nil
+		}
+		frames.push(current.Name())
+		if call.span.IsValid() || call.site != nil {
+			last = call
+		}
+		env = call.env
+		current = *call.task
+	}
+}
+
+// evalOnce 执行 task 的函数体，尾位置上的 Lambda 调用作为 tailCall 返回
+func (task Task) evalOnce(env Env) (interface{}, *tailCall, error) {
+	if task.meta("closure") == nil {
+		task.Meta["global"] = env
+	}
+	task.Meta["context"] = ContextOf(env)
+	leave, err := enterTask(task)
+	if err != nil {
+		return nil, nil, withFrame(task.Name(), err)
+	}
+	defer leave()
+	if err := task.bindDefaults(); err != nil {
+		return nil, nil, withFrame(task.Name(), err)
 	}
-	task.Meta["actual values"] = values
+	ret, call, err := task.eval()
+	if err != nil {
+		return nil, nil, withFrame(task.Name(), escapeBoundary(err))
+	}
+	return ret, call, nil
+}
 
-	task.Meta["global"] = env
+func (task Task) eval() (interface{}, *tailCall, error) {
+	if chunk, ok := task.meta("chunk").(*Chunk); ok {
+		return chunk.execTail(task)
+	}
 	l := len(task.Content)
-	switch l {
-	case 0:
-		return nil, nil
-	case 1:
-		return Eval(task, task.Content[0])
-	default:
-		for _, Expr := range task.Content[:l-2] {
-			_, err := Eval(task, Expr)
-			if err != nil {
-				return nil, err
-			}
+	if l == 0 {
+		return nil, nil, nil
+	}
+	for _, Expr := range task.Content[:l-1] {
+		_, err := Eval(task, Expr)
+		if err != nil {
+			return nil, nil, err
 		}
-		return Eval(task, task.Content[l-1])
 	}
+	return evalTail(task, task.Content[l-1])
+}
+
+// Name 给出 task 所属的函数名，匿名 lambda 为 lambda
+func (task Task) Name() string {
+	if name, ok := task.Meta["name"].(string); ok {
+		return name
+	}
+	return "lambda"
 }
@@ -0,0 +1,148 @@
+package gisp
+
+import (
+	"errors"
+	"fmt"
+)
+
+// TryExpr 实现 (try body... (catch e handler...) (finally cleanup...)) 。 body 出错时在
+// 绑定了 e 的环境中执行 catch ，无论是否出错最后都执行 finally 。 context 取消和超出
+// Limits 的错误不能被 catch ，它们总是中止整个求值
+func TryExpr(env Env, args ...interface{}) (Tasker, error) {
+	body, catch, finally, err := tryClauses(args)
+	if err != nil {
+		return nil, err
+	}
+	return func(env Env) (interface{}, error) {
+		ret, err := evalForms(env, body)
+		if err != nil && catch != nil && catchable(err) {
+			name := catch[1].(Atom)
+			slot := VarSlot(name.Type)
+			slot.Set(err)
+			let := Let{map[string]interface{}{
+				"local": map[string]Var{name.Name: slot},
+			}, catch[2:]}
+			ret, err = let.Eval(env)
+		}
+		if finally != nil {
+			if _, ferr := evalForms(env, finally[1:]); ferr != nil {
+				return nil, ferr
+			}
+		}
+		return ret, err
+	}, nil
+}
+
+// tryClauses 检查 try 的参数，拆分出 body 、 catch 和 finally 子句，没有的子句为 nil
+func tryClauses(args []interface{}) ([]interface{}, List, List, error) {
+	body := args
+	var catch, finally List
+	if l := len(body); l > 0 && clauseIs(body[l-1], "finally") {
+		finally = body[l-1].(List)
+		body = body[:l-1]
+	}
+	if l := len(body); l > 0 && clauseIs(body[l-1], "catch") {
+		catch = body[l-1].(List)
+		body = body[:l-1]
+		if len(catch) < 2 {
+			return nil, nil, nil, fmt.Errorf("Try Args Error: expect (catch e handler...) but %v", catch)
+		}
+		if _, ok := catch[1].(Atom); !ok {
+			return nil, nil, nil, fmt.Errorf("Try Args Error: expect catch a atom but %v", catch[1])
+		}
+	}
+	for _, form := range body {
+		if clauseIs(form, "catch") || clauseIs(form, "finally") {
+			return nil, nil, nil, fmt.Errorf("Try Args Error: expect (try body... (catch e handler...) (finally ...)) but %v", form)
+		}
+	}
+	return body, catch, finally, nil
+}
+
+func clauseIs(form interface{}, name string) bool {
+	if list, ok := form.(List); ok && len(list) > 0 {
+		if head, ok := list[0].(Atom); ok {
+			return head.Name == name
+		}
+	}
+	return false
+}
+
+func evalForms(env Env, forms []interface{}) (interface{}, error) {
+	var ret interface{}
+	for _, form := range forms {
+		var err error
+		ret, err = Eval(env, form)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return ret, nil
+}
+
+// catchable 判断错误能否被 try 捕获， break 和 continue 穿过 try 交给外层的循环
+func catchable(err error) bool {
+	var cerr ContextError
+	var lerr LimitExceeded
+	var esc loopEscape
+	return !errors.As(err, &cerr) && !errors.As(err, &lerr) && !errors.As(err, &esc)
+}
+
+// ErrorCause 沿 errors.Unwrap 去掉错误上附加的源码位置、调用栈和说明，遇到 gisp 分类的
+// 错误或用户错误时停止，给出原始的错误
+func ErrorCause(err error) error {
+	for !isCause(err) {
+		inner := errors.Unwrap(err)
+		if inner == nil {
+			return err
+		}
+		err = inner
+	}
+	return err
+}
+
+// isCause 判断 err 是否是 ErrorCause 停止展开的错误。 UserError 和 PanicError 也可以
+// 展开出 Go 的错误，但它们本身才是 gisp 报告的错误
+func isCause(err error) bool {
+	switch err.(type) {
+	case NameError, TypeSignError, SignError, ArityError, UserError, PanicError:
+		return true
+	}
+	return false
+}
+
+// ErrorKind 给出错误的分类名： name 、 type sign 、 arity 、 user 、 panic ，其它错误为 error
+func ErrorKind(err error) string {
+	switch {
+	case errors.Is(err, ErrName):
+		return "name"
+	case errors.Is(err, ErrTypeSign):
+		return "type sign"
+	case errors.Is(err, ErrArity):
+		return "arity"
+	case errors.Is(err, ErrUser):
+		return "user"
+	case errors.Is(err, ErrPanic):
+		return "panic"
+	default:
+		return "error"
+	}
+}
+
+// errorInspector 构造检查 catch 到的错误的函数
+func errorInspector(name string, inspect func(err error) interface{}) LispExpr {
+	return func(env Env, args ...interface{}) (Lisp, error) {
+		if len(args) != 1 {
+			return nil, fmt.Errorf("%s Args Error: expect a error but %v", name, args)
+		}
+		params, err := Evals(env, args...)
+		if err != nil {
+			return nil, err
+		}
+		e, ok := params[0].(error)
+		if !ok {
+			return nil, fmt.Errorf("%s Args Error: expect a error but %v", name, params[0])
+		}
+		return Q(inspect(e)), nil
+	}
+}
@@ -0,0 +1,98 @@
+package gisp
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestTryCatch(t *testing.T) {
+	g := testGisp()
+	ret, err := g.Parse(`(try (missing 1) (catch e (error-kind e)))`)
+	if err != nil || ret != "name" {
+		t.Fatalf("expect catch a name error but got %v, %v", ret, err)
+	}
+	ret, err = g.Parse(`(try (errorf "no %s" "rate") (catch e (error-message e)))`)
+	if err != nil || ret != "no rate" {
+		t.Fatalf("expect catch message \"no rate\" but got %v, %v", ret, err)
+	}
+	ret, err = g.Parse(`(try (+ 1 2) (catch e 0))`)
+	if err != nil || ret != Int(3) {
+		t.Fatalf("expect try without error got 3 but %v, %v", ret, err)
+	}
+}
+
+func TestTryFinally(t *testing.T) {
+	g := testGisp()
+	g.DefAs("log", "")
+	_, err := g.Parse(`
+	(defun lookup (x)
+	    (try
+	        (error x)
+	        (catch e (error-value e))
+	        (finally (set 'log "cleaned"))))`)
+	if err != nil {
+		t.Fatalf("expect defun lookup but error: %v", err)
+	}
+	ret, err := g.Parse(`(lookup "fallback")`)
+	if err != nil || ret != "fallback" {
+		t.Fatalf("expect lookup fallback but got %v, %v", ret, err)
+	}
+	log, _ := g.Lookup("log")
+	if log != "cleaned" {
+		t.Fatalf("expect finally executed but log is %v", log)
+	}
+	_, err = g.Parse(`(try (error "uncaught") (finally (set 'log "again")))`)
+	if !errors.Is(err, ErrUser) {
+		t.Fatalf("expect error pass through try without catch but %v", err)
+	}
+	log, _ = g.Lookup("log")
+	if !reflect.DeepEqual(log, "again") {
+		t.Fatalf("expect finally executed on error but log is %v", log)
+	}
+}
+
+func TestTryNotCatchAbort(t *testing.T) {
+	g := testGisp()
+	_, err := g.Parse("(defun forever (n) (forever n))")
+	if err != nil {
+		t.Fatalf("expect defun forever but error: %v", err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	_, err = g.ParseContext(ctx, "(try (forever 1) (catch e 0))")
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expect deadline can't be catched but %v", err)
+	}
+}
+
+func TestErrorCauseUnwrap(t *testing.T) {
+	g := testGisp()
+	_, err := g.Parse(`(defun inc (x::int) (+ x 1))`)
+	if err != nil {
+		t.Fatalf("expect defun inc but error: %v", err)
+	}
+	ret, err := g.Parse(`(try (inc "a") (catch e (error-message e)))`)
+	if err != nil {
+		t.Fatalf("expect catch a type sign error but error: %v", err)
+	}
+	if msg, ok := ret.(string); !ok || strings.HasPrefix(msg, "Args Type Sign Error") {
+		t.Fatalf("expect error message without wrapper but %v", ret)
+	}
+	ret, err = g.Parse(`(try (lambda 1 x) (catch e (error-message e)))`)
+	if msg, ok := ret.(string); err != nil || !ok || strings.HasPrefix(msg, "Args Type Sign Error") {
+		t.Fatalf("expect lambda error message without wrapper but %v, %v", ret, err)
+	}
+	ret, err = g.Parse(`(try (error "plain") (catch e (error-message e)))`)
+	if err != nil || ret != "plain" {
+		t.Fatalf("expect user error message \"plain\" but %v, %v", ret, err)
+	}
+	cause := ErrorCause(fmt.Errorf("outer: %w", SourceError{Span{"", 1, 1}, NameError{"x"}}))
+	if cause != (NameError{"x"}) {
+		t.Fatalf("expect cause is name error x but %v", cause)
+	}
+}
@@ -31,7 +31,9 @@ func stop(st p.State) (interface{}, error) {
 	r, err := p.Choice(
 		p.Try(p.Space),
 		p.Try(p.Newline),
-		p.Try(p.RuneOf(":.()[]{}?")),
+		p.Try(p.RuneOf(":.()[]{}?;")),
+		p.Try(p.Str("#|")),
+		p.Try(p.Str("#;")),
 		p.Try(p.EOF),
 	)(st)
 	if err != nil {
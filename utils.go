@@ -2,6 +2,7 @@ package gisp
 
 import (
 	//px "github.com/Dwarfartisan/goparsec/parsex"
+	"errors"
 	"fmt"
 )
 
@@ -12,7 +13,7 @@ var Utils = Toolkit{
 		"category": "package",
 	},
 	Content: map[string]interface{}{
-		"errorf": func(env Env, args ...interface{}) (Tasker, error) {
+		"errorf": TaskExpr(func(env Env, args ...interface{}) (Tasker, error) {
 			if len(args) < 1 {
 				return nil, fmt.Errorf("Errorf Empty Arg Error:expect args has 1 arg a last.")
 			}
@@ -22,12 +23,14 @@ var Utils = Toolkit{
 			}
 			if tmpl, ok := params[0].(string); ok {
 				return func(env Env) (interface{}, error) {
-					return nil, fmt.Errorf(tmpl, params[1:]...)
+					message := fmt.Sprintf(tmpl, params[1:]...)
+					return nil, UserError{message, message}
 				}, nil
 			}
 			return nil, fmt.Errorf("Errorf Arg Error:expect first arg is a string but %v.", args[0])
-		},
-		"error": func(env Env, args ...interface{}) (Tasker, error) {
+		}),
+		// error 抛出 UserError ，参数可以是字符串、 Go 的 error 或其它任意值
+		"error": TaskExpr(func(env Env, args ...interface{}) (Tasker, error) {
 			if len(args) != 1 {
 				return nil, fmt.Errorf("Error Arg Error:expect args has 1 arg.")
 			}
@@ -36,12 +39,35 @@ var Utils = Toolkit{
 				return nil, err
 			}
 			return func(env Env) (interface{}, error) {
-				return nil, params[0].(error)
+				switch value := params[0].(type) {
+				case string:
+					return nil, UserError{value, value}
+				case error:
+					return nil, UserError{value.Error(), value}
+				default:
+					return nil, UserError{fmt.Sprintf("%v", value), value}
+				}
 			}, nil
-		},
-		"printf": printf,
+		}),
+		"error-message": errorInspector("error-message", func(err error) interface{} {
+			return ErrorCause(err).Error()
+		}),
+		"error-kind": errorInspector("error-kind", func(err error) interface{} {
+			return ErrorKind(err)
+		}),
+		// error-value 给出 UserError 中传给 error 的原始值，其它错误给出错误信息
+		"error-value": errorInspector("error-value", func(err error) interface{} {
+			var uerr UserError
+			if errors.As(err, &uerr) {
+				return uerr.Value
+			}
+			return ErrorCause(err).Error()
+		}),
+		"printf": TaskExpr(printf),
 		"ginq": LispExpr(func(env Env, args ...interface{}) (Lisp, error) {
-			return Q(NewGinq(args...)), nil
+			ginq := NewGinq(args...)
+			ginq.Meta["closure"] = env
+			return Q(ginq), nil
 		}),
 	},
 }
@@ -62,8 +62,16 @@ func (svar StrictVar) Get() interface{} {
 	return svar.slot.Elem().Interface()
 }
 
-// Set 实现了赋值行为
+// Set 实现了赋值行为。 interface 、指针等可以为 nil 的类型可以赋值为 nil ，其它类型赋值
+// 为 nil 时 panic
 func (svar *StrictVar) Set(value interface{}) {
+	if value == nil {
+		switch svar.Type().Kind() {
+		case reflect.Interface, reflect.Ptr, reflect.Map, reflect.Slice, reflect.Chan, reflect.Func:
+			svar.slot.Elem().Set(reflect.Zero(svar.Type()))
+			return
+		}
+	}
 	svar.slot.Elem().Set(reflect.ValueOf(value))
 }
 
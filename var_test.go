@@ -82,3 +82,12 @@ func TestStrictSetValid(t *testing.T) {
 	var slot = DefStrict(FLOAT)
 	slot.Set(Int(34))
 }
+
+func TestStrictSetNilAny(t *testing.T) {
+	var slot = DefStrict(ANY)
+	slot.Set(Int(1))
+	slot.Set(nil)
+	if val := slot.Get(); val != nil {
+		t.Fatalf("expect nil after set nil to a any var but %v", val)
+	}
+}
@@ -0,0 +1,345 @@
+package gisp
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+)
+
+// Engine 指定 Gisp 执行表达式的方式
+type Engine int
+
+const (
+	// Interpreter 直接遍历语法树求值
+	Interpreter Engine = iota
+	// VM 先把表达式和 lambda 的函数体编译为字节码，再由栈式虚拟机执行
+	VM
+)
+
+func (engine Engine) String() string {
+	switch engine {
+	case Interpreter:
+		return "interpreter"
+	case VM:
+		return "vm"
+	}
+	return fmt.Sprintf("engine(%d)", int(engine))
+}
+
+// DefaultEngine 是 NewGisp 构造的环境使用的执行方式
+var DefaultEngine = Interpreter
+
+type engineKey struct{}
+
+// engineOf 给出 env 当前求值使用的执行方式，它随 context 传递给所有的内层环境
+func engineOf(env Env) Engine {
+	if engine, ok := ContextOf(env).Value(engineKey{}).(Engine); ok {
+		return engine
+	}
+	return Interpreter
+}
+
+// Run 在 env 中执行字节码，返回最后一个表达式的值。 env 是 Gisp 时，与 Gisp.Eval 一样
+// 使用它的 Limits 和执行方式
+func (chunk *Chunk) Run(env Env) (interface{}, error) {
+	if gisp, ok := env.(*Gisp); ok {
+		return gisp.withEval(func() (interface{}, error) {
+			return chunk.exec(gisp)
+		})
+	}
+	return chunk.exec(env)
+}
+
+func (chunk *Chunk) exec(env Env) (interface{}, error) {
+	value, call, err := chunk.execTail(env)
+	if err != nil {
+		return nil, err
+	}
+	if call != nil {
+		return call.eval()
+	}
+	return value, nil
+}
+
+// execTail 执行字节码，遇到尾调用时结束执行并返回它
+func (chunk *Chunk) execTail(env Env) (interface{}, *tailCall, error) {
+	vm := vmState{env: env, stack: make([]interface{}, 0, 8)}
+	pc := 0
+	for pc < len(chunk.Code) {
+		at := pc
+		instr := chunk.Code[pc]
+		pc++
+		var value interface{}
+		var call *tailCall
+		var err error
+		env := vm.env
+		stack := vm.stack
+		switch instr.Op {
+		case OpConst:
+			stack = append(stack, chunk.Consts[instr.A])
+		case OpLookup:
+			value, err = chunk.Consts[instr.A].(Atom).Eval(env)
+			stack = append(stack, value)
+		case OpParam:
+			value, err = paramValue(env, chunk.Consts[instr.A].(Atom), instr.B)
+			stack = append(stack, value)
+		case OpEval:
+			value, err = chunk.Consts[instr.A].(Lisp).Eval(env)
+			stack = append(stack, value)
+		case OpStep:
+			err = evalStep(env)
+		case OpCallee:
+			name := chunk.Consts[instr.A].(string)
+			var ok bool
+			if value, ok = env.Lookup(name); !ok {
+				err = NameError{name}
+			}
+			stack = append(stack, value)
+		case OpSpecial:
+			top := len(stack) - 1
+			if callee := stack[top]; !isStrict(callee) {
+				list := chunk.Consts[instr.A].(List)
+				if stack[top], err = list.call(env, callee); err != nil {
+					err = withSpan(list.errSpan(err), err)
+				}
+				pc = instr.B
+			}
+		case OpCall:
+			base := len(stack) - instr.A - 1
+			args := make([]interface{}, instr.A)
+			copy(args, stack[base+1:])
+			stack[base], err = callStrict(env, stack[base], args)
+			stack = stack[:base+1]
+		case OpTailCall:
+			base := len(stack) - instr.A - 1
+			args := make([]interface{}, instr.A)
+			copy(args, stack[base+1:])
+			stack[base], call, err = tailStrict(env, stack[base], args)
+			stack = stack[:base+1]
+		case OpTailSpecial:
+			top := len(stack) - 1
+			if callee := stack[top]; !isStrict(callee) {
+				list := chunk.Consts[instr.A].(List)
+				if stack[top], call, err = list.callTail(env, callee); err != nil {
+					err = withSpan(list.errSpan(err), err)
+				}
+				pc = instr.B
+			}
+		case OpTailApply:
+			top := len(stack) - 1
+			stack[top], call, err = chunk.Consts[instr.A].(List).callTail(env, stack[top])
+		case OpForm:
+			top := len(stack) - 1
+			if formIs(stack[top], chunk.Consts[instr.A].(string)) {
+				stack = stack[:top]
+			} else {
+				pc = instr.B
+			}
+		case OpApply:
+			top := len(stack) - 1
+			stack[top], err = chunk.Consts[instr.A].(List).call(env, stack[top])
+		case OpJump:
+			pc = instr.B
+		case OpJumpIfFalse:
+			top := len(stack) - 1
+			ok := Truthy(stack[top])
+			stack = stack[:top]
+			if !ok {
+				pc = instr.B
+			}
+		case OpPop:
+			stack = stack[:len(stack)-1]
+		case OpCheck:
+			err = checkResult(env, stack[len(stack)-1])
+		case OpLet:
+			base := len(stack) - instr.B
+			var let Let
+			let, err = letScope(env, chunk.Consts[instr.A].(List), stack[base:])
+			stack = stack[:base]
+			if err == nil {
+				vm.scopes = append(vm.scopes, env)
+				vm.env = let
+			}
+		case OpLeave:
+			if l := len(vm.scopes); l > 0 {
+				vm.env = vm.scopes[l-1]
+				vm.scopes = vm.scopes[:l-1]
+			} else {
+				err = fmt.Errorf("bytecode error: leave without scope at %d", at)
+			}
+		case OpLoop:
+			vm.handlers = append(vm.handlers, handler{loop: true, brk: instr.A, cont: instr.B,
+				height: len(stack), depth: len(vm.scopes)})
+		case OpTry:
+			vm.handlers = append(vm.handlers, handler{catch: instr.A, finally: instr.B,
+				height: len(stack), depth: len(vm.scopes)})
+		case OpPopHandler:
+			if l := len(vm.handlers); l > 0 {
+				vm.handlers = vm.handlers[:l-1]
+			} else {
+				err = fmt.Errorf("bytecode error: pop handler without handler at %d", at)
+			}
+		case OpIter:
+			top := len(stack) - 1
+			var values loopValues
+			if head := chunk.Consts[instr.A].(List); instr.B == 0 {
+				values, err = dotimesValues(stack[top])
+			} else {
+				values, err = forValues(env, head, len(head)-1, stack[top])
+			}
+			stack[top] = values
+		case OpNext:
+			values, ok := stack[len(stack)-1].(loopValues)
+			if !ok {
+				err = fmt.Errorf("bytecode error: expect a loop iterator at %d", at)
+				break
+			}
+			var items []interface{}
+			if items, ok, err = values(); err == nil {
+				switch {
+				case !ok:
+					pc = instr.B
+				case len(items) != instr.A:
+					err = fmt.Errorf("bytecode error: expect %d loop vars but %d at %d", instr.A, len(items), at)
+				default:
+					stack = append(stack, items...)
+				}
+			}
+		case OpEndFinally:
+			top := len(stack) - 1
+			if pending := stack[top]; pending != nil {
+				var ok bool
+				if err, ok = pending.(error); !ok {
+					err = fmt.Errorf("bytecode error: expect a pending error but %v at %d", pending, at)
+				}
+			}
+			stack = stack[:top]
+		case OpLambda:
+			list := chunk.Consts[instr.A].(List)
+			var lambda *Lambda
+			if lambda, err = buildLambda(env, map[string]bool{}, list[1].(List), list[2:]...); err == nil {
+				lambda.Meta["chunk"] = chunk.Consts[instr.B].(*Chunk)
+				stack = append(stack, lambda)
+			} else {
+				err = boxError([]interface{}(list[1:]), lambdaArgsError(err))
+			}
+		default:
+			err = fmt.Errorf("bytecode error: unknown op %v at %d", instr.Op, at)
+		}
+		vm.stack = stack
+		if err != nil {
+			err = withSpan(chunk.Spans[at], err)
+			var ok bool
+			if pc, ok = vm.handle(err); !ok {
+				return nil, nil, err
+			}
+			continue
+		}
+		if call != nil {
+			if !call.span.IsValid() && call.site == nil {
+				call.span = chunk.Spans[at]
+			}
+			return nil, call, nil
+		}
+	}
+	if len(vm.stack) == 0 {
+		return nil, nil, nil
+	}
+	return vm.stack[len(vm.stack)-1], nil, nil
+}
+
+// vmState 是执行字节码时的状态。 scopes 保存进入 let 作用域前的环境， handlers 是当前所在
+// 的循环和 try 区域
+type vmState struct {
+	env      Env
+	stack    []interface{}
+	scopes   []Env
+	handlers []handler
+}
+
+// handler 是字节码中的循环或 try 区域， height 和 depth 是进入区域时栈和作用域的高度
+type handler struct {
+	loop           bool
+	brk, cont      int
+	catch, finally int
+	height, depth  int
+}
+
+// handle 把 err 交给最内层能处理它的区域，恢复栈和作用域，返回继续执行的位置。没有区域
+// 能处理时返回 false
+func (vm *vmState) handle(err error) (int, bool) {
+	for len(vm.handlers) > 0 {
+		top := len(vm.handlers) - 1
+		h := vm.handlers[top]
+		vm.handlers = vm.handlers[:top]
+		if h.height > len(vm.stack) || h.depth > len(vm.scopes) {
+			return 0, false
+		}
+		vm.stack = vm.stack[:h.height]
+		if h.depth < len(vm.scopes) {
+			vm.env = vm.scopes[h.depth]
+			vm.scopes = vm.scopes[:h.depth]
+		}
+		var esc loopEscape
+		switch {
+		case h.loop && errors.As(err, &esc):
+			if esc.name == "continue" {
+				vm.handlers = append(vm.handlers, h)
+				return h.cont, true
+			}
+			if h.height == 0 {
+				return 0, false
+			}
+			vm.stack[h.height-1] = esc.value
+			return h.brk, true
+		case h.loop:
+		case h.catch >= 0 && catchable(err):
+			if h.finally >= 0 {
+				vm.handlers = append(vm.handlers, handler{catch: -1, finally: h.finally,
+					height: h.height, depth: h.depth})
+			}
+			vm.stack = append(vm.stack, err)
+			return h.catch, true
+		case h.finally >= 0:
+			vm.stack = append(vm.stack, nil, err)
+			return h.finally, true
+		}
+	}
+	return 0, false
+}
+
+// formIs 判断 callee 是否是 builtins 中名为 name 的特殊形式，字节码只对它们执行编译好的代码
+func formIs(callee interface{}, name string) bool {
+	switch form := callee.(type) {
+	case condForm:
+		return name == "cond"
+	case letForm:
+		return name == "let"
+	case controlForm:
+		return form.name == name
+	case TaskerBox:
+		fun := reflect.ValueOf(form.functor).Pointer()
+		switch name {
+		case "lambda":
+			return fun == reflect.ValueOf(LambdaExpr).Pointer()
+		case "try":
+			return fun == reflect.ValueOf(TryExpr).Pointer()
+		}
+	}
+	return false
+}
+
+// paramValue 给出 Task 的第 idx 个参数，与 atom 在 Task 中的查找结果一致
+func paramValue(env Env, atom Atom, idx int) (interface{}, error) {
+	if task, ok := env.(Task); ok {
+		formals, _ := task.lambda["formal parameters"].(List)
+		actuals, _ := task.Meta["actual parameters"].([]interface{})
+		if idx >= len(actuals) || idx >= len(formals) || formals[idx].(Atom).Name != atom.Name {
+			return atom.Eval(env)
+		}
+		if _, mine := task.Meta["my"].(map[string]Var)[atom.Name]; !mine {
+			return slotValue(env, task.paramAt(idx))
+		}
+	}
+	return atom.Eval(env)
+}